@@ -0,0 +1,144 @@
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+const (
+	// ForbiddenError makes queries fail when the cloud denies access.
+	ForbiddenError = "error"
+	// ForbiddenIgnore makes resources the cloud denies access to yield no rows.
+	ForbiddenIgnore = "ignore"
+	// ForbiddenProject makes List calls denied across all projects fall back
+	// to the project the connection is scoped to, and otherwise acts like
+	// ForbiddenIgnore.
+	ForbiddenProject = "project"
+)
+
+// getForbiddenPolicy returns the on_forbidden option, which tells how to
+// handle 403 Forbidden responses.
+func getForbiddenPolicy(d *plugin.QueryData) (string, error) {
+	config := GetConfig(d.Connection)
+	if config.OnForbidden == nil {
+		return ForbiddenError, nil
+	}
+	switch *config.OnForbidden {
+	case ForbiddenError, ForbiddenIgnore, ForbiddenProject:
+		return *config.OnForbidden, nil
+	}
+	return "", fmt.Errorf("invalid on_forbidden %q: must be one of %s, %s or %s", *config.OnForbidden, ForbiddenError, ForbiddenIgnore, ForbiddenProject)
+}
+
+// getAllProjects returns the all_projects option, which tells whether List
+// calls request the resources of all projects (the default, which requires
+// admin rights) or only those of the project the connection is scoped to.
+func getAllProjects(d *plugin.QueryData) bool {
+	config := GetConfig(d.Connection)
+	return config.AllProjects == nil || *config.AllProjects
+}
+
+// shouldIgnoreError is used as the SDK ignore predicate for Get functions:
+// a missing resource yields no rows, as does a forbidden one unless the
+// on_forbidden option is "error".
+func shouldIgnoreError(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData, err error) bool {
+	if isNotFoundError(err) {
+		logger(ctx).Debug("resource not found, ignoring", "table", d.Table.Name, "error", err)
+		return true
+	}
+	if isForbiddenError(err) {
+		if policy, perr := getForbiddenPolicy(d); perr == nil && policy != ForbiddenError {
+			logger(ctx).Warn("access to resource forbidden, ignoring", "table", d.Table.Name, "error", err)
+			return true
+		}
+	}
+	return false
+}
+
+// listWithPolicy runs a List call across all projects, unless all_projects
+// is false, or within the current project; if the call is forbidden, the
+// on_forbidden option decides whether to fail, to yield no rows, or to try
+// again within the current project.
+func listWithPolicy(ctx context.Context, d *plugin.QueryData, list func(scoped bool) error) error {
+	scoped := !getAllProjects(d)
+	err := list(scoped)
+	if err == nil || !isForbiddenError(err) {
+		return err
+	}
+	policy, perr := getForbiddenPolicy(d)
+	if perr != nil {
+		return perr
+	}
+	if policy == ForbiddenProject && !scoped {
+		logger(ctx).Warn("listing across all projects forbidden, listing the current project only", "table", d.Table.Name, "error", err)
+		if err = list(true); err == nil || !isForbiddenError(err) {
+			return err
+		}
+	}
+	return ignoreForbidden(ctx, d, err)
+}
+
+// ignoreForbidden returns nil if the error is a 403 Forbidden response and
+// the on_forbidden option is not "error", the error otherwise; it is used
+// for the resources that services always list within the scope of the
+// caller, so that there is no project-scoped fallback.
+func ignoreForbidden(ctx context.Context, d *plugin.QueryData, err error) error {
+	if err == nil || !isForbiddenError(err) {
+		return err
+	}
+	policy, perr := getForbiddenPolicy(d)
+	if perr != nil {
+		return perr
+	}
+	if policy == ForbiddenError {
+		return err
+	}
+	logger(ctx).Warn("listing forbidden, ignoring", "table", d.Table.Name, "error", err)
+	return nil
+}
+
+// isNotFoundError returns whether the error is a 404 Not Found response.
+func isNotFoundError(err error) bool {
+	if _, ok := err.(gophercloud.ErrDefault404); ok {
+		return true
+	}
+	response, ok := responseError(err)
+	return ok && response.Actual == http.StatusNotFound
+}
+
+// isForbiddenError returns whether the error is a 403 Forbidden response.
+func isForbiddenError(err error) bool {
+	if _, ok := err.(gophercloud.ErrDefault403); ok {
+		return true
+	}
+	response, ok := responseError(err)
+	return ok && response.Actual == http.StatusForbidden
+}
+
+// getTokenScope returns the IDs of the project the token is scoped to and
+// of the user it was issued to.
+func getTokenScope(ctx context.Context, d *plugin.QueryData) (string, string, error) {
+	client, err := getAuthenticatedClient(ctx, d)
+	if err != nil {
+		return "", "", err
+	}
+	result, ok := client.GetAuthResult().(authResult)
+	if !ok {
+		return "", "", errUnknownAuthResult
+	}
+	projectID := ""
+	if project, err := result.ExtractProject(); err != nil {
+		return "", "", err
+	} else if project != nil {
+		projectID = project.ID
+	}
+	user, err := result.ExtractUser()
+	if err != nil {
+		return "", "", err
+	}
+	return projectID, user.ID, nil
+}
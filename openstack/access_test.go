@@ -0,0 +1,81 @@
+package openstack
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+func testQueryData(config openstackConfig) *plugin.QueryData {
+	return &plugin.QueryData{
+		Connection: &plugin.Connection{Name: "test", Config: config},
+		Table:      &plugin.Table{Name: "openstack_test"},
+	}
+}
+
+func TestAccessErrors(t *testing.T) {
+	notFound := gophercloud.ErrDefault404{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusNotFound}}
+	forbidden := gophercloud.ErrDefault403{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusForbidden}}
+	generic := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusForbidden}
+
+	if !isNotFoundError(notFound) || isNotFoundError(forbidden) {
+		t.Errorf("404 responses not recognised")
+	}
+	if !isForbiddenError(forbidden) || !isForbiddenError(generic) || isForbiddenError(notFound) {
+		t.Errorf("403 responses not recognised")
+	}
+
+	ctx := testContext()
+	d := testQueryData(openstackConfig{})
+	if !shouldIgnoreError(ctx, d, nil, notFound) {
+		t.Errorf("404 on Get should be ignored")
+	}
+	if shouldIgnoreError(ctx, d, nil, forbidden) {
+		t.Errorf("403 on Get should not be ignored by default")
+	}
+	d = testQueryData(openstackConfig{OnForbidden: utils.PointerTo(ForbiddenIgnore)})
+	if !shouldIgnoreError(ctx, d, nil, forbidden) {
+		t.Errorf("403 on Get should be ignored with on_forbidden = %q", ForbiddenIgnore)
+	}
+}
+
+func TestListWithPolicy(t *testing.T) {
+	forbidden := gophercloud.ErrDefault403{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusForbidden}}
+
+	tests := []struct {
+		config openstackConfig
+		calls  []bool
+		err    bool
+	}{
+		{openstackConfig{}, []bool{false}, true},
+		{openstackConfig{OnForbidden: utils.PointerTo(ForbiddenIgnore)}, []bool{false}, false},
+		{openstackConfig{OnForbidden: utils.PointerTo(ForbiddenProject)}, []bool{false, true}, false},
+		{openstackConfig{AllProjects: utils.PointerTo(false)}, []bool{true}, false},
+		{openstackConfig{OnForbidden: utils.PointerTo("maybe")}, []bool{false}, true},
+	}
+	for i, test := range tests {
+		calls := []bool{}
+		err := listWithPolicy(testContext(), testQueryData(test.config), func(scoped bool) error {
+			calls = append(calls, scoped)
+			if !scoped {
+				return forbidden
+			}
+			return nil
+		})
+		if (err != nil) != test.err {
+			t.Errorf("test %d: unexpected error %v", i, err)
+		}
+		if len(calls) != len(test.calls) {
+			t.Errorf("test %d: expected calls %v, got %v", i, test.calls, calls)
+			continue
+		}
+		for j := range calls {
+			if calls[j] != test.calls[j] {
+				t.Errorf("test %d: expected calls %v, got %v", i, test.calls, calls)
+			}
+		}
+	}
+}
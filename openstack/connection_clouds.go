@@ -0,0 +1,166 @@
+package openstack
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cloudsFile is the structure of a clouds.yaml (or secure.yaml) file, as
+// used by the OpenStack CLI, Terraform, Ansible and the other clients that
+// rely on os-client-config/openstacksdk.
+type cloudsFile struct {
+	Clouds map[string]cloudProfile `yaml:"clouds"`
+}
+
+// cloudProfile is a named cloud entry in a clouds.yaml file; only the
+// settings that are meaningful to the plugin are unmarshalled.
+type cloudProfile struct {
+	Auth struct {
+		AuthURL                     string `yaml:"auth_url"`
+		UserID                      string `yaml:"user_id"`
+		Username                    string `yaml:"username"`
+		Password                    string `yaml:"password"`
+		ProjectID                   string `yaml:"project_id"`
+		ProjectName                 string `yaml:"project_name"`
+		DomainID                    string `yaml:"domain_id"`
+		DomainName                  string `yaml:"domain_name"`
+		UserDomainID                string `yaml:"user_domain_id"`
+		UserDomainName              string `yaml:"user_domain_name"`
+		ProjectDomainID             string `yaml:"project_domain_id"`
+		ProjectDomainName           string `yaml:"project_domain_name"`
+		Token                       string `yaml:"token"`
+		ApplicationCredentialID     string `yaml:"application_credential_id"`
+		ApplicationCredentialSecret string `yaml:"application_credential_secret"`
+	} `yaml:"auth"`
+	AuthType           string `yaml:"auth_type"`
+	RegionName         string `yaml:"region_name"`
+	Interface          string `yaml:"interface"`
+	IdentityAPIVersion string `yaml:"identity_api_version"`
+	CACert             string `yaml:"cacert"`
+	Cert               string `yaml:"cert"`
+	Key                string `yaml:"key"`
+	Verify             *bool  `yaml:"verify"`
+}
+
+// cloudsFileLocations returns the locations where a clouds.yaml (or a
+// secure.yaml) file is looked for, in order of precedence; this is the
+// same search path used by the OpenStack CLI.
+func cloudsFileLocations(name string) []string {
+	locations := []string{
+		name,
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		locations = append(locations, filepath.Join(home, ".config", "openstack", name))
+	}
+	locations = append(locations, filepath.Join("/etc", "openstack", name))
+	return locations
+}
+
+// findCloudsFile looks for the clouds.yaml file; if an explicit path was
+// provided it is used as is, otherwise the OS_CLIENT_CONFIG_FILE variable
+// and the default locations are tried.
+func findCloudsFile(path string, getenv func(string) string) (string, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("invalid clouds file %q: %w", path, err)
+		}
+		return path, nil
+	}
+	if path := getenv("OS_CLIENT_CONFIG_FILE"); path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("invalid clouds file %q: %w", path, err)
+		}
+		return path, nil
+	}
+	for _, location := range cloudsFileLocations("clouds.yaml") {
+		if _, err := os.Stat(location); err == nil {
+			return location, nil
+		}
+	}
+	return "", errors.New("no clouds.yaml file found")
+}
+
+// findSecureFile looks for the optional secure.yaml file, first as per the
+// OS_CLIENT_SECURE_FILE variable, then next to the clouds.yaml file and
+// eventually in the default locations; an empty string is returned if none
+// is found.
+func findSecureFile(cloudsPath string, getenv func(string) string) string {
+	if path := getenv("OS_CLIENT_SECURE_FILE"); path != "" {
+		return path
+	}
+	locations := append([]string{filepath.Join(filepath.Dir(cloudsPath), "secure.yaml")}, cloudsFileLocations("secure.yaml")...)
+	for _, location := range locations {
+		if _, err := os.Stat(location); err == nil {
+			return location
+		}
+	}
+	return ""
+}
+
+// loadCloudProfile reads the given cloud profile from the clouds.yaml file
+// (merging the secrets in secure.yaml, if available); path can be empty, in
+// which case the file is looked for in the default locations; getenv is used
+// to look up the OS_CLIENT_* variables.
+func loadCloudProfile(path string, cloud string, getenv func(string) string) (*cloudProfile, error) {
+	cloudsPath, err := findCloudsFile(path, getenv)
+	if err != nil {
+		return nil, err
+	}
+	clouds, err := readYAMLFile(cloudsPath)
+	if err != nil {
+		return nil, err
+	}
+	if securePath := findSecureFile(cloudsPath, getenv); securePath != "" {
+		secure, err := readYAMLFile(securePath)
+		if err != nil {
+			return nil, err
+		}
+		clouds = mergeYAMLMaps(clouds, secure)
+	}
+
+	// round trip the merged data into the strongly typed structure
+	data, err := yaml.Marshal(clouds)
+	if err != nil {
+		return nil, err
+	}
+	file := &cloudsFile{}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("invalid clouds file %q: %w", cloudsPath, err)
+	}
+	profile, ok := file.Clouds[cloud]
+	if !ok {
+		return nil, fmt.Errorf("cloud %q not found in %q", cloud, cloudsPath)
+	}
+	return &profile, nil
+}
+
+func readYAMLFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q: %w", path, err)
+	}
+	result := map[string]any{}
+	if err := yaml.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("error parsing %q: %w", path, err)
+	}
+	return result, nil
+}
+
+// mergeYAMLMaps recursively merges the values in src into dst; values in
+// src take precedence over those in dst.
+func mergeYAMLMaps(dst map[string]any, src map[string]any) map[string]any {
+	for key, value := range src {
+		if srcMap, ok := value.(map[string]any); ok {
+			if dstMap, ok := dst[key].(map[string]any); ok {
+				dst[key] = mergeYAMLMaps(dstMap, srcMap)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+	return dst
+}
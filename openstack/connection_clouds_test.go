@@ -0,0 +1,223 @@
+package openstack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+)
+
+const testCloudsYAML = `
+clouds:
+  lab:
+    auth:
+      auth_url: https://keystone.example.com:5000/v3
+      username: admin
+      project_name: admin
+      user_domain_name: Default
+    region_name: RegionOne
+    interface: internal
+    identity_api_version: 3
+    cacert: /etc/ssl/lab.pem
+    verify: false
+`
+
+const testSecureYAML = `
+clouds:
+  lab:
+    auth:
+      password: s3cr3t
+`
+
+func writeTestCloudsFile(t *testing.T) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clouds.yaml")
+	if err := os.WriteFile(path, []byte(testCloudsYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secure.yaml"), []byte(testSecureYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCloudProfile(t *testing.T) {
+	path := writeTestCloudsFile(t)
+
+	profile, err := loadCloudProfile(path, "lab", noEnvironment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Auth.Password != "s3cr3t" {
+		t.Fatalf("password not merged from secure.yaml")
+	}
+	if profile.IdentityAPIVersion != "3" {
+		t.Fatalf("unexpected identity API version: %q", profile.IdentityAPIVersion)
+	}
+	if profile.Interface != "internal" || profile.CACert != "/etc/ssl/lab.pem" {
+		t.Fatalf("endpoint settings not loaded from profile")
+	}
+	if profile.Verify == nil || *profile.Verify {
+		t.Fatalf("unexpected verify flag: %v", profile.Verify)
+	}
+
+	if _, err := loadCloudProfile(path, "missing", noEnvironment); err == nil {
+		t.Fatalf("expected error for missing cloud")
+	}
+
+	settings, err := resolveConnectionSettings(openstackConfig{
+		Cloud:      utils.PointerTo("lab"),
+		CloudsFile: utils.PointerTo(path),
+		Region:     utils.PointerTo("RegionTwo"),
+	}, noEnvironment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *settings.Region != "RegionTwo" {
+		t.Fatalf("explicit region overridden by profile: %q", *settings.Region)
+	}
+	if *settings.Username != "admin" || *settings.Password != "s3cr3t" || *settings.UserDomainName != "Default" {
+		t.Fatalf("auth info not loaded from profile")
+	}
+	if *settings.Interface != "internal" || *settings.CACert != "/etc/ssl/lab.pem" {
+		t.Fatalf("endpoint settings not loaded from profile")
+	}
+}
+
+func TestResolveConnectionSettingsPrecedence(t *testing.T) {
+	path := writeTestCloudsFile(t)
+
+	environment := map[string]string{
+		"OS_CLOUD":       "lab",
+		"OS_USERNAME":    "operator",
+		"OS_REGION_NAME": "RegionThree",
+	}
+	getenv := func(key string) string {
+		return environment[key]
+	}
+
+	settings, err := resolveConnectionSettings(openstackConfig{
+		CloudsFile: utils.PointerTo(path),
+		Region:     utils.PointerTo("RegionTwo"),
+	}, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]struct {
+		value  *string
+		want   string
+		source settingSource
+	}{
+		"cloud":            {settings.Cloud, "lab", sourceEnvironment},
+		"region":           {settings.Region, "RegionTwo", sourceConfig},
+		"username":         {settings.Username, "operator", sourceEnvironment},
+		"password":         {settings.Password, "s3cr3t", sourceCloudsFile},
+		"user_domain_name": {settings.UserDomainName, "Default", sourceCloudsFile},
+	}
+	for name, test := range expected {
+		if test.value == nil || *test.value != test.want {
+			t.Errorf("%s: expected %q, got %v", name, test.want, test.value)
+		}
+		if settings.Sources[name] != test.source {
+			t.Errorf("%s: expected source %q, got %q", name, test.source, settings.Sources[name])
+		}
+	}
+	if settings.Sources["allow_reauth"] != sourceDefault || !*settings.AllowReauth {
+		t.Errorf("allow_reauth should default to true")
+	}
+
+	// with no environment, there is no cloud profile either
+	settings, err = resolveConnectionSettings(openstackConfig{}, noEnvironment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Cloud != nil || settings.Username != nil {
+		t.Errorf("unexpected settings from environment")
+	}
+}
+
+func TestResolveAuthMethod(t *testing.T) {
+	path := writeTestCloudsFile(t)
+
+	// an application credential in the environment does not override the
+	// username and password in the configuration, with the password coming
+	// from the profile
+	environment := map[string]string{
+		"OS_APPLICATION_CREDENTIAL_ID":     "app",
+		"OS_APPLICATION_CREDENTIAL_SECRET": "secret",
+	}
+	getenv := func(key string) string {
+		return environment[key]
+	}
+	settings, err := resolveConnectionSettings(openstackConfig{
+		Cloud:      utils.PointerTo("lab"),
+		CloudsFile: utils.PointerTo(path),
+		Username:   utils.PointerTo("operator"),
+	}, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.AuthMethod != authPassword || settings.AppCredentialID != nil || settings.AppCredentialSecret != nil {
+		t.Errorf("expected password authentication, got %q", settings.AuthMethod)
+	}
+	if *settings.Username != "operator" || *settings.Password != "s3cr3t" {
+		t.Errorf("unexpected username and password")
+	}
+
+	// without explicit credentials, the environment wins over the profile
+	settings, err = resolveConnectionSettings(openstackConfig{
+		Cloud:      utils.PointerTo("lab"),
+		CloudsFile: utils.PointerTo(path),
+	}, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.AuthMethod != authApplicationCredential || settings.Username != nil || settings.Password != nil {
+		t.Errorf("expected application credential authentication, got %q", settings.AuthMethod)
+	}
+	if *settings.AppCredentialID != "app" || *settings.AppCredentialSecret != "secret" {
+		t.Errorf("unexpected application credential")
+	}
+}
+
+func TestResolveDomains(t *testing.T) {
+	environment := map[string]string{
+		"OS_USER_DOMAIN_NAME":    "users",
+		"OS_PROJECT_DOMAIN_ID":   "projects-id",
+		"OS_PROJECT_DOMAIN_NAME": "projects",
+	}
+	getenv := func(key string) string {
+		return environment[key]
+	}
+	settings, err := resolveConnectionSettings(openstackConfig{}, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.UserDomainID != nil || *settings.UserDomainName != "users" {
+		t.Errorf("unexpected user domain")
+	}
+	if *settings.ProjectDomainID != "projects-id" || settings.ProjectDomainName != nil {
+		t.Errorf("unexpected project domain")
+	}
+
+	// the generic domain applies to both, unless a more specific setting
+	// comes from a source with the same or a higher precedence
+	settings, err = resolveConnectionSettings(openstackConfig{
+		DomainName: utils.PointerTo("Default"),
+	}, getenv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.UserDomainID != nil || *settings.UserDomainName != "Default" || settings.Sources["user_domain_name"] != sourceConfig {
+		t.Errorf("unexpected user domain")
+	}
+	if settings.ProjectDomainID != nil || *settings.ProjectDomainName != "Default" {
+		t.Errorf("unexpected project domain")
+	}
+}
+
+func noEnvironment(string) string {
+	return ""
+}
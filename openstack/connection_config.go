@@ -6,30 +6,72 @@ import (
 )
 
 type openstackConfig struct {
-	EndpointUrl                *string `cty:"endpoint_url"`
-	UserID                     *string `cty:"userid"`
-	Username                   *string `cty:"username"`
-	Password                   *string `cty:"password"`
-	Region                     *string `cty:"region"`
-	ProjectID                  *string `cty:"project_id"`
-	ProjectName                *string `cty:"project_name"`
-	DomainID                   *string `cty:"domain_id"`
-	DomainName                 *string `cty:"domain_name"`
-	AccessToken                *string `cty:"access_token"`
-	AppCredentialID            *string `cty:"app_credential_id"`
-	AppCredentialSecret        *string `cty:"app_credential_secret"`
-	AllowReauth                *bool   `cty:"allow_reauth"`
-	TraceLevel                 *string `cty:"trace_level"`
-	IdentityV3Microversion     *string `cty:"identity_v3_microversion"`
-	ComputeV2Microversion      *string `cty:"compute_v2_microversion"`
-	NetworkV2Microversion      *string `cty:"network_v2_microversion"`
-	BlockStorageV3Microversion *string `cty:"blockstorage_v3_microversion"`
-	ImageServiceV2Microversion *string `cty:"imageservice_v2_microversion"`
+	Cloud                      *string   `cty:"cloud"`
+	CloudsFile                 *string   `cty:"clouds_file"`
+	IgnoreEnvironment          *bool     `cty:"ignore_environment"`
+	EndpointUrl                *string   `cty:"endpoint_url"`
+	UserID                     *string   `cty:"userid"`
+	Username                   *string   `cty:"username"`
+	Password                   *string   `cty:"password"`
+	Region                     *string   `cty:"region"`
+	Regions                    *[]string `cty:"regions"`
+	Interface                  *string   `cty:"interface"`
+	EndpointOverride           *[]string `cty:"endpoint_override"`
+	ProjectID                  *string   `cty:"project_id"`
+	ProjectName                *string   `cty:"project_name"`
+	DomainID                   *string   `cty:"domain_id"`
+	DomainName                 *string   `cty:"domain_name"`
+	UserDomainID               *string   `cty:"user_domain_id"`
+	UserDomainName             *string   `cty:"user_domain_name"`
+	ProjectDomainID            *string   `cty:"project_domain_id"`
+	ProjectDomainName          *string   `cty:"project_domain_name"`
+	AccessToken                *string   `cty:"access_token"`
+	AppCredentialID            *string   `cty:"app_credential_id"`
+	AppCredentialSecret        *string   `cty:"app_credential_secret"`
+	AllowReauth                *bool     `cty:"allow_reauth"`
+	CACert                     *string   `cty:"cacert"`
+	Cert                       *string   `cty:"cert"`
+	Key                        *string   `cty:"key"`
+	Insecure                   *bool     `cty:"insecure"`
+	ProxyURL                   *string   `cty:"proxy_url"`
+	NoProxy                    *[]string `cty:"no_proxy"`
+	ExtraHeaders               *[]string `cty:"extra_headers"`
+	UserAgent                  *string   `cty:"user_agent"`
+	MaxRetries                 *int      `cty:"max_retries"`
+	MinRetryDelay              *string   `cty:"min_retry_delay"`
+	MaxRetryDelay              *string   `cty:"max_retry_delay"`
+	RateLimit                  *float64  `cty:"rate_limit"`
+	RateLimits                 *[]string `cty:"rate_limits"`
+	PageSize                   *int      `cty:"page_size"`
+	AllProjects                *bool     `cty:"all_projects"`
+	OnForbidden                *string   `cty:"on_forbidden"`
+	IncludeProjects            *[]string `cty:"include_projects"`
+	ExcludeProjects            *[]string `cty:"exclude_projects"`
+	IncludeDomains             *[]string `cty:"include_domains"`
+	ProjectConcurrency         *int      `cty:"project_concurrency"`
+	LookupTTL                  *string   `cty:"lookup_ttl"`
+	SnapshotDir                *string   `cty:"snapshot_dir"`
+	SnapshotMode               *string   `cty:"snapshot_mode"`
+	TraceLevel                 *string   `cty:"trace_level"`
+	IdentityV3Microversion     *string   `cty:"identity_v3_microversion"`
+	ComputeV2Microversion      *string   `cty:"compute_v2_microversion"`
+	NetworkV2Microversion      *string   `cty:"network_v2_microversion"`
+	BlockStorageV3Microversion *string   `cty:"blockstorage_v3_microversion"`
+	ImageServiceV2Microversion *string   `cty:"imageservice_v2_microversion"`
 	// TODO: check
 	// AppCredentialName          *string `cty:"app_credential_name"`
 }
 
 var ConfigSchema = map[string]*schema.Attribute{
+	"cloud": {
+		Type: schema.TypeString,
+	},
+	"clouds_file": {
+		Type: schema.TypeString,
+	},
+	"ignore_environment": {
+		Type: schema.TypeBool,
+	},
 	"endpoint_url": {
 		Type: schema.TypeString,
 	},
@@ -45,6 +87,17 @@ var ConfigSchema = map[string]*schema.Attribute{
 	"region": {
 		Type: schema.TypeString,
 	},
+	"regions": {
+		Type: schema.TypeList,
+		Elem: &schema.Attribute{Type: schema.TypeString},
+	},
+	"interface": {
+		Type: schema.TypeString,
+	},
+	"endpoint_override": {
+		Type: schema.TypeList,
+		Elem: &schema.Attribute{Type: schema.TypeString},
+	},
 	"project_id": {
 		Type: schema.TypeString,
 	},
@@ -57,6 +110,18 @@ var ConfigSchema = map[string]*schema.Attribute{
 	"domain_name": {
 		Type: schema.TypeString,
 	},
+	"user_domain_id": {
+		Type: schema.TypeString,
+	},
+	"user_domain_name": {
+		Type: schema.TypeString,
+	},
+	"project_domain_id": {
+		Type: schema.TypeString,
+	},
+	"project_domain_name": {
+		Type: schema.TypeString,
+	},
 	"access_token": {
 		Type: schema.TypeString,
 	},
@@ -72,6 +137,81 @@ var ConfigSchema = map[string]*schema.Attribute{
 	"allow_reauth": {
 		Type: schema.TypeBool,
 	},
+	"cacert": {
+		Type: schema.TypeString,
+	},
+	"cert": {
+		Type: schema.TypeString,
+	},
+	"key": {
+		Type: schema.TypeString,
+	},
+	"insecure": {
+		Type: schema.TypeBool,
+	},
+	"proxy_url": {
+		Type: schema.TypeString,
+	},
+	"no_proxy": {
+		Type: schema.TypeList,
+		Elem: &schema.Attribute{Type: schema.TypeString},
+	},
+	"extra_headers": {
+		Type: schema.TypeList,
+		Elem: &schema.Attribute{Type: schema.TypeString},
+	},
+	"user_agent": {
+		Type: schema.TypeString,
+	},
+	"max_retries": {
+		Type: schema.TypeInt,
+	},
+	"min_retry_delay": {
+		Type: schema.TypeString,
+	},
+	"max_retry_delay": {
+		Type: schema.TypeString,
+	},
+	"rate_limit": {
+		Type: schema.TypeFloat,
+	},
+	"rate_limits": {
+		Type: schema.TypeList,
+		Elem: &schema.Attribute{Type: schema.TypeString},
+	},
+	"page_size": {
+		Type: schema.TypeInt,
+	},
+	"all_projects": {
+		Type: schema.TypeBool,
+	},
+	"on_forbidden": {
+		Type: schema.TypeString,
+	},
+	"include_projects": {
+		Type: schema.TypeList,
+		Elem: &schema.Attribute{Type: schema.TypeString},
+	},
+	"exclude_projects": {
+		Type: schema.TypeList,
+		Elem: &schema.Attribute{Type: schema.TypeString},
+	},
+	"include_domains": {
+		Type: schema.TypeList,
+		Elem: &schema.Attribute{Type: schema.TypeString},
+	},
+	"project_concurrency": {
+		Type: schema.TypeInt,
+	},
+	"lookup_ttl": {
+		Type: schema.TypeString,
+	},
+	"snapshot_dir": {
+		Type: schema.TypeString,
+	},
+	"snapshot_mode": {
+		Type: schema.TypeString,
+	},
 	"trace_level": {
 		Type: schema.TypeString,
 	},
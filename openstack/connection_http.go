@@ -0,0 +1,167 @@
+package openstack
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// newHTTPClient creates the HTTP client used by the provider client, and
+// thus by all service clients, applying the TLS settings of the connection
+// (a custom CA bundle, a client certificate for mutual TLS and insecure
+// mode), the HTTP proxy, the extra request headers and the per-service rate
+// limits; in snapshot mode, the responses are recorded to, or replayed
+// from, the snapshot directory.
+func newHTTPClient(settings *connectionSettings) (http.Client, error) {
+	mode, err := getSnapshotMode(settings)
+	if err != nil {
+		return http.Client{}, err
+	}
+
+	var next http.RoundTripper
+	if mode == SnapshotReplay {
+		// the cloud is never contacted, so TLS and proxy settings do not apply
+		if next, err = newReplayTransport(*settings.SnapshotDir); err != nil {
+			return http.Client{}, err
+		}
+	} else {
+		if next, err = newTransport(settings); err != nil {
+			return http.Client{}, err
+		}
+		if mode == SnapshotRecord {
+			if next, err = newRecordTransport(*settings.SnapshotDir, next); err != nil {
+				return http.Client{}, err
+			}
+		}
+	}
+
+	headers, err := parseHeaders(settings.ExtraHeaders)
+	if err != nil {
+		return http.Client{}, err
+	}
+	if len(headers) > 0 {
+		next = &headerTransport{headers: headers, next: next}
+	}
+	// service rate limiters are registered as service clients are created
+	return http.Client{Transport: &rateLimitTransport{next: next}}, nil
+}
+
+// newTransport creates the transport to the cloud, with the TLS and proxy
+// settings of the connection.
+func newTransport(settings *connectionSettings) (http.RoundTripper, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	config, err := newTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		transport.TLSClientConfig = config
+	}
+
+	if settings.ProxyURL != nil {
+		proxy := &httpproxy.Config{
+			HTTPProxy:  *settings.ProxyURL,
+			HTTPSProxy: *settings.ProxyURL,
+		}
+		if settings.NoProxy != nil {
+			proxy.NoProxy = strings.Join(*settings.NoProxy, ",")
+		}
+		proxyFunc := proxy.ProxyFunc()
+		transport.Proxy = func(request *http.Request) (*url.URL, error) {
+			return proxyFunc(request.URL)
+		}
+	}
+	return transport, nil
+}
+
+// newTLSConfig returns the TLS configuration for the connection, or nil if
+// the defaults apply.
+func newTLSConfig(settings *connectionSettings) (*tls.Config, error) {
+	insecure := settings.Insecure != nil && *settings.Insecure
+	if settings.CACert == nil && settings.Cert == nil && settings.Key == nil && !insecure {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+	if settings.CACert != nil {
+		pem, err := os.ReadFile(*settings.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificate bundle %q: %w", *settings.CACert, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates in CA certificate bundle %q", *settings.CACert)
+		}
+		config.RootCAs = pool
+	}
+	if settings.Cert != nil || settings.Key != nil {
+		if settings.Cert == nil || settings.Key == nil {
+			return nil, errors.New("both client certificate and key must be provided for mutual TLS")
+		}
+		certificate, err := tls.LoadX509KeyPair(*settings.Cert, *settings.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate %q: %w", *settings.Cert, err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// parseHeaders parses a list of "Name: value" strings into HTTP headers.
+func parseHeaders(values *[]string) (http.Header, error) {
+	headers := http.Header{}
+	if values == nil {
+		return headers, nil
+	}
+	for _, entry := range *values {
+		name, value, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid extra header %q: expected \"Name: value\"", entry)
+		}
+		headers.Add(name, strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// headerTransport adds a set of extra headers to every outgoing request;
+// headers already set on the request (e.g. the authentication token or the
+// User-Agent) are never overwritten.
+type headerTransport struct {
+	headers http.Header
+	next    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	for name, values := range t.headers {
+		if request.Header.Get(name) == "" {
+			request.Header[name] = values
+		}
+	}
+	return t.next.RoundTrip(request)
+}
+
+// userAgent returns the User-Agent product tokens identifying the plugin
+// and its version, followed by the user-provided suffix, if any; they are
+// prepended to the gophercloud default User-Agent.
+func userAgent(settings *connectionSettings) []string {
+	tokens := []string{fmt.Sprintf("steampipe-plugin-openstack/%s", Version)}
+	if settings.UserAgent != nil && *settings.UserAgent != "" {
+		tokens = append(tokens, *settings.UserAgent)
+	}
+	return tokens
+}
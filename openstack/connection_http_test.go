@@ -0,0 +1,79 @@
+package openstack
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+)
+
+func TestNewHTTPClientTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	cacert := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	if err := os.WriteFile(cacert, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, test := range map[string]struct {
+		config  openstackConfig
+		success bool
+	}{
+		"default":  {openstackConfig{}, false},
+		"cacert":   {openstackConfig{CACert: utils.PointerTo(cacert)}, true},
+		"insecure": {openstackConfig{Insecure: utils.PointerTo(true)}, true},
+	} {
+		client, err := newHTTPClient(&connectionSettings{openstackConfig: test.config})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		response, err := client.Get(server.URL)
+		if err == nil {
+			response.Body.Close()
+		}
+		if (err == nil) != test.success {
+			t.Errorf("%s: unexpected result: %v", name, err)
+		}
+	}
+
+	if _, err := newHTTPClient(&connectionSettings{openstackConfig: openstackConfig{Cert: utils.PointerTo(cacert)}}); err == nil {
+		t.Errorf("expected error with client certificate and no key")
+	}
+}
+
+func TestNewHTTPClientProxyAndHeaders(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String()+" "+r.Header.Get("X-Audit"))
+	}))
+	defer proxy.Close()
+
+	client, err := newHTTPClient(&connectionSettings{openstackConfig: openstackConfig{
+		ProxyURL:     utils.PointerTo(proxy.URL),
+		NoProxy:      &[]string{"direct.example.com"},
+		ExtraHeaders: &[]string{"X-Audit: steampipe"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Get("http://keystone.example.com:5000/v3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if len(proxied) != 1 || proxied[0] != "http://keystone.example.com:5000/v3 steampipe" {
+		t.Errorf("unexpected proxied requests: %v", proxied)
+	}
+
+	if _, err := newHTTPClient(&connectionSettings{openstackConfig: openstackConfig{
+		ExtraHeaders: &[]string{"no separator"},
+	}}); err == nil {
+		t.Errorf("expected error with invalid header")
+	}
+}
@@ -3,18 +3,22 @@ package openstack
 import (
 	"context"
 	"fmt"
+	"strings"
 
-	"github.com/dihedron/steampipe-plugin-utils/utils"
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 )
 
 const (
-	// defaults currently referring to Train
+	// the highest microversions supported by the plugin (currently referring
+	// to Train, except for block storage, where 3.60 from Ussuri adds time
+	// filters), used unless a lower maximum is configured; the microversion
+	// actually used with compute and block storage is negotiated with the
+	// cloud
 	DefaultComputeV2Microversion      = "2.79"
 	DefaultIdentityV3Microversion     = "3.13"
-	DefaultBlockStorageV3Microversion = "3.59"
+	DefaultBlockStorageV3Microversion = "3.60"
 	DefaultImageServiceV2Microversion = "2.9"
 )
 
@@ -37,13 +41,23 @@ const (
 )
 
 type serviceConfig struct {
-	newClient       func(client *gophercloud.ProviderClient, eo gophercloud.EndpointOpts) (*gophercloud.ServiceClient, error)
+	// catalogType is the service type in the Keystone catalog.
+	catalogType string
+	newClient   func(client *gophercloud.ProviderClient, eo gophercloud.EndpointOpts) (*gophercloud.ServiceClient, error)
+	// getMicroversion returns the highest microversion the plugin may use
+	// with the service, or an empty string if the service has none.
 	getMicroversion func(config *openstackConfig) string
+	// negotiate tells whether the service publishes the range of the
+	// microversions it supports, which is then negotiated with the cloud;
+	// Keystone and Glance only publish their version ID, so the configured
+	// microversion is used as is.
+	negotiate bool
 }
 
 var serviceConfigMap = map[ServiceType]serviceConfig{
 	IdentityV3: {
-		newClient: openstack.NewIdentityV3,
+		catalogType: "identity",
+		newClient:   openstack.NewIdentityV3,
 		getMicroversion: func(config *openstackConfig) string {
 			microversion := DefaultIdentityV3Microversion
 			if config.IdentityV3Microversion != nil {
@@ -53,7 +67,9 @@ var serviceConfigMap = map[ServiceType]serviceConfig{
 		},
 	},
 	ComputeV2: {
-		newClient: openstack.NewComputeV2,
+		catalogType: "compute",
+		newClient:   openstack.NewComputeV2,
+		negotiate:   true,
 		getMicroversion: func(config *openstackConfig) string {
 			microversion := DefaultComputeV2Microversion
 			if config.ComputeV2Microversion != nil {
@@ -63,14 +79,17 @@ var serviceConfigMap = map[ServiceType]serviceConfig{
 		},
 	},
 	NetworkV2: {
-		newClient: openstack.NewNetworkV2,
+		catalogType: "network",
+		newClient:   openstack.NewNetworkV2,
 		getMicroversion: func(config *openstackConfig) string {
 			// TODO: check if we need to leverage/support micro-versions
 			return ""
 		},
 	},
 	BlockStorageV3: {
-		newClient: openstack.NewBlockStorageV3,
+		catalogType: "volumev3",
+		newClient:   openstack.NewBlockStorageV3,
+		negotiate:   true,
 		getMicroversion: func(config *openstackConfig) string {
 			microversion := DefaultBlockStorageV3Microversion
 			if config.BlockStorageV3Microversion != nil {
@@ -80,7 +99,8 @@ var serviceConfigMap = map[ServiceType]serviceConfig{
 		},
 	},
 	ImageServiceV2: {
-		newClient: openstack.NewImageServiceV2,
+		catalogType: "image",
+		newClient:   openstack.NewImageServiceV2,
 		getMicroversion: func(config *openstackConfig) string {
 			microversion := DefaultImageServiceV2Microversion
 			if config.ImageServiceV2Microversion != nil {
@@ -92,45 +112,127 @@ var serviceConfigMap = map[ServiceType]serviceConfig{
 }
 
 func getServiceClient(ctx context.Context, d *plugin.QueryData, key ServiceType) (*gophercloud.ServiceClient, error) {
-	plugin.Logger(ctx).Debug("returning service client", "type", key)
+	logger(ctx).Debug("returning service client", "type", key)
+
+	settings, err := getConnectionSettings(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	region := getQueryRegion(ctx, settings, key)
+	cacheKey := fmt.Sprintf("%s/%s", key, region)
 
 	// load connection from cache, which preserves throttling protection etc
-	if cachedData, ok := d.ConnectionManager.Cache.Get(string(key)); ok {
-		plugin.Logger(ctx).Debug("returning service client from cache")
-		return cachedData.(*gophercloud.ServiceClient), nil
+	if cachedData, ok := d.ConnectionManager.Cache.Get(cacheKey); ok {
+		logger(ctx).Debug("returning service client from cache", "region", region)
+		return withContext(ctx, cachedData.(*gophercloud.ServiceClient)), nil
 	}
 
 	if _, ok := serviceConfigMap[key]; !ok {
-		plugin.Logger(ctx).Error("invalid service client type", "type", key)
+		logger(ctx).Error("invalid service client type", "type", key)
 		panic(fmt.Sprintf("invalid service type: %q", key))
 	}
 
-	plugin.Logger(ctx).Info("creating new service client", "type", key)
+	logger(ctx).Info("creating new service client", "type", key, "region", region)
 	api, err := getAuthenticatedClient(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("no valid authenticated provider client available", "error", err)
+		logger(ctx).Error("no valid authenticated provider client available", "error", err)
 		return nil, err
 	}
 
-	openstackConfig := GetConfig(d.Connection)
-	region := ""
-	if openstackConfig.Region != nil {
-		region = *openstackConfig.Region
+	availability := gophercloud.AvailabilityPublic
+	if settings.Interface != nil {
+		if availability, err = toAvailability(*settings.Interface); err != nil {
+			return nil, err
+		}
 	}
 
-	client, err := serviceConfigMap[key].newClient(api, gophercloud.EndpointOpts{Region: region})
+	client, err := serviceConfigMap[key].newClient(api, gophercloud.EndpointOpts{Region: region, Availability: availability})
 
 	if err != nil {
-		plugin.Logger(ctx).Error("error creating service client", "type", key, "error", err)
+		logger(ctx).Error("error creating service client", "type", key, "error", err)
 		return nil, err
 	}
-	client.Microversion = serviceConfigMap[key].getMicroversion(&openstackConfig)
+	rate, err := getRateLimit(settings, key)
+	if err != nil {
+		logger(ctx).Error("invalid rate limit settings", "error", err)
+		return nil, err
+	}
+	if limiters, ok := api.HTTPClient.Transport.(*rateLimitTransport); ok && rate > 0 {
+		logger(ctx).Debug("limiting service request rate", "type", key, "region", region, "rate", rate)
+		limiters.register(client.Endpoint, newRateLimiter(rate))
+	}
+	client.Microversion = serviceConfigMap[key].getMicroversion(&settings.openstackConfig)
+	if serviceConfigMap[key].negotiate {
+		if client.Microversion, err = getMicroversion(ctx, client, client.Microversion); err != nil {
+			logger(ctx).Error("error negotiating microversion", "type", key, "error", err)
+			return nil, err
+		}
+	}
 
 	// save to cache
-	plugin.Logger(ctx).Debug("saving service client to cache", "type", key)
-	d.ConnectionManager.Cache.Set(string(key), client)
+	logger(ctx).Debug("saving service client to cache", "type", key, "region", region)
+	d.ConnectionManager.Cache.Set(cacheKey, client)
 
-	return client, nil
+	return withContext(ctx, client), nil
+}
+
+// withContext returns a copy of the cached service client bound to the
+// context of the query, so that cancelling the query aborts its requests
+// and the backoff between retries; the copy shares the transport, the retry
+// policy and the token of the cached client, and reauthenticates through it.
+func withContext(ctx context.Context, client *gophercloud.ServiceClient) *gophercloud.ServiceClient {
+	cached := client.ProviderClient
+	provider := &gophercloud.ProviderClient{
+		IdentityBase:      cached.IdentityBase,
+		IdentityEndpoint:  cached.IdentityEndpoint,
+		EndpointLocator:   cached.EndpointLocator,
+		HTTPClient:        cached.HTTPClient,
+		UserAgent:         cached.UserAgent,
+		Context:           ctx,
+		RetryBackoffFunc:  cached.RetryBackoffFunc,
+		MaxBackoffRetries: cached.MaxBackoffRetries,
+		RetryFunc:         cached.RetryFunc,
+	}
+	provider.UseTokenLock()
+	provider.CopyTokenFrom(cached)
+	if cached.ReauthFunc != nil {
+		provider.ReauthFunc = func() error {
+			// the cached client skips the reauthentication if another query
+			// already renewed the token
+			if err := cached.Reauthenticate(provider.Token()); err != nil {
+				return err
+			}
+			provider.CopyTokenFrom(cached)
+			return nil
+		}
+	}
+	bound := *client
+	bound.ProviderClient = provider
+	return &bound
+}
+
+// getMicroversion negotiates with the cloud the microversion to use with
+// the given service client, up to the given maximum; if the cloud does not
+// publish its version document, the maximum is used as is.
+func getMicroversion(ctx context.Context, client *gophercloud.ServiceClient, maximum string) (string, error) {
+	if maximum == "" {
+		return "", nil
+	}
+	major, _, err := parseMicroversion(maximum)
+	if err != nil {
+		return "", err
+	}
+	min, max, err := getSupportedMicroversions(ctx, client, major)
+	if err != nil {
+		logger(ctx).Warn("cannot retrieve supported microversions, using configured one", "type", client.Type, "microversion", maximum, "error", err)
+		return maximum, nil
+	}
+	microversion, err := negotiateMicroversion(min, max, maximum)
+	if err != nil {
+		return "", fmt.Errorf("error negotiating %s microversion: %w", client.Type, err)
+	}
+	logger(ctx).Info("microversion negotiated", "type", client.Type, "cloud min", min, "cloud max", max, "plugin max", maximum, "microversion", microversion)
+	return microversion, nil
 }
 
 // Create the OpenStack REST API client.
@@ -138,73 +240,219 @@ func getAuthenticatedClient(ctx context.Context, d *plugin.QueryData) (*gophercl
 
 	// load connection from cache, which preserves throttling protection etc
 	if cachedData, ok := d.ConnectionManager.Cache.Get(AuthenticatedClient); ok {
-		plugin.Logger(ctx).Debug("returning the authenticated client from cache")
+		logger(ctx).Debug("returning the authenticated client from cache")
 		return cachedData.(*gophercloud.ProviderClient), nil
 	}
 
-	plugin.Logger(ctx).Info("creating new authenticated client")
+	logger(ctx).Info("creating new authenticated client")
 
-	// try with the environment first
-	auth, err := openstack.AuthOptionsFromEnv()
+	settings, err := getConnectionSettings(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Info("no auth info available in environment, filling with defaults", "error", err)
+		return nil, err
+	}
 
-		// fill the auth info from the configuration
-		auth.AllowReauth = true
-		openstackConfig := GetConfig(d.Connection)
-		plugin.Logger(ctx).Info("configuration", "info", utils.ToPrettyJSON(openstackConfig))
-		if openstackConfig.EndpointUrl != nil {
-			auth.IdentityEndpoint = *openstackConfig.EndpointUrl
-		}
-		if openstackConfig.UserID != nil {
-			auth.UserID = *openstackConfig.UserID
-		}
-		if openstackConfig.Username != nil {
-			auth.Username = *openstackConfig.Username
-		}
-		if openstackConfig.Password != nil {
-			auth.Password = *openstackConfig.Password
+	// the settings already merge the configuration, the environment and the
+	// clouds.yaml profile, so there is no need for AuthOptionsFromEnv here
+	logger(ctx).Info("configuration", "info", toRedactedJSON(settings))
+	auth := gophercloud.AuthOptions{}
+	if settings.EndpointUrl != nil {
+		auth.IdentityEndpoint = *settings.EndpointUrl
+	}
+	if settings.AllowReauth != nil {
+		auth.AllowReauth = *settings.AllowReauth
+	}
+	// the settings only carry those of the authentication method with the
+	// highest precedence, see resolveAuthMethod
+	logger(ctx).Debug("authenticating", "method", settings.AuthMethod)
+	if settings.AuthMethod == authApplicationCredential {
+		//
+		// IMPORTANT NOTE: when using App Credentials, it is necessary
+		// that all other fields except the endpoint URL be left blank!
+		//
+		if settings.AppCredentialID != nil {
+			auth.ApplicationCredentialID = *settings.AppCredentialID
 		}
-		if openstackConfig.ProjectID != nil {
-			auth.TenantID = *openstackConfig.ProjectID
+		if settings.AppCredentialSecret != nil {
+			auth.ApplicationCredentialSecret = *settings.AppCredentialSecret
 		}
-		if openstackConfig.ProjectName != nil {
-			auth.TenantName = *openstackConfig.ProjectName
+	} else {
+		if settings.UserID != nil {
+			auth.UserID = *settings.UserID
 		}
-		if openstackConfig.DomainID != nil {
-			auth.DomainID = *openstackConfig.DomainID
+		if settings.Username != nil {
+			auth.Username = *settings.Username
 		}
-		if openstackConfig.DomainName != nil {
-			auth.DomainName = *openstackConfig.DomainName
+		if settings.Password != nil {
+			auth.Password = *settings.Password
 		}
-		if openstackConfig.AccessToken != nil {
-			auth.TokenID = *openstackConfig.AccessToken
+		if settings.UserDomainID != nil {
+			auth.DomainID = *settings.UserDomainID
 		}
-		if openstackConfig.AppCredentialID != nil {
-			auth.ApplicationCredentialID = *openstackConfig.AppCredentialID
+		if settings.UserDomainName != nil {
+			auth.DomainName = *settings.UserDomainName
 		}
-		if openstackConfig.AppCredentialSecret != nil {
-			auth.ApplicationCredentialSecret = *openstackConfig.AppCredentialSecret
+		if settings.AccessToken != nil {
+			auth.TokenID = *settings.AccessToken
 		}
-		if openstackConfig.AllowReauth != nil {
-			auth.AllowReauth = *openstackConfig.AllowReauth
+		// the project may live in a different domain than the user
+		if settings.ProjectID != nil {
+			auth.Scope = &gophercloud.AuthScope{ProjectID: *settings.ProjectID}
+		} else if settings.ProjectName != nil {
+			auth.Scope = &gophercloud.AuthScope{ProjectName: *settings.ProjectName}
+			if settings.ProjectDomainID != nil {
+				auth.Scope.DomainID = *settings.ProjectDomainID
+			}
+			if settings.ProjectDomainName != nil {
+				auth.Scope.DomainName = *settings.ProjectDomainName
+			}
 		}
 	}
 
-	//
-	// IMPORTANT NOTE: when using App Credentials, it is necessary
-	// that all other fields except the endpoint URL be left blank!
-	//
-
-	client, err := openstack.AuthenticatedClient(auth)
+	client, err := openstack.NewClient(auth.IdentityEndpoint)
+	if err != nil {
+		logger(ctx).Error("error creating provider client", "error", err)
+		return nil, err
+	}
+	client.HTTPClient, err = newHTTPClient(settings)
 	if err != nil {
-		plugin.Logger(ctx).Error("error creating authenticated client", "error", err)
+		logger(ctx).Error("error creating HTTP client", "error", err)
+		return nil, err
+	}
+	client.UserAgent.Prepend(userAgent(settings)...)
+	retries, err := newRetryPolicy(settings)
+	if err != nil {
+		logger(ctx).Error("invalid retry settings", "error", err)
+		return nil, err
+	}
+	retries.apply(ctx, client)
+	if err = openstack.Authenticate(client, auth); err != nil {
+		logger(ctx).Error("error creating authenticated client", "error", err)
+		return nil, err
+	}
+	registerSecrets(client.Token())
+	if err = setEndpointOverrides(ctx, client, settings); err != nil {
+		logger(ctx).Error("error applying endpoint overrides", "error", err)
 		return nil, err
 	}
+	if reauth := client.ReauthFunc; reauth != nil {
+		// make sure renewed tokens never end up in the logs either
+		client.ReauthFunc = func() error {
+			err := reauth()
+			registerSecrets(client.Token())
+			return err
+		}
+	}
 
 	// save to cache
-	plugin.Logger(ctx).Debug("saving authenticated client to cache")
+	logger(ctx).Debug("saving authenticated client to cache")
 	d.ConnectionManager.Cache.Set(AuthenticatedClient, client)
 
 	return client, nil
 }
+
+// toAvailability converts an endpoint interface name, as used in clouds.yaml
+// and in the OS_INTERFACE variable, into a gophercloud endpoint availability.
+func toAvailability(value string) (gophercloud.Availability, error) {
+	switch strings.TrimSuffix(strings.ToLower(value), "url") {
+	case "public":
+		return gophercloud.AvailabilityPublic, nil
+	case "internal":
+		return gophercloud.AvailabilityInternal, nil
+	case "admin":
+		return gophercloud.AvailabilityAdmin, nil
+	default:
+		return "", fmt.Errorf("invalid endpoint interface %q: must be one of public, internal or admin", value)
+	}
+}
+
+// setEndpointOverrides wraps the provider client's endpoint locator so that
+// the services listed in the endpoint_override option use the given URL
+// instead of the one in the Keystone catalog, in the given region or, if
+// none, in any region; the "%(project_id)s" and "$(project_id)s"
+// placeholders in the URL are replaced with the ID of the project the token
+// is scoped to, as Keystone does for catalog entries.
+func setEndpointOverrides(ctx context.Context, client *gophercloud.ProviderClient, settings *connectionSettings) error {
+	overrides, err := parseEndpointOverrides(settings.EndpointOverride, settings.Regions)
+	if err != nil || len(overrides) == 0 {
+		return err
+	}
+
+	projectID := ""
+	if result, ok := client.GetAuthResult().(authResult); ok {
+		if project, err := result.ExtractProject(); err == nil && project != nil {
+			projectID = project.ID
+		}
+	}
+	if projectID == "" && settings.ProjectID != nil {
+		projectID = *settings.ProjectID
+	}
+	for key, url := range overrides {
+		url = strings.NewReplacer("%(project_id)s", projectID, "$(project_id)s", projectID).Replace(url)
+		overrides[key] = gophercloud.NormalizeURL(url)
+		logger(ctx).Info("overriding catalog endpoint", "type", key.catalogType, "region", key.region, "url", overrides[key])
+	}
+
+	locator := client.EndpointLocator
+	client.EndpointLocator = func(opts gophercloud.EndpointOpts) (string, error) {
+		if url, ok := overrides[endpointOverride{opts.Type, opts.Region}]; ok {
+			return url, nil
+		}
+		if url, ok := overrides[endpointOverride{catalogType: opts.Type}]; ok {
+			return url, nil
+		}
+		return locator(opts)
+	}
+	return nil
+}
+
+// endpointOverride identifies the endpoint replaced by an entry of the
+// endpoint_override option: the Keystone catalog type of the service and
+// the region, which is empty if the entry applies in any region.
+type endpointOverride struct {
+	catalogType string
+	region      string
+}
+
+// parseEndpointOverrides parses the "<service type>[:<region>]=<url>"
+// entries of the endpoint_override option into a map from the endpoint they
+// replace to the URL. Entries without a region are rejected if the service
+// may be queried in more than one region, where the same endpoint would
+// return the same resources once per region.
+func parseEndpointOverrides(values *[]string, regions *[]string) (map[endpointOverride]string, error) {
+	overrides := map[endpointOverride]string{}
+	if values == nil {
+		return overrides, nil
+	}
+	for _, value := range *values {
+		key, url, ok := strings.Cut(value, "=")
+		key, url = strings.TrimSpace(key), strings.TrimSpace(url)
+		if !ok || url == "" {
+			return nil, fmt.Errorf("invalid endpoint override %q: expected \"<service type>[:<region>]=<url>\"", value)
+		}
+		key, region, _ := strings.Cut(key, ":")
+		key, region = strings.TrimSpace(key), strings.TrimSpace(region)
+		service, ok := serviceConfigMap[ServiceType(key)]
+		if !ok {
+			return nil, fmt.Errorf("invalid service type %q in endpoint override", key)
+		}
+		if region == "" && ServiceType(key) != IdentityV3 && spansRegions(regions) {
+			return nil, fmt.Errorf("invalid endpoint override %q: the connection spans several regions, so the region must be set as in \"%s:<region>=<url>\"", value, key)
+		}
+		overrides[endpointOverride{service.catalogType, region}] = url
+	}
+	return overrides, nil
+}
+
+// spansRegions returns whether the regions option may query the services
+// in more than one region.
+func spansRegions(regions *[]string) bool {
+	if regions == nil {
+		return false
+	}
+	for _, region := range *regions {
+		if region == allRegions {
+			return true
+		}
+	}
+	return len(dedupRegions(*regions)) > 1
+}
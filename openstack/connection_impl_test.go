@@ -0,0 +1,84 @@
+package openstack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/hashicorp/go-hclog"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/context_key"
+)
+
+// testContext returns a context carrying a logger, as the plugin SDK does.
+func testContext() context.Context {
+	return context.WithValue(context.Background(), context_key.Logger, hclog.NewNullLogger())
+}
+
+func TestSetEndpointOverrides(t *testing.T) {
+	client := &gophercloud.ProviderClient{
+		EndpointLocator: func(opts gophercloud.EndpointOpts) (string, error) {
+			return "https://catalog.example.com/" + opts.Type + "/", nil
+		},
+	}
+	settings := &connectionSettings{
+		openstackConfig: openstackConfig{
+			ProjectID: utils.PointerTo("0123456789"),
+			Regions:   &[]string{"RegionOne", "RegionTwo"},
+			EndpointOverride: &[]string{
+				"openstack_blockstorage_v3:RegionOne=https://cinder.example.com:8776/v3/%(project_id)s",
+				"openstack_network_v2 : RegionTwo = https://neutron.example.com:9696",
+				"openstack_identity_v3=https://keystone.example.com:5000/v3",
+			},
+		},
+	}
+	if err := setEndpointOverrides(testContext(), client, settings); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		catalogType string
+		region      string
+		url         string
+	}{
+		{"volumev3", "RegionOne", "https://cinder.example.com:8776/v3/0123456789/"},
+		{"volumev3", "RegionTwo", "https://catalog.example.com/volumev3/"},
+		{"network", "RegionOne", "https://catalog.example.com/network/"},
+		{"network", "RegionTwo", "https://neutron.example.com:9696/"},
+		{"identity", "RegionOne", "https://keystone.example.com:5000/v3/"},
+		{"compute", "RegionOne", "https://catalog.example.com/compute/"},
+	}
+	for _, test := range expected {
+		url, err := client.EndpointLocator(gophercloud.EndpointOpts{Type: test.catalogType, Region: test.region})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url != test.url {
+			t.Errorf("%s in %s: expected %q, got %q", test.catalogType, test.region, test.url, url)
+		}
+	}
+
+	for _, value := range []string{"openstack_dns_v2=https://designate.example.com", "openstack_compute_v2"} {
+		if _, err := parseEndpointOverrides(&[]string{value}, nil); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+	// an override in any region would return the same resources once per
+	// region, unless the connection is limited to one
+	value := "openstack_compute_v2=https://nova.example.com:8774/v2.1"
+	for _, regions := range [][]string{{"RegionOne", "RegionTwo"}, {"*"}} {
+		regions := regions
+		if _, err := parseEndpointOverrides(&[]string{value}, &regions); err == nil {
+			t.Errorf("expected error for %q in regions %v", value, regions)
+		}
+	}
+	for _, regions := range [][]string{{"RegionOne"}, {"RegionOne", "RegionOne"}} {
+		regions := regions
+		if _, err := parseEndpointOverrides(&[]string{value}, &regions); err != nil {
+			t.Errorf("unexpected error for %q in regions %v: %v", value, regions, err)
+		}
+	}
+	if _, err := resolveConnectionSettings(openstackConfig{Interface: utils.PointerTo("private")}, noEnvironment); err == nil {
+		t.Errorf("expected error for invalid interface")
+	}
+}
@@ -0,0 +1,165 @@
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/utils"
+)
+
+// apiVersion is an entry in the version document of an OpenStack service;
+// services with microversions report the range they support in Version and
+// MinVersion, the others (e.g. Keystone and Glance) only report their ID and
+// are never negotiated with (see serviceConfig).
+type apiVersion struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	Version    string `json:"version"`
+	MinVersion string `json:"min_version"`
+}
+
+// apiVersionDocument is the version document of an OpenStack service; it
+// can hold a single version (as returned by the versioned endpoint, e.g.
+// /v2.1 in Nova) or the list of the available versions (as returned by the
+// root of the endpoint), which Keystone wraps in a "values" object.
+type apiVersionDocument struct {
+	Version  *apiVersion     `json:"version"`
+	Versions json.RawMessage `json:"versions"`
+}
+
+// entries returns all the versions in the document.
+func (d *apiVersionDocument) entries() []apiVersion {
+	entries := []apiVersion{}
+	if d.Version != nil {
+		entries = append(entries, *d.Version)
+	}
+	if len(d.Versions) > 0 {
+		list := []apiVersion{}
+		if err := json.Unmarshal(d.Versions, &list); err != nil {
+			values := struct {
+				Values []apiVersion `json:"values"`
+			}{}
+			if err := json.Unmarshal(d.Versions, &values); err == nil {
+				list = values.Values
+			}
+		}
+		entries = append(entries, list...)
+	}
+	return entries
+}
+
+// getSupportedMicroversions returns the range of microversions supported by
+// the cloud for the given service, among those with the given major version;
+// the versioned endpoint is queried first and then the root of the endpoint.
+func getSupportedMicroversions(ctx context.Context, client *gophercloud.ServiceClient, major int) (string, string, error) {
+	urls := []string{client.ServiceURL("")}
+	if base, err := utils.BaseEndpoint(client.Endpoint); err == nil && base != urls[0] {
+		urls = append(urls, base)
+	}
+
+	var lastErr error
+	for _, url := range urls {
+		document := &apiVersionDocument{}
+		_, err := client.Get(url, document, &gophercloud.RequestOpts{
+			OkCodes: []int{200, 300},
+		})
+		if err != nil {
+			logger(ctx).Debug("error retrieving version document", "url", url, "error", err)
+			lastErr = err
+			continue
+		}
+		if min, max := microversionRange(document.entries(), major); max != "" {
+			logger(ctx).Debug("version document retrieved", "url", url, "min", min, "max", max)
+			return min, max, nil
+		}
+		lastErr = fmt.Errorf("no version %d.x in version document at %q", major, url)
+	}
+	return "", "", lastErr
+}
+
+// microversionRange returns the lowest and the highest microversions among
+// the given versions having the given major version; for versions that do
+// not report a microversion range, the version ID is used instead.
+func microversionRange(entries []apiVersion, major int) (string, string) {
+	min, max := "", ""
+	for _, entry := range entries {
+		id := strings.TrimPrefix(entry.ID, "v")
+		if m, _, err := parseMicroversion(id); err != nil || m != major {
+			continue
+		}
+		low, high := entry.MinVersion, entry.Version
+		if low == "" {
+			low = id
+		}
+		if high == "" {
+			high = id
+		}
+		if min == "" || compareMicroversions(low, min) < 0 {
+			min = low
+		}
+		if max == "" || compareMicroversions(high, max) > 0 {
+			max = high
+		}
+	}
+	return min, max
+}
+
+// negotiateMicroversion returns the highest microversion supported both by
+// the cloud (in the min..max range) and by the plugin (up to maximum).
+func negotiateMicroversion(min string, max string, maximum string) (string, error) {
+	if compareMicroversions(maximum, min) < 0 {
+		return "", fmt.Errorf("microversion %s is not supported by the cloud, which requires at least %s", maximum, min)
+	}
+	if compareMicroversions(maximum, max) > 0 {
+		return max, nil
+	}
+	return maximum, nil
+}
+
+// supportsMicroversion returns whether the microversion negotiated for the
+// given service client is at least the given one; fields introduced in newer
+// microversions are not returned by older clouds and must be left NULL.
+func supportsMicroversion(client *gophercloud.ServiceClient, microversion string) bool {
+	return client.Microversion != "" && compareMicroversions(client.Microversion, microversion) >= 0
+}
+
+// parseMicroversion splits a microversion in the "X.Y" form into its major
+// and minor parts; a missing minor part is read as 0.
+func parseMicroversion(microversion string) (int, int, error) {
+	parts := strings.SplitN(strings.TrimSpace(microversion), ".", 2)
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid microversion %q", microversion)
+	}
+	minor := 0
+	if len(parts) == 2 {
+		if minor, err = strconv.Atoi(parts[1]); err != nil {
+			return 0, 0, fmt.Errorf("invalid microversion %q", microversion)
+		}
+	}
+	return major, minor, nil
+}
+
+// compareMicroversions returns -1, 0 or 1 depending on whether a is lower
+// than, equal to or higher than b; invalid microversions compare as 0.0.
+func compareMicroversions(a string, b string) int {
+	aMajor, aMinor, _ := parseMicroversion(a)
+	bMajor, bMinor, _ := parseMicroversion(b)
+	switch {
+	case aMajor != bMajor:
+		if aMajor < bMajor {
+			return -1
+		}
+		return 1
+	case aMinor != bMinor:
+		if aMinor < bMinor {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
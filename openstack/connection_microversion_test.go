@@ -0,0 +1,106 @@
+package openstack
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+const testCinderVersions = `{
+  "versions": [
+    {"id": "v2.0", "status": "DEPRECATED", "version": "", "min_version": ""},
+    {"id": "v3.0", "status": "CURRENT", "version": "3.44", "min_version": "3.0"}
+  ]
+}`
+
+const testKeystoneVersions = `{
+  "versions": {
+    "values": [
+      {"id": "v3.14", "status": "stable"}
+    ]
+  }
+}`
+
+func TestGetMicroversion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			// versioned endpoints with the project ID have no version document
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultipleChoices)
+		w.Write([]byte(testCinderVersions))
+	}))
+	defer server.Close()
+
+	client := &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{HTTPClient: *server.Client()},
+		Endpoint:       server.URL + "/v3/0123456789/",
+		Type:           "volumev3",
+	}
+
+	tests := []struct {
+		maximum string
+		want    string
+	}{
+		{DefaultBlockStorageV3Microversion, "3.44"},
+		{"3.40", "3.40"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		microversion, err := getMicroversion(testContext(), client, test.maximum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if microversion != test.want {
+			t.Errorf("maximum %q: expected %q, got %q", test.maximum, test.want, microversion)
+		}
+	}
+
+	client.Microversion = "3.44"
+	if supportsMicroversion(client, "3.47") {
+		t.Errorf("microversion 3.47 should not be supported")
+	}
+	client.Microversion = "3.59"
+	if !supportsMicroversion(client, "3.47") {
+		t.Errorf("microversion 3.47 should be supported")
+	}
+}
+
+func TestMicroversionRange(t *testing.T) {
+	document := &apiVersionDocument{}
+	if err := json.Unmarshal([]byte(testKeystoneVersions), document); err != nil {
+		t.Fatal(err)
+	}
+	if min, max := microversionRange(document.entries(), 3); min != "3.14" || max != "3.14" {
+		t.Errorf("unexpected keystone range: %s-%s", min, max)
+	}
+
+	if _, err := negotiateMicroversion("3.50", "3.60", "3.47"); err == nil {
+		t.Errorf("expected error when the cloud requires a newer microversion")
+	}
+	if compareMicroversions("2.9", "2.10") >= 0 || compareMicroversions("3.0", "2.79") <= 0 {
+		t.Errorf("microversions must be compared numerically")
+	}
+}
+
+func TestMicroversionNotNegotiatedWithoutRange(t *testing.T) {
+	cloud := newFakeCloud(t)
+	// Keystone reports v3.14, above the default identity microversion, and
+	// Glance v2.9, neither with a range to negotiate within
+	for _, table := range []string{"openstack_project", "openstack_image"} {
+		rows := testQuery{table: testTable(table), config: testConfig(cloud), columns: []string{"id", "name"}}.run(t)
+		if len(rows) == 0 {
+			t.Errorf("no rows returned from %s", table)
+		}
+	}
+	for _, request := range cloud.requested("GET ") {
+		if request == "GET /identity/v3/" || request == "GET /image/" || request == "GET /image/v2/" {
+			t.Errorf("unexpected version document request %s", request)
+		}
+	}
+}
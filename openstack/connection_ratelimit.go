@@ -0,0 +1,145 @@
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket limiting the rate of the requests to a
+// service endpoint: the bucket holds up to burst tokens and is refilled
+// at rate tokens per second; each request takes a token, waiting for it if
+// the bucket is empty.
+type rateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter creates a rate limiter allowing the given number of
+// requests per second, with bursts of up to one second worth of requests.
+func newRateLimiter(rate float64) *rateLimiter {
+	burst := math.Max(1, math.Ceil(rate))
+	return &rateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request can be made, or the context is done.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay == 0 {
+			return nil
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token if available and returns 0, otherwise it returns
+// how long to wait for the next token.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// rateLimitTransport applies the rate limiter of the service endpoint each
+// request is addressed to; requests to other URLs (e.g. authentication) are
+// not limited. Limiters are registered as service clients are created.
+type rateLimitTransport struct {
+	mutex    sync.RWMutex
+	limiters map[string]*rateLimiter
+	next     http.RoundTripper
+}
+
+// register sets the rate limiter for all the requests whose URL starts
+// with the given endpoint.
+func (t *rateLimitTransport) register(endpoint string, limiter *rateLimiter) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.limiters == nil {
+		t.limiters = map[string]*rateLimiter{}
+	}
+	t.limiters[endpoint] = limiter
+}
+
+// limiter returns the rate limiter of the longest endpoint matching the URL.
+func (t *rateLimitTransport) limiter(url string) *rateLimiter {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	var limiter *rateLimiter
+	match := 0
+	for endpoint, l := range t.limiters {
+		if len(endpoint) > match && strings.HasPrefix(url, endpoint) {
+			limiter, match = l, len(endpoint)
+		}
+	}
+	return limiter
+}
+
+func (t *rateLimitTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if limiter := t.limiter(request.URL.String()); limiter != nil {
+		if err := limiter.Wait(request.Context()); err != nil {
+			return nil, err
+		}
+	}
+	return t.next.RoundTrip(request)
+}
+
+// getRateLimit returns the maximum number of requests per second to the
+// given service, as per the rate_limits option (falling back to rate_limit);
+// 0 means unlimited.
+func getRateLimit(settings *connectionSettings, key ServiceType) (float64, error) {
+	rate := 0.0
+	if settings.RateLimit != nil {
+		rate = *settings.RateLimit
+	}
+	if settings.RateLimits != nil {
+		for _, value := range *settings.RateLimits {
+			name, limit, ok := strings.Cut(value, "=")
+			name = strings.TrimSpace(name)
+			if !ok {
+				return 0, fmt.Errorf("invalid rate limit %q: expected \"<service type>=<requests per second>\"", value)
+			}
+			if _, ok := serviceConfigMap[ServiceType(name)]; !ok {
+				return 0, fmt.Errorf("invalid service type %q in rate limit", name)
+			}
+			if ServiceType(name) != key {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(limit), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid rate limit %q: %w", value, err)
+			}
+			rate = parsed
+		}
+	}
+	if rate < 0 {
+		return 0, fmt.Errorf("invalid rate limit %g for %s: must not be negative", rate, key)
+	}
+	return rate, nil
+}
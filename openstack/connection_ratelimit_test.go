@@ -0,0 +1,52 @@
+package openstack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(100)
+	start := time.Now()
+	for i := 0; i < 150; i++ {
+		if err := limiter.Wait(testContext()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first 100 requests are a burst, the other 50 take about 500ms
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("requests not rate limited: %s", elapsed)
+	}
+
+	transport := &rateLimitTransport{}
+	compute := newRateLimiter(1)
+	transport.register("https://nova.example.com/", newRateLimiter(1))
+	transport.register("https://nova.example.com/v2.1/", compute)
+	if transport.limiter("https://nova.example.com/v2.1/servers") != compute {
+		t.Errorf("longest matching endpoint not selected")
+	}
+	if transport.limiter("https://keystone.example.com/v3/auth/tokens") != nil {
+		t.Errorf("unexpected rate limiter for unregistered endpoint")
+	}
+}
+
+func TestGetRateLimit(t *testing.T) {
+	settings := &connectionSettings{
+		openstackConfig: openstackConfig{
+			RateLimit:  utils.PointerTo(10.0),
+			RateLimits: &[]string{"openstack_compute_v2=2.5"},
+		},
+	}
+	if rate, err := getRateLimit(settings, ComputeV2); err != nil || rate != 2.5 {
+		t.Errorf("unexpected compute rate limit: %g (%v)", rate, err)
+	}
+	if rate, err := getRateLimit(settings, NetworkV2); err != nil || rate != 10 {
+		t.Errorf("unexpected network rate limit: %g (%v)", rate, err)
+	}
+	settings.RateLimits = &[]string{"nova=1"}
+	if _, err := getRateLimit(settings, ComputeV2); err == nil {
+		t.Errorf("expected error for unknown service type")
+	}
+}
@@ -0,0 +1,195 @@
+package openstack
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+const (
+	// CatalogRegions is the cache key for the regions in the service catalog.
+	CatalogRegions = "openstack_catalog_regions"
+
+	// allRegions is the value of the regions option that stands for all the
+	// regions in the service catalog.
+	allRegions = "*"
+)
+
+var errUnknownAuthResult = errors.New("no service catalog available for the authenticated client")
+
+// authResult is implemented by the results of both token creation and token
+// validation, one of which is stored as the provider client's auth result
+// depending on how the plugin authenticated.
+type authResult interface {
+	ExtractProject() (*tokens.Project, error)
+	ExtractUser() (*tokens.User, error)
+	ExtractServiceCatalog() (*tokens.ServiceCatalog, error)
+}
+
+// regionMatrix returns a function that builds the query matrix with one
+// item per region the given service is queried in; the SDK then runs the
+// List calls of the table in parallel, once per region.
+func regionMatrix(key ServiceType) plugin.MatrixItemMapFunc {
+	return func(ctx context.Context, d *plugin.QueryData) []map[string]interface{} {
+		regions, err := getServiceRegions(ctx, d, key)
+		if err != nil {
+			// let the List call surface the error
+			logger(ctx).Error("error retrieving regions", "type", key, "error", err)
+			regions = []string{""}
+		}
+		matrix := make([]map[string]interface{}, 0, len(regions))
+		for _, region := range regions {
+			matrix = append(matrix, map[string]interface{}{"region": region})
+		}
+		return matrix
+	}
+}
+
+// getServiceRegions returns the regions the given service is queried in:
+// the identity service is global and is only queried in one region, the
+// other services in each region in the regions option (or in the region
+// option if the former is unset); if regions is "*", the regions are those
+// where the service has an endpoint in the service catalog.
+func getServiceRegions(ctx context.Context, d *plugin.QueryData, key ServiceType) ([]string, error) {
+	settings, err := getConnectionSettings(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	if key == IdentityV3 {
+		return []string{identityRegion(settings)}, nil
+	}
+	if settings.Regions == nil || len(*settings.Regions) == 0 {
+		region := ""
+		if settings.Region != nil {
+			region = *settings.Region
+		}
+		return []string{region}, nil
+	}
+
+	regions := []string{}
+	for _, region := range *settings.Regions {
+		if region != allRegions {
+			regions = append(regions, region)
+			continue
+		}
+		catalog, err := getCatalogRegions(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		regions = append(regions, catalog[serviceConfigMap[key].catalogType]...)
+	}
+	return dedupRegions(regions), nil
+}
+
+// identityRegion returns the region of the identity endpoint, which is the
+// one in the region option, or the first explicit entry in regions; when
+// empty, the first identity endpoint in the catalog is used.
+func identityRegion(settings *connectionSettings) string {
+	if settings.Region != nil {
+		return *settings.Region
+	}
+	if settings.Regions != nil {
+		for _, region := range *settings.Regions {
+			if region != allRegions {
+				return region
+			}
+		}
+	}
+	return ""
+}
+
+// getCatalogRegions returns, for each service type in the catalog of the
+// current token, the sorted list of the regions where it has an endpoint
+// with the configured interface.
+func getCatalogRegions(ctx context.Context, d *plugin.QueryData) (map[string][]string, error) {
+	if cachedData, ok := d.ConnectionManager.Cache.Get(CatalogRegions); ok {
+		return cachedData.(map[string][]string), nil
+	}
+
+	client, err := getAuthenticatedClient(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := getConnectionSettings(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	availability := gophercloud.AvailabilityPublic
+	if settings.Interface != nil {
+		if availability, err = toAvailability(*settings.Interface); err != nil {
+			return nil, err
+		}
+	}
+
+	result, ok := client.GetAuthResult().(authResult)
+	if !ok {
+		return nil, errUnknownAuthResult
+	}
+	catalog, err := result.ExtractServiceCatalog()
+	if err != nil {
+		return nil, err
+	}
+	regions := regionsByServiceType(catalog, availability)
+	logger(ctx).Debug("regions found in catalog", "regions", toRedactedJSON(regions))
+
+	d.ConnectionManager.Cache.Set(CatalogRegions, regions)
+	return regions, nil
+}
+
+// regionsByServiceType returns, for each service type in the catalog, the
+// sorted list of the regions where it has an endpoint with the given
+// availability.
+func regionsByServiceType(catalog *tokens.ServiceCatalog, availability gophercloud.Availability) map[string][]string {
+	regions := map[string][]string{}
+	for _, entry := range catalog.Entries {
+		for _, endpoint := range entry.Endpoints {
+			if endpoint.Interface != string(availability) {
+				continue
+			}
+			region := endpoint.RegionID
+			if region == "" {
+				region = endpoint.Region
+			}
+			regions[entry.Type] = append(regions[entry.Type], region)
+		}
+	}
+	for catalogType := range regions {
+		regions[catalogType] = dedupRegions(regions[catalogType])
+		sort.Strings(regions[catalogType])
+	}
+	return regions
+}
+
+// dedupRegions removes the duplicates from the given list of regions,
+// preserving their order.
+func dedupRegions(regions []string) []string {
+	seen := map[string]struct{}{}
+	result := []string{}
+	for _, region := range regions {
+		if _, ok := seen[region]; !ok {
+			seen[region] = struct{}{}
+			result = append(result, region)
+		}
+	}
+	return result
+}
+
+// getQueryRegion returns the region the current hydrate call refers to,
+// which is the one in the matrix item for the given service; the identity
+// service is always queried in the identity region.
+func getQueryRegion(ctx context.Context, settings *connectionSettings, key ServiceType) string {
+	if key != IdentityV3 {
+		if region, ok := plugin.GetMatrixItem(ctx)["region"].(string); ok {
+			return region
+		}
+		if settings.Region != nil {
+			return *settings.Region
+		}
+		return ""
+	}
+	return identityRegion(settings)
+}
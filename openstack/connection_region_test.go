@@ -0,0 +1,60 @@
+package openstack
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+)
+
+func TestRegionsByServiceType(t *testing.T) {
+	catalog := &tokens.ServiceCatalog{
+		Entries: []tokens.CatalogEntry{
+			{
+				Type: "compute",
+				Endpoints: []tokens.Endpoint{
+					{RegionID: "RegionTwo", Interface: "public"},
+					{RegionID: "RegionOne", Interface: "public"},
+					{RegionID: "RegionOne", Interface: "internal"},
+					{Region: "RegionThree", Interface: "internal"},
+				},
+			},
+			{
+				Type: "volumev3",
+				Endpoints: []tokens.Endpoint{
+					{RegionID: "RegionOne", Interface: "public"},
+				},
+			},
+		},
+	}
+
+	expected := map[string][]string{
+		"compute":  {"RegionOne", "RegionTwo"},
+		"volumev3": {"RegionOne"},
+	}
+	if regions := regionsByServiceType(catalog, gophercloud.AvailabilityPublic); !reflect.DeepEqual(regions, expected) {
+		t.Errorf("unexpected public regions: %v", regions)
+	}
+	if regions := regionsByServiceType(catalog, gophercloud.AvailabilityInternal); !reflect.DeepEqual(regions["compute"], []string{"RegionOne", "RegionThree"}) {
+		t.Errorf("unexpected internal regions: %v", regions)
+	}
+}
+
+func TestIdentityRegion(t *testing.T) {
+	tests := []struct {
+		config openstackConfig
+		want   string
+	}{
+		{openstackConfig{}, ""},
+		{openstackConfig{Regions: &[]string{"*"}}, ""},
+		{openstackConfig{Regions: &[]string{"*", "RegionTwo"}}, "RegionTwo"},
+		{openstackConfig{Region: utils.PointerTo("RegionOne"), Regions: &[]string{"RegionTwo"}}, "RegionOne"},
+	}
+	for _, test := range tests {
+		if region := identityRegion(&connectionSettings{openstackConfig: test.config}); region != test.want {
+			t.Errorf("expected %q, got %q", test.want, region)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package openstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+const (
+	// DefaultMaxRetries is the default number of retries of a failed request.
+	DefaultMaxRetries = 5
+	// DefaultMinRetryDelay is the default base delay of the exponential backoff.
+	DefaultMinRetryDelay = 500 * time.Millisecond
+	// DefaultMaxRetryDelay is the default maximum delay between two retries.
+	DefaultMaxRetryDelay = 30 * time.Second
+)
+
+// retryPolicy decides whether and when failed requests are retried; only
+// idempotent (GET) requests failing with a transient error (a transport
+// error, 429 Too Many Requests, 502 Bad Gateway, 503 Service Unavailable or
+// 504 Gateway Timeout) are retried, with exponential backoff and full
+// jitter, unless the server asks for a specific delay with Retry-After.
+type retryPolicy struct {
+	maxRetries uint
+	minDelay   time.Duration
+	maxDelay   time.Duration
+}
+
+// newRetryPolicy creates the retry policy for the connection.
+func newRetryPolicy(settings *connectionSettings) (*retryPolicy, error) {
+	policy := &retryPolicy{
+		maxRetries: DefaultMaxRetries,
+		minDelay:   DefaultMinRetryDelay,
+		maxDelay:   DefaultMaxRetryDelay,
+	}
+	if settings.MaxRetries != nil {
+		if *settings.MaxRetries < 0 {
+			return nil, fmt.Errorf("invalid max_retries %d: must not be negative", *settings.MaxRetries)
+		}
+		policy.maxRetries = uint(*settings.MaxRetries)
+	}
+	for _, option := range []struct {
+		name  string
+		value *string
+		field *time.Duration
+	}{
+		{"min_retry_delay", settings.MinRetryDelay, &policy.minDelay},
+		{"max_retry_delay", settings.MaxRetryDelay, &policy.maxDelay},
+	} {
+		if option.value == nil {
+			continue
+		}
+		delay, err := time.ParseDuration(*option.value)
+		if err != nil || delay <= 0 {
+			return nil, fmt.Errorf("invalid %s %q: must be a positive duration", option.name, *option.value)
+		}
+		*option.field = delay
+	}
+	if policy.maxDelay < policy.minDelay {
+		return nil, fmt.Errorf("max_retry_delay (%s) must not be lower than min_retry_delay (%s)", policy.maxDelay, policy.minDelay)
+	}
+	return policy, nil
+}
+
+// apply installs the retry policy on the provider client: rate limiting
+// responses (429) go through the backoff function, all other failures
+// through the generic retry function. Both wait on the context of the
+// client, which getServiceClient binds to the query.
+func (p *retryPolicy) apply(ctx context.Context, client *gophercloud.ProviderClient) {
+	log := logger(ctx)
+	// gophercloud takes 0 for its own default (60), so the backoff function
+	// enforces the limit itself
+	client.MaxBackoffRetries = p.maxRetries
+	client.RetryBackoffFunc = func(ctx context.Context, response *gophercloud.ErrUnexpectedResponseCode, err error, retries uint) error {
+		if response.Method != http.MethodGet || retries > p.maxRetries {
+			return err
+		}
+		delay := p.delay(retries, response.ResponseHeader)
+		log.Warn("request rate limited, retrying", "url", response.URL, "attempt", retries, "delay", delay.String())
+		return sleep(ctx, delay, err)
+	}
+	client.RetryFunc = func(ctx context.Context, method string, url string, options *gophercloud.RequestOpts, err error, failCount uint) error {
+		if method != http.MethodGet || failCount > p.maxRetries || !isRetryableError(err) {
+			return err
+		}
+		var header http.Header
+		if response, ok := responseError(err); ok {
+			header = response.ResponseHeader
+		}
+		delay := p.delay(failCount, header)
+		log.Warn("request failed, retrying", "url", url, "attempt", failCount, "delay", delay.String(), "error", err)
+		return sleep(ctx, delay, err)
+	}
+}
+
+// delay returns how long to wait before the given retry: the delay in the
+// Retry-After header if present, otherwise a random delay up to the
+// exponential backoff for the attempt; it never exceeds the maximum delay.
+func (p *retryPolicy) delay(attempt uint, header http.Header) time.Duration {
+	if delay, ok := retryAfter(header); ok {
+		if delay > p.maxDelay {
+			return p.maxDelay
+		}
+		return delay
+	}
+	backoff := p.maxDelay
+	if attempt > 0 && attempt <= 32 {
+		if exponential := p.minDelay << (attempt - 1); exponential > 0 && exponential < p.maxDelay {
+			backoff = exponential
+		}
+	}
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+// shouldRetryError is used as the SDK retry predicate for Get and column
+// hydrate functions; transient errors that persist after the HTTP client
+// retries get a further chance at the hydrate level.
+func shouldRetryError(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData, err error) bool {
+	if isRetryableError(err) {
+		logger(ctx).Warn("transient error in hydrate function, retrying", "table", d.Table.Name, "error", err)
+		return true
+	}
+	return false
+}
+
+// isRetryableError returns whether the error is transient.
+func isRetryableError(err error) bool {
+	switch err.(type) {
+	case gophercloud.ErrDefault429, gophercloud.ErrDefault502, gophercloud.ErrDefault503, gophercloud.ErrDefault504:
+		return true
+	}
+	if response, ok := responseError(err); ok {
+		switch response.Actual {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var transportErr *url.Error
+	if errors.As(err, &transportErr) {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, errNotRecorded)
+	}
+	return false
+}
+
+// responseError extracts the HTTP response details from a gophercloud error.
+func responseError(err error) (gophercloud.ErrUnexpectedResponseCode, bool) {
+	switch err := err.(type) {
+	case gophercloud.ErrUnexpectedResponseCode:
+		return err, true
+	case gophercloud.ErrDefault429:
+		return err.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault500:
+		return err.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault502:
+		return err.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault503:
+		return err.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault504:
+		return err.ErrUnexpectedResponseCode, true
+	}
+	return gophercloud.ErrUnexpectedResponseCode{}, false
+}
+
+// retryAfter parses the Retry-After header, which holds either a number of
+// seconds or an HTTP date.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleep waits for the given delay; if the context is done in the meantime,
+// the original error is returned so that the request is not retried.
+func sleep(ctx context.Context, delay time.Duration, err error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return err
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,142 @@
+package openstack
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+	"github.com/gophercloud/gophercloud"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"result": "ok"}`))
+		}
+	}))
+	defer server.Close()
+
+	policy, err := newRetryPolicy(&connectionSettings{
+		openstackConfig: openstackConfig{
+			MinRetryDelay: utils.PointerTo("1ms"),
+			MaxRetryDelay: utils.PointerTo("10ms"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &gophercloud.ProviderClient{HTTPClient: *server.Client()}
+	policy.apply(testContext(), client)
+
+	result := map[string]string{}
+	if _, err := client.Request(http.MethodGet, server.URL, &gophercloud.RequestOpts{JSONResponse: &result}); err != nil {
+		t.Fatal(err)
+	}
+	if result["result"] != "ok" || atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("expected success after 3 requests, got %d", requests)
+	}
+
+	// non-idempotent requests are never retried
+	atomic.StoreInt32(&requests, 0)
+	if _, err := client.Request(http.MethodPost, server.URL, &gophercloud.RequestOpts{JSONBody: map[string]string{}}); err == nil {
+		t.Errorf("expected error for POST request")
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("POST request retried")
+	}
+}
+
+func TestRetryPolicyDisabled(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	policy, err := newRetryPolicy(&connectionSettings{
+		openstackConfig: openstackConfig{
+			MaxRetries: utils.PointerTo(0),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &gophercloud.ProviderClient{HTTPClient: *server.Client()}
+	policy.apply(testContext(), client)
+
+	if _, err := client.Request(http.MethodGet, server.URL, &gophercloud.RequestOpts{JSONResponse: &map[string]string{}}); err == nil {
+		t.Errorf("expected error for rate limited request")
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("expected 1 request with retries disabled, got %d", requests)
+	}
+}
+
+func TestRetryPolicyCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	policy, err := newRetryPolicy(&connectionSettings{
+		openstackConfig: openstackConfig{
+			MaxRetryDelay: utils.PointerTo("1m"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &gophercloud.ProviderClient{HTTPClient: *server.Client()}
+	policy.apply(testContext(), provider)
+	client := &gophercloud.ServiceClient{ProviderClient: provider, Endpoint: server.URL + "/"}
+
+	// the backoff stops as soon as the query is cancelled
+	ctx, cancel := context.WithTimeout(testContext(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := withContext(ctx, client).Get(client.ServiceURL("servers"), &map[string]string{}, nil); err == nil {
+		t.Errorf("expected error for cancelled request")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("backoff not interrupted by cancellation, took %s", elapsed)
+	}
+	if provider.Context != nil {
+		t.Errorf("cached client bound to the query context")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := &retryPolicy{maxRetries: 5, minDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	for attempt := uint(1); attempt <= 10; attempt++ {
+		if delay := policy.delay(attempt, nil); delay <= 0 || delay > time.Second {
+			t.Errorf("attempt %d: delay %s out of range", attempt, delay)
+		}
+	}
+	header := http.Header{}
+	header.Set("Retry-After", "60")
+	if delay := policy.delay(1, header); delay != time.Second {
+		t.Errorf("Retry-After must be capped at the maximum delay, got %s", delay)
+	}
+	header.Set("Retry-After", "0")
+	if delay := policy.delay(1, header); delay != 0 {
+		t.Errorf("Retry-After not honoured, got %s", delay)
+	}
+	if _, err := newRetryPolicy(&connectionSettings{openstackConfig: openstackConfig{MinRetryDelay: utils.PointerTo("soon")}}); err == nil {
+		t.Errorf("expected error for invalid delay")
+	}
+}
@@ -0,0 +1,353 @@
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+const (
+	// ConnectionSettings is the cache key for the effective connection settings.
+	ConnectionSettings = "openstack_connection_settings"
+)
+
+// settingSource identifies where the effective value of a setting came from.
+type settingSource string
+
+const (
+	sourceConfig      settingSource = "config"
+	sourceEnvironment settingSource = "environment"
+	sourceCloudsFile  settingSource = "clouds.yaml"
+	sourceDefault     settingSource = "default"
+)
+
+// sourcePrecedence ranks the setting sources, from the highest precedence.
+var sourcePrecedence = map[settingSource]int{
+	sourceConfig:      0,
+	sourceEnvironment: 1,
+	sourceCloudsFile:  2,
+	sourceDefault:     3,
+}
+
+const (
+	authApplicationCredential = "application credential"
+	authToken                 = "token"
+	authPassword              = "password"
+)
+
+// authMethods lists the settings of each authentication method, in order of
+// preference when the same source sets more than one method.
+var authMethods = []struct {
+	name     string
+	settings []string
+}{
+	{authApplicationCredential, []string{"app_credential_id", "app_credential_secret"}},
+	{authToken, []string{"access_token"}},
+	{authPassword, []string{"userid", "username", "password"}},
+}
+
+// connectionSettings holds the effective settings of a connection; each
+// setting is resolved independently of the others, taking the first value
+// available in the following order:
+//  1. the explicit connection configuration in the .spc file;
+//  2. the OS_* environment variables (unless ignore_environment is set);
+//  3. the cloud profile selected in the clouds.yaml file, if any.
+//
+// The settings that have no equivalent in the connection configuration can
+// only come from the environment or from the cloud profile.
+type connectionSettings struct {
+	openstackConfig
+	IdentityAPIVersion *string
+	// AuthMethod is the authentication method in use, one of the names
+	// in authMethods.
+	AuthMethod string
+	// Sources records where each effective setting came from.
+	Sources map[string]settingSource
+}
+
+// getConnectionSettings returns the effective settings of the current
+// connection, computing them on first access.
+func getConnectionSettings(ctx context.Context, d *plugin.QueryData) (*connectionSettings, error) {
+	if cachedData, ok := d.ConnectionManager.Cache.Get(ConnectionSettings); ok {
+		return cachedData.(*connectionSettings), nil
+	}
+
+	config := GetConfig(d.Connection)
+	getenv := os.Getenv
+	if config.IgnoreEnvironment != nil && *config.IgnoreEnvironment {
+		logger(ctx).Debug("environment lookup disabled for connection")
+		getenv = func(string) string { return "" }
+	}
+
+	settings, err := resolveConnectionSettings(config, getenv)
+	if err != nil {
+		logger(ctx).Error("error resolving connection settings", "error", err)
+		return nil, err
+	}
+	// the explicit configuration may hold secrets of an authentication
+	// method that is not in use, and thus not in the settings
+	registerConfigSecrets(&config)
+	registerConfigSecrets(&settings.openstackConfig)
+
+	names := make([]string, 0, len(settings.Sources))
+	for name := range settings.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		logger(ctx).Debug("effective connection setting", "name", name, "source", settings.Sources[name])
+	}
+
+	d.ConnectionManager.Cache.Set(ConnectionSettings, settings)
+	return settings, nil
+}
+
+// registerConfigSecrets registers the secrets in the given configuration,
+// so that they are scrubbed from the log output.
+func registerConfigSecrets(config *openstackConfig) {
+	for _, secret := range []*string{config.Password, config.AccessToken, config.AppCredentialSecret} {
+		if secret != nil {
+			registerSecrets(*secret)
+		}
+	}
+	if config.ProxyURL != nil {
+		// the proxy URL may embed the proxy credentials
+		if proxy, err := url.Parse(*config.ProxyURL); err == nil && proxy.User != nil {
+			if password, ok := proxy.User.Password(); ok {
+				registerSecrets(password)
+			}
+		}
+	}
+	if headers, err := parseHeaders(config.ExtraHeaders); err == nil {
+		// extra headers often carry tokens or API gateway keys
+		for _, values := range headers {
+			registerSecrets(values...)
+		}
+	}
+}
+
+// resolveConnectionSettings merges, setting by setting, the explicit
+// connection configuration, the environment (as returned by getenv) and the
+// cloud profile named either in the "cloud" option or in OS_CLOUD.
+func resolveConnectionSettings(config openstackConfig, getenv func(string) string) (*connectionSettings, error) {
+	settings := &connectionSettings{
+		openstackConfig: config,
+		Sources:         map[string]settingSource{},
+	}
+
+	// the cloud profile selection itself follows the same precedence rules
+	cloudsFile := resolveString(settings, "clouds_file", &settings.CloudsFile, getenv, []string{"OS_CLIENT_CONFIG_FILE"}, "")
+	cloud := resolveString(settings, "cloud", &settings.Cloud, getenv, []string{"OS_CLOUD"}, "")
+
+	profile := &cloudProfile{}
+	if cloud != "" {
+		var err error
+		if profile, err = loadCloudProfile(cloudsFile, cloud, getenv); err != nil {
+			return nil, err
+		}
+	}
+
+	resolveString(settings, "endpoint_url", &settings.EndpointUrl, getenv, []string{"OS_AUTH_URL"}, profile.Auth.AuthURL)
+	resolveString(settings, "userid", &settings.UserID, getenv, []string{"OS_USER_ID", "OS_USERID"}, profile.Auth.UserID)
+	resolveString(settings, "username", &settings.Username, getenv, []string{"OS_USERNAME"}, profile.Auth.Username)
+	resolveString(settings, "password", &settings.Password, getenv, []string{"OS_PASSWORD"}, profile.Auth.Password)
+	resolveString(settings, "region", &settings.Region, getenv, []string{"OS_REGION_NAME"}, profile.RegionName)
+	resolveString(settings, "project_id", &settings.ProjectID, getenv, []string{"OS_PROJECT_ID", "OS_TENANT_ID"}, profile.Auth.ProjectID)
+	resolveString(settings, "project_name", &settings.ProjectName, getenv, []string{"OS_PROJECT_NAME", "OS_TENANT_NAME"}, profile.Auth.ProjectName)
+	resolveString(settings, "domain_id", &settings.DomainID, getenv, []string{"OS_DOMAIN_ID"}, profile.Auth.DomainID)
+	resolveString(settings, "domain_name", &settings.DomainName, getenv, []string{"OS_DOMAIN_NAME"}, profile.Auth.DomainName)
+	resolveString(settings, "user_domain_id", &settings.UserDomainID, getenv, []string{"OS_USER_DOMAIN_ID"}, profile.Auth.UserDomainID)
+	resolveString(settings, "user_domain_name", &settings.UserDomainName, getenv, []string{"OS_USER_DOMAIN_NAME"}, profile.Auth.UserDomainName)
+	resolveString(settings, "project_domain_id", &settings.ProjectDomainID, getenv, []string{"OS_PROJECT_DOMAIN_ID"}, profile.Auth.ProjectDomainID)
+	resolveString(settings, "project_domain_name", &settings.ProjectDomainName, getenv, []string{"OS_PROJECT_DOMAIN_NAME"}, profile.Auth.ProjectDomainName)
+	resolveString(settings, "access_token", &settings.AccessToken, getenv, []string{"OS_TOKEN", "OS_AUTH_TOKEN"}, profile.Auth.Token)
+	resolveString(settings, "app_credential_id", &settings.AppCredentialID, getenv, []string{"OS_APPLICATION_CREDENTIAL_ID"}, profile.Auth.ApplicationCredentialID)
+	resolveString(settings, "app_credential_secret", &settings.AppCredentialSecret, getenv, []string{"OS_APPLICATION_CREDENTIAL_SECRET"}, profile.Auth.ApplicationCredentialSecret)
+	resolveString(settings, "interface", &settings.Interface, getenv, []string{"OS_INTERFACE", "OS_ENDPOINT_TYPE"}, profile.Interface)
+	resolveString(settings, "cacert", &settings.CACert, getenv, []string{"OS_CACERT"}, profile.CACert)
+	resolveString(settings, "cert", &settings.Cert, getenv, []string{"OS_CERT"}, profile.Cert)
+	resolveString(settings, "key", &settings.Key, getenv, []string{"OS_KEY"}, profile.Key)
+	resolveString(settings, "identity_api_version", &settings.IdentityAPIVersion, getenv, []string{"OS_IDENTITY_API_VERSION"}, profile.IdentityAPIVersion)
+
+	var insecure *bool
+	if profile.Verify != nil {
+		insecure = utils.PointerTo(!*profile.Verify)
+	}
+	resolveBool(settings, "insecure", &settings.Insecure, getenv, []string{"OS_INSECURE"}, insecure)
+
+	// the user and the project domain are each identified either by ID or
+	// by name, with domain_id and domain_name applying to both
+	settings.resolveDomain("user_domain_id", "user_domain_name")
+	settings.resolveDomain("project_domain_id", "project_domain_name")
+	settings.AuthMethod = settings.resolveAuthMethod()
+
+	if settings.AllowReauth != nil {
+		settings.Sources["allow_reauth"] = sourceConfig
+	} else {
+		allowReauth := true
+		settings.AllowReauth = &allowReauth
+		settings.Sources["allow_reauth"] = sourceDefault
+	}
+
+	if settings.Interface != nil {
+		if _, err := toAvailability(*settings.Interface); err != nil {
+			return nil, err
+		}
+	}
+	if settings.IdentityAPIVersion != nil && !strings.HasPrefix(*settings.IdentityAPIVersion, "3") {
+		return nil, fmt.Errorf("unsupported identity API version %q (from %s): only v3 is supported", *settings.IdentityAPIVersion, settings.Sources["identity_api_version"])
+	}
+	return settings, nil
+}
+
+// resolveString sets the given setting to the first value available among
+// the explicit configuration (i.e. the current value of field), the given
+// environment variables and the cloud profile value, records its source and
+// returns the effective value.
+func resolveString(settings *connectionSettings, name string, field **string, getenv func(string) string, variables []string, profile string) string {
+	if *field != nil {
+		settings.Sources[name] = sourceConfig
+		return **field
+	}
+	for _, variable := range variables {
+		if value := getenv(variable); value != "" {
+			*field = &value
+			settings.Sources[name] = sourceEnvironment
+			return value
+		}
+	}
+	if profile != "" {
+		*field = &profile
+		settings.Sources[name] = sourceCloudsFile
+		return profile
+	}
+	return ""
+}
+
+// resolveBool is the equivalent of resolveString for boolean settings; the
+// environment variables are parsed with strconv.ParseBool and ignored if
+// invalid, whereas a nil profile value means the setting is not in the
+// cloud profile.
+func resolveBool(settings *connectionSettings, name string, field **bool, getenv func(string) string, variables []string, profile *bool) {
+	if *field != nil {
+		settings.Sources[name] = sourceConfig
+		return
+	}
+	for _, variable := range variables {
+		if value, err := strconv.ParseBool(getenv(variable)); err == nil {
+			*field = &value
+			settings.Sources[name] = sourceEnvironment
+			return
+		}
+	}
+	if profile != nil {
+		*field = profile
+		settings.Sources[name] = sourceCloudsFile
+	}
+}
+
+// stringSetting returns the field of the given string setting, for those
+// settings that are resolved as a group.
+func (s *connectionSettings) stringSetting(name string) **string {
+	switch name {
+	case "app_credential_id":
+		return &s.AppCredentialID
+	case "app_credential_secret":
+		return &s.AppCredentialSecret
+	case "access_token":
+		return &s.AccessToken
+	case "userid":
+		return &s.UserID
+	case "username":
+		return &s.Username
+	case "password":
+		return &s.Password
+	case "domain_id":
+		return &s.DomainID
+	case "domain_name":
+		return &s.DomainName
+	case "user_domain_id":
+		return &s.UserDomainID
+	case "user_domain_name":
+		return &s.UserDomainName
+	case "project_domain_id":
+		return &s.ProjectDomainID
+	case "project_domain_name":
+		return &s.ProjectDomainName
+	}
+	panic(fmt.Sprintf("invalid string setting: %q", name))
+}
+
+// rank returns the precedence of the source of the given settings that
+// comes first, or -1 if none of them is set.
+func (s *connectionSettings) rank(names ...string) int {
+	rank := -1
+	for _, name := range names {
+		if source, ok := s.Sources[name]; ok && (rank < 0 || sourcePrecedence[source] < rank) {
+			rank = sourcePrecedence[source]
+		}
+	}
+	return rank
+}
+
+// clear unsets the given settings.
+func (s *connectionSettings) clear(names ...string) {
+	for _, name := range names {
+		*s.stringSetting(name) = nil
+		delete(s.Sources, name)
+	}
+}
+
+// resolveAuthMethod picks the authentication method set by the source with
+// the highest precedence, so that for instance an application credential
+// in the environment does not override a username and password in the
+// connection configuration, and unsets the settings of the other methods;
+// the settings of the method in use may still come from different sources.
+func (s *connectionSettings) resolveAuthMethod() string {
+	method, best := authPassword, -1
+	for _, candidate := range authMethods {
+		if rank := s.rank(candidate.settings...); rank >= 0 && (best < 0 || rank < best) {
+			method, best = candidate.name, rank
+		}
+	}
+	for _, candidate := range authMethods {
+		if candidate.name != method {
+			s.clear(candidate.settings...)
+		}
+	}
+	return method
+}
+
+// resolveDomain resolves a domain that can be given either by ID or by name
+// (i.e. the user or the project domain): the setting with the highest
+// precedence among the given ones and the generic domain_id and domain_name
+// applies, the ID winning over the name if they come from the same source,
+// and the other of the given pair is unset.
+func (s *connectionSettings) resolveDomain(id string, name string) {
+	candidates := []string{id, name, "domain_id", "domain_name"}
+	chosen, best := "", -1
+	for _, candidate := range candidates {
+		if rank := s.rank(candidate); rank >= 0 && (best < 0 || rank < best) {
+			chosen, best = candidate, rank
+		}
+	}
+	if chosen == "" {
+		return
+	}
+	value, source := *s.stringSetting(chosen), s.Sources[chosen]
+	s.clear(id, name)
+	if chosen == id || chosen == "domain_id" {
+		*s.stringSetting(id) = value
+		s.Sources[id] = source
+	} else {
+		*s.stringSetting(name) = value
+		s.Sources[name] = source
+	}
+}
@@ -0,0 +1,305 @@
+package openstack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// SnapshotRecord makes the connection query the cloud and save each
+	// response to the snapshot directory.
+	SnapshotRecord = "record"
+	// SnapshotReplay makes the connection answer all requests from the
+	// snapshot directory, without ever contacting the cloud.
+	SnapshotReplay = "replay"
+)
+
+// snapshotToken replaces the authentication tokens in the snapshots; when
+// replaying, the token is never sent anywhere, so any value will do.
+const snapshotToken = "snapshot"
+
+// snapshotExactParameters are the query parameters that a recorded response
+// must have with the same values as the request to answer it: the other
+// filters may be missing from the recorded request, which then returned a
+// superset of the resources, but a different page or scope would not (e.g.
+// Nova lists the key pairs of the current user without a user_id).
+var snapshotExactParameters = []string{"marker", "offset", "all_tenants", "all_projects", "user_id"}
+
+// errNotRecorded is returned, when replaying, for the requests that have no
+// recorded response; it is not transient, so the requests are not retried.
+var errNotRecorded = errors.New("no recorded response")
+
+// snapshotEntry is a recorded request and its response.
+type snapshotEntry struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+
+	// the parsed URL, for matching
+	url *url.URL
+}
+
+// getSnapshotMode returns the snapshot_mode option, or an empty string if
+// snapshot_dir is not set; the mode defaults to replay.
+func getSnapshotMode(settings *connectionSettings) (string, error) {
+	if settings.SnapshotDir == nil || *settings.SnapshotDir == "" {
+		if settings.SnapshotMode != nil {
+			return "", errors.New("snapshot_mode requires snapshot_dir")
+		}
+		return "", nil
+	}
+	if settings.SnapshotMode == nil {
+		return SnapshotReplay, nil
+	}
+	switch *settings.SnapshotMode {
+	case SnapshotRecord, SnapshotReplay:
+		return *settings.SnapshotMode, nil
+	}
+	return "", fmt.Errorf("invalid snapshot_mode %q: must be one of %s or %s", *settings.SnapshotMode, SnapshotRecord, SnapshotReplay)
+}
+
+// snapshotKey identifies a request in the snapshot: its method and URL,
+// with the query parameters in a canonical order.
+func snapshotKey(method string, u *url.URL) string {
+	canonical := *u
+	canonical.RawQuery = canonical.Query().Encode()
+	canonical.Fragment = ""
+	return method + " " + canonical.String()
+}
+
+// snapshotFile returns the path of the file holding the recorded response
+// to the request with the given key.
+func snapshotFile(dir string, key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(hash[:])+".json")
+}
+
+// recordTransport saves each response to the snapshot directory, one file
+// per request, before passing it on; authentication tokens are redacted
+// from the saved responses.
+type recordTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func newRecordTransport(dir string, next http.RoundTripper) (*recordTransport, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating snapshot directory %q: %w", dir, err)
+	}
+	return &recordTransport{dir: dir, next: next}, nil
+}
+
+func (t *recordTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := t.next.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := response.Header.Clone()
+	header.Del("Set-Cookie")
+	if header.Get("X-Subject-Token") != "" {
+		header.Set("X-Subject-Token", snapshotToken)
+	}
+	entry := &snapshotEntry{
+		Method: request.Method,
+		URL:    request.URL.String(),
+		Status: response.StatusCode,
+		Header: header,
+		Body:   string(body),
+	}
+	if err := t.save(snapshotKey(request.Method, request.URL), entry); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// save writes the entry atomically, so that concurrent requests for the
+// same URL cannot leave a corrupt file behind.
+func (t *recordTransport) save(key string, entry *snapshotEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(t.dir, ".record-*")
+	if err != nil {
+		return fmt.Errorf("error recording response: %w", err)
+	}
+	_, err = file.Write(data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), snapshotFile(t.dir, key))
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("error recording response: %w", err)
+	}
+	return nil
+}
+
+// replayTransport answers the requests with the responses in the snapshot
+// directory. A request that was not recorded as is can be answered by the
+// response to the same call with fewer filters, since the tables (and
+// Steampipe) filter the rows client-side as well; otherwise it fails.
+type replayTransport struct {
+	dir     string
+	entries map[string]*snapshotEntry
+	// entries by method and URL without query, for partial matches
+	calls map[string][]*snapshotEntry
+}
+
+func newReplayTransport(dir string) (*replayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded responses in snapshot directory %q", dir)
+	}
+	t := &replayTransport{
+		dir:     dir,
+		entries: map[string]*snapshotEntry{},
+		calls:   map[string][]*snapshotEntry{},
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading snapshot: %w", err)
+		}
+		entry := &snapshotEntry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			return nil, fmt.Errorf("invalid snapshot file %q: %w", file, err)
+		}
+		if entry.url, err = url.Parse(entry.URL); err != nil {
+			return nil, fmt.Errorf("invalid URL in snapshot file %q: %w", file, err)
+		}
+		t.entries[snapshotKey(entry.Method, entry.url)] = entry
+		call := snapshotCall(entry.Method, entry.url)
+		t.calls[call] = append(t.calls[call], entry)
+	}
+	for _, entries := range t.calls {
+		// make partial matches deterministic
+		sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	}
+	return t, nil
+}
+
+func (t *replayTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		request.Body.Close()
+	}
+	entry, ok := t.entries[snapshotKey(request.Method, request.URL)]
+	if !ok {
+		entry = t.closest(request)
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%w for %s %s in snapshot directory %q", errNotRecorded, request.Method, request.URL, t.dir)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        entry.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       request,
+	}, nil
+}
+
+// closest returns the recorded response to the same call whose filters are
+// a subset of those of the request, preferring the one with most filters,
+// or nil if there is none.
+func (t *replayTransport) closest(request *http.Request) *snapshotEntry {
+	query := request.URL.Query()
+	var best *snapshotEntry
+	bestScore := -1
+	for _, entry := range t.calls[snapshotCall(request.Method, request.URL)] {
+		recorded := entry.url.Query()
+		if !answers(recorded, query) {
+			continue
+		}
+		if len(recorded) > bestScore {
+			best, bestScore = entry, len(recorded)
+		}
+	}
+	return best
+}
+
+// answers returns whether a response to a request with the recorded query
+// parameters includes all the resources in the response to a request with
+// the given ones: the page size is irrelevant, since the pages are followed
+// through the recorded links, and the recorded fields must include all the
+// requested ones (or be unrestricted).
+func answers(recorded, query url.Values) bool {
+	for _, name := range snapshotExactParameters {
+		if !equalValues(recorded[name], query[name]) {
+			return false
+		}
+	}
+	for name, values := range recorded {
+		switch name {
+		case "limit":
+		case "fields":
+			if len(query[name]) == 0 || !containsAll(values, query[name]) {
+				return false
+			}
+		default:
+			if !equalValues(values, query[name]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// snapshotCall identifies the calls to the same API, regardless of the
+// query parameters.
+func snapshotCall(method string, u *url.URL) string {
+	call := *u
+	call.RawQuery = ""
+	call.Fragment = ""
+	return method + " " + call.String()
+}
+
+func equalValues(a, b []string) bool {
+	return containsAll(a, b) && containsAll(b, a)
+}
+
+// containsAll returns whether all the values in b are also in a.
+func containsAll(a, b []string) bool {
+	for _, value := range b {
+		found := false
+		for _, other := range a {
+			if other == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,487 @@
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCloudFixtures is the directory holding the resources served by the
+// fake cloud, one JSON array per collection, as <service>/<collection>.json.
+const fakeCloudFixtures = "testdata/cloud"
+
+// fakeProjectID is the project the fake cloud scopes tokens to, which also
+// appears in the Cinder endpoint of its catalog.
+const fakeProjectID = "8ae3c3ef1d9b44a4a2b1c4e3c16e2a0d"
+
+// pagingStyle is how a service links the pages of a list.
+type pagingStyle int
+
+const (
+	// pagingNone returns all the items at once, as Keystone does.
+	pagingNone pagingStyle = iota
+	// pagingLinks adds a "<key>_links" list with a "next" link, as Nova,
+	// Neutron and Cinder do.
+	pagingLinks
+	// pagingNext adds a "next" path relative to the service root, as Glance
+	// does.
+	pagingNext
+)
+
+// fakeCollection describes a collection of resources served by the fake
+// cloud and how the service lists and returns them.
+type fakeCollection struct {
+	// service is the name of the service, which is both the first segment of
+	// the URLs of the service and the directory of its fixtures.
+	service string
+	// path is the path of the collection under the endpoint of the service.
+	path string
+	// detail is appended to the path of the collection to list it, for the
+	// services that only return full objects from /detail.
+	detail string
+	// key wraps lists in the responses, item wraps single resources (or
+	// nothing, if empty).
+	key  string
+	item string
+	// id is the field identifying the resources in the URLs, if not "id".
+	id string
+	// wrap has each item of the lists wrapped in an object, under the item
+	// key, as Nova does for key pairs.
+	wrap bool
+	// fixture is the name of the fixture file, without the extension.
+	fixture string
+	paging  pagingStyle
+	// fields is whether the service supports the fields projection.
+	fields bool
+	// parent is the field of the resources holding the ID in the "*"
+	// segment of the path, for the collections nested under another
+	// resource; these can only be listed, or returned as a single resource
+	// if item is set (e.g. the uptime of a hypervisor).
+	parent string
+	// visibility is whether the collection is filtered on visibility and
+	// os_hidden as Glance does, see matchFakeVisibility.
+	visibility bool
+	// filters maps the query parameters the fake cloud filters on to the
+	// fields of the resources they match; other parameters (e.g. time and
+	// tag filters) are ignored, so that the tables apply them client-side.
+	filters map[string]string
+}
+
+// fakeCollections are the collections the fake cloud serves.
+var fakeCollections = []fakeCollection{
+	{service: "identity", path: "/v3/projects", key: "projects", item: "project", fixture: "projects",
+		filters: fakeFilters("name", "domain_id", "parent_id", "enabled")},
+	{service: "identity", path: "/v3/users", key: "users", item: "user", fixture: "users",
+		filters: fakeFilters("name", "domain_id", "enabled")},
+	// the projects of a user, which Keystone does not filter
+	{service: "identity", path: "/v3/users/*/projects", key: "projects", fixture: "user_projects", parent: "user_id"},
+	{service: "identity", path: "/v3/domains", key: "domains", item: "domain", fixture: "domains",
+		filters: fakeFilters("name", "enabled")},
+	{service: "compute", path: "/v2.1/servers", detail: "/detail", key: "servers", item: "server", fixture: "servers", paging: pagingLinks,
+		filters: fakeFilters("name", "status", "tenant_id", "user_id", "host=OS-EXT-SRV-ATTR:host", "availability_zone=OS-EXT-AZ:availability_zone")},
+	// is_public is not filtered on, since Nova takes "None" for all flavors
+	{service: "compute", path: "/v2.1/flavors", detail: "/detail", key: "flavors", item: "flavor", fixture: "flavors", paging: pagingLinks},
+	{service: "compute", path: "/v2.1/flavors/*/os-flavor-access", key: "flavor_access", fixture: "flavor_access", parent: "flavor_id"},
+	{service: "compute", path: "/v2.1/os-hypervisors", detail: "/detail", key: "hypervisors", item: "hypervisor", fixture: "hypervisors", paging: pagingLinks,
+		filters: fakeFilters("hypervisor_hostname_pattern=hypervisor_hostname")},
+	{service: "compute", path: "/v2.1/os-server-groups", key: "server_groups", item: "server_group", fixture: "server_groups"},
+	{service: "compute", path: "/v2.1/os-keypairs", key: "keypairs", item: "keypair", id: "name", wrap: true, fixture: "keypairs", paging: pagingLinks,
+		filters: fakeFilters("user_id")},
+	{service: "compute", path: "/v2.1/os-aggregates", key: "aggregates", item: "aggregate", fixture: "aggregates"},
+	{service: "compute", path: "/v2.1/os-availability-zone", detail: "/detail", key: "availabilityZoneInfo", fixture: "availability_zones"},
+	{service: "compute", path: "/v2.1/os-hypervisors/*/uptime", item: "hypervisor", fixture: "hypervisor_uptimes", parent: "id"},
+	{service: "network", path: "/v2.0/ports", key: "ports", item: "port", fixture: "ports", paging: pagingLinks, fields: true,
+		filters: fakeFilters("id", "name", "status", "project_id", "network_id", "device_id", "device_owner", "mac_address")},
+	{service: "network", path: "/v2.0/networks", key: "networks", item: "network", fixture: "networks", paging: pagingLinks, fields: true,
+		filters: fakeFilters("id", "name", "status", "project_id", "shared")},
+	{service: "network", path: "/v2.0/security-groups", key: "security_groups", item: "security_group", fixture: "security_groups", paging: pagingLinks, fields: true,
+		filters: fakeFilters("id", "name", "project_id")},
+	{service: "network", path: "/v2.0/security-group-rules", key: "security_group_rules", item: "security_group_rule", fixture: "security_group_rules", paging: pagingLinks, fields: true,
+		filters: fakeFilters("id", "direction", "ethertype", "protocol", "security_group_id", "remote_group_id", "project_id")},
+	{service: "volume", path: "/v3/" + fakeProjectID + "/volumes", detail: "/detail", key: "volumes", item: "volume", fixture: "volumes", paging: pagingLinks,
+		filters: fakeFilters("name", "status", "project_id=os-vol-tenant-attr:tenant_id")},
+	{service: "volume", path: "/v3/" + fakeProjectID + "/attachments", detail: "/detail", key: "attachments", item: "attachment", fixture: "attachments", paging: pagingLinks,
+		filters: fakeFilters("project_id", "volume_id", "instance_id=instance")},
+	{service: "image", path: "/v2/images", key: "images", fixture: "images", paging: pagingNext, visibility: true,
+		filters: fakeFilters("name", "owner", "status")},
+}
+
+// fakeFilters maps each of the given query parameters to the field of the
+// same name, or to the one following "=".
+func fakeFilters(parameters ...string) map[string]string {
+	filters := map[string]string{}
+	for _, parameter := range parameters {
+		name, field, ok := strings.Cut(parameter, "=")
+		if !ok {
+			field = name
+		}
+		filters[name] = field
+	}
+	return filters
+}
+
+// fakeCloud is an in-process OpenStack cloud, serving Keystone token
+// issuance and catalog and the Nova, Neutron, Cinder and Glance calls the
+// plugin makes, from the fixtures; it records the requests it receives, so
+// that tests can check which filters were passed down to the services.
+type fakeCloud struct {
+	*httptest.Server
+	resources map[string][]map[string]interface{}
+	// maxLimit caps the size of the pages, if set, as the osapi_max_limit
+	// of Nova does whatever the limit requested.
+	maxLimit int
+	// forbidden holds the paths answered with 403 Forbidden, as for a
+	// user without the required role; it is guarded by lock.
+	forbidden map[string]bool
+	lock      sync.Mutex
+	requests  []string
+}
+
+// newFakeCloud starts a fake cloud serving the fixtures; it is stopped when
+// the test completes.
+func newFakeCloud(t *testing.T) *fakeCloud {
+	t.Helper()
+	cloud := &fakeCloud{resources: map[string][]map[string]interface{}{}, forbidden: map[string]bool{}}
+	for _, collection := range fakeCollections {
+		path := filepath.Join(fakeCloudFixtures, collection.service, collection.fixture+".json")
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		items := []map[string]interface{}{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			t.Fatalf("invalid fixture %s: %v", path, err)
+		}
+		cloud.resources[collection.fixture] = items
+	}
+	cloud.Server = httptest.NewServer(http.HandlerFunc(cloud.serve))
+	t.Cleanup(cloud.Close)
+	return cloud
+}
+
+// forbid has the fake cloud answer the requests on the given path with 403
+// Forbidden.
+func (c *fakeCloud) forbid(path string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.forbidden[path] = true
+}
+
+// requested returns the requests received so far whose path and query start
+// with the given prefix (e.g. "GET /network/v2.0/ports?").
+func (c *fakeCloud) requested(prefix string) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	matches := []string{}
+	for _, request := range c.requests {
+		if strings.HasPrefix(request, prefix) {
+			matches = append(matches, request)
+		}
+	}
+	return matches
+}
+
+func (c *fakeCloud) serve(w http.ResponseWriter, r *http.Request) {
+	c.lock.Lock()
+	c.requests = append(c.requests, r.Method+" "+r.URL.RequestURI())
+	forbidden := c.forbidden[r.URL.Path]
+	c.lock.Unlock()
+
+	if r.Method == http.MethodPost && r.URL.Path == "/identity/v3/auth/tokens" {
+		c.issueToken(w)
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeFakeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+	if forbidden {
+		writeFakeError(w, http.StatusForbidden)
+		return
+	}
+	for _, collection := range fakeCollections {
+		base := "/" + collection.service + collection.path
+		if collection.parent != "" {
+			if parentID, ok := matchFakePath(base, r.URL.Path); ok {
+				if collection.item != "" {
+					c.get(w, r, collection, parentID)
+				} else {
+					c.list(w, r, collection, parentID)
+				}
+				return
+			}
+			continue
+		}
+		switch {
+		case r.URL.Path == base+collection.detail:
+			c.list(w, r, collection, "")
+			return
+		case strings.HasPrefix(r.URL.Path, base+"/") && !strings.Contains(strings.TrimPrefix(r.URL.Path, base+"/"), "/"):
+			c.get(w, r, collection, strings.TrimPrefix(r.URL.Path, base+"/"))
+			return
+		}
+	}
+	// Keystone and Glance publish their version documents, with no
+	// microversion range; the others are not found, and the plugin then
+	// uses its default microversions
+	switch r.URL.Path {
+	case "/identity/v3", "/identity/v3/":
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"version": fakeVersion(c.URL+"/identity/v3/", "v3.14", "stable")})
+		return
+	case "/image/":
+		writeFakeJSON(w, http.StatusMultipleChoices, map[string]interface{}{"versions": []interface{}{
+			fakeVersion(c.URL+"/image/v2/", "v2.9", "CURRENT"),
+			fakeVersion(c.URL+"/image/v2/", "v2.8", "SUPPORTED"),
+			fakeVersion(c.URL+"/image/v2/", "v2.0", "SUPPORTED"),
+		}})
+		return
+	}
+	writeFakeError(w, http.StatusNotFound)
+}
+
+// fakeVersion returns an entry of a version document, as Keystone and Glance
+// publish it: with an ID and a status, and no microversion range.
+func fakeVersion(href string, id string, status string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      id,
+		"status":  status,
+		"updated": "2020-04-07T00:00:00Z",
+		"links":   []map[string]interface{}{{"rel": "self", "href": href}},
+	}
+}
+
+// issueToken returns a token scoped to the fake project, whose catalog
+// points all the services at the fake cloud.
+func (c *fakeCloud) issueToken(w http.ResponseWriter) {
+	endpoints := map[string]string{
+		"identity": c.URL + "/identity/v3/",
+		"compute":  c.URL + "/compute/v2.1/",
+		"network":  c.URL + "/network/",
+		"volumev3": c.URL + "/volume/v3/" + fakeProjectID + "/",
+		"image":    c.URL + "/image/",
+	}
+	catalog := []map[string]interface{}{}
+	for catalogType, url := range endpoints {
+		catalog = append(catalog, map[string]interface{}{
+			"type": catalogType,
+			"name": catalogType,
+			"endpoints": []map[string]interface{}{
+				{"interface": "public", "region": "RegionOne", "region_id": "RegionOne", "url": url},
+			},
+		})
+	}
+	w.Header().Set("X-Subject-Token", "fake-token")
+	writeFakeJSON(w, http.StatusCreated, map[string]interface{}{
+		"token": map[string]interface{}{
+			"methods":    []string{"password"},
+			"expires_at": "2099-01-01T00:00:00.000000Z",
+			"project":    map[string]interface{}{"id": fakeProjectID, "name": "admin", "domain": map[string]interface{}{"id": "default", "name": "Default"}},
+			"user":       map[string]interface{}{"id": "5e2ac7b7e4c04d2a9c1f0cfb5d0f6c3a", "name": "admin", "domain": map[string]interface{}{"id": "default", "name": "Default"}},
+			"catalog":    catalog,
+		},
+	})
+}
+
+// list returns the items in the collection that match the filters in the
+// query (and belong to the parent resource, for nested collections), one
+// page at a time.
+func (c *fakeCloud) list(w http.ResponseWriter, r *http.Request, collection fakeCollection, parentID string) {
+	query := r.URL.Query()
+	items := []map[string]interface{}{}
+	for _, item := range c.resources[collection.fixture] {
+		if collection.parent != "" && item[collection.parent] != parentID {
+			continue
+		}
+		if collection.visibility && !matchFakeVisibility(item, query) {
+			continue
+		}
+		if matchFakeFilters(item, query, collection.filters) {
+			items = append(items, item)
+		}
+	}
+
+	field := "id"
+	if collection.id != "" {
+		field = collection.id
+	}
+	if marker := query.Get("marker"); marker != "" {
+		for i, item := range items {
+			if fmt.Sprint(item[field]) == marker {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+	// Nova pages server groups by offset, with no links
+	if offset, err := strconv.Atoi(query.Get("offset")); err == nil && offset > 0 {
+		if offset > len(items) {
+			offset = len(items)
+		}
+		items = items[offset:]
+	}
+	next := ""
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if c.maxLimit > 0 && (err != nil || limit <= 0 || limit > c.maxLimit) {
+		limit, err = c.maxLimit, nil
+	}
+	if err == nil && limit > 0 && limit < len(items) {
+		items = items[:limit]
+		query.Set("marker", fmt.Sprint(items[limit-1][field]))
+		next = r.URL.Path + "?" + query.Encode()
+	}
+
+	if collection.fields {
+		for i, item := range items {
+			items[i] = projectFakeFields(item, query["fields"])
+		}
+	}
+	var list interface{} = items
+	if collection.wrap {
+		wrapped := []map[string]interface{}{}
+		for _, item := range items {
+			wrapped = append(wrapped, map[string]interface{}{collection.item: item})
+		}
+		list = wrapped
+	}
+	body := map[string]interface{}{collection.key: list}
+	switch collection.paging {
+	case pagingLinks:
+		links := []map[string]string{}
+		if next != "" {
+			links = append(links, map[string]string{"rel": "next", "href": c.URL + next})
+		}
+		body[collection.key+"_links"] = links
+	case pagingNext:
+		if next != "" {
+			body["next"] = strings.TrimPrefix(next, "/"+collection.service)
+		}
+	default:
+		body["links"] = map[string]interface{}{"next": nil}
+	}
+	writeFakeJSON(w, http.StatusOK, body)
+}
+
+// get returns the item in the collection with the given ID (or parent ID,
+// for nested collections) that matches the filters in the query, if any.
+func (c *fakeCloud) get(w http.ResponseWriter, r *http.Request, collection fakeCollection, id string) {
+	field := "id"
+	if collection.id != "" {
+		field = collection.id
+	}
+	if collection.parent != "" {
+		field = collection.parent
+	}
+	for _, item := range c.resources[collection.fixture] {
+		// IDs are compared as text, since those of aggregates are numbers
+		if fmt.Sprint(item[field]) != id || !matchFakeFilters(item, r.URL.Query(), collection.filters) {
+			continue
+		}
+		if collection.fields {
+			item = projectFakeFields(item, r.URL.Query()["fields"])
+		}
+		if collection.item == "" {
+			writeFakeJSON(w, http.StatusOK, item)
+		} else {
+			writeFakeJSON(w, http.StatusOK, map[string]interface{}{collection.item: item})
+		}
+		return
+	}
+	writeFakeError(w, http.StatusNotFound)
+}
+
+// matchFakePath returns whether the path matches the pattern, where "*"
+// stands for any one segment, and the value of that segment.
+func matchFakePath(pattern string, path string) (string, bool) {
+	patternSegments := strings.Split(pattern, "/")
+	pathSegments := strings.Split(path, "/")
+	if len(patternSegments) != len(pathSegments) {
+		return "", false
+	}
+	value := ""
+	for i, segment := range patternSegments {
+		switch {
+		case segment == "*":
+			value = pathSegments[i]
+		case segment != pathSegments[i]:
+			return "", false
+		}
+	}
+	return value, true
+}
+
+// matchFakeFilters returns whether the item matches the query parameters
+// the collection filters on.
+func matchFakeFilters(item map[string]interface{}, query url.Values, filters map[string]string) bool {
+	for parameter, field := range filters {
+		values, ok := query[parameter]
+		if !ok {
+			continue
+		}
+		matched := false
+		for _, value := range values {
+			if fmt.Sprint(item[field]) == value {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchFakeVisibility returns whether an image is listed, as by Glance: the
+// community images are only listed with visibility=community or all, and
+// the hidden images only with os_hidden=true (and then only those).
+func matchFakeVisibility(item map[string]interface{}, query url.Values) bool {
+	switch visibility := query.Get("visibility"); visibility {
+	case "":
+		if item["visibility"] == "community" {
+			return false
+		}
+	case "all":
+	default:
+		if item["visibility"] != visibility {
+			return false
+		}
+	}
+	return fmt.Sprint(item["os_hidden"]) == fmt.Sprint(query.Get("os_hidden") == "true")
+}
+
+// projectFakeFields returns a copy of the item with only the given fields,
+// or the item itself if there are none.
+func projectFakeFields(item map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 {
+		return item
+	}
+	projected := map[string]interface{}{}
+	for _, field := range fields {
+		if value, ok := item[field]; ok {
+			projected[field] = value
+		}
+	}
+	return projected
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeFakeError(w http.ResponseWriter, status int) {
+	writeFakeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{"code": status, "message": http.StatusText(status)},
+	})
+}
@@ -0,0 +1,69 @@
+package openstack
+
+import (
+	"net/url"
+	"sort"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// apiFields maps the columns of a table to the fields of the API objects
+// they are built from, so that Neutron List and Get calls can request only
+// what the query needs through the fields parameter; columns that are not
+// backed by any field (e.g. the tag filters and the region) map to none.
+type apiFields map[string][]string
+
+// selected returns the fields backing the columns selected by the query,
+// plus the required ones, which the List and Get functions need anyway
+// (e.g. to filter rows client-side); it returns nil, meaning all fields,
+// if the selected columns are unknown or any of them is not in the map.
+func (f apiFields) selected(d *plugin.QueryData, required ...string) []string {
+	if d.QueryContext == nil || d.QueryContext.Columns == nil {
+		return nil
+	}
+	set := map[string]struct{}{}
+	for _, field := range required {
+		set[field] = struct{}{}
+	}
+	for _, column := range d.QueryContext.Columns {
+		fields, ok := f[column]
+		if !ok {
+			return nil
+		}
+		for _, field := range fields {
+			set[field] = struct{}{}
+		}
+	}
+	fields := make([]string, 0, len(set))
+	for field := range set {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// withFields appends the fields parameter, one value per field, to a URL or
+// to a query string; no fields means all fields.
+func withFields(query string, fields []string) string {
+	params := url.Values{}
+	for _, field := range fields {
+		params.Add("fields", field)
+	}
+	query, _ = appendQuery(query, nil, params)
+	return query
+}
+
+// filterFields returns the fields List functions need in any case: the ID,
+// which Neutron uses as the pagination marker, the project, to enforce the
+// project restrictions, and the timestamps and tags if the query filters
+// rows on them client-side.
+func filterFields(project string, ranges timeRanges, tags tagFilter) []string {
+	fields := []string{"id", project}
+	if len(ranges) > 0 {
+		fields = append(fields, "created_at", "updated_at")
+	}
+	if tags != (tagFilter{}) {
+		fields = append(fields, "tags")
+	}
+	return fields
+}
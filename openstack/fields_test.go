@@ -0,0 +1,65 @@
+package openstack
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+func TestSelectedFields(t *testing.T) {
+	fields := apiFields{
+		"id":           {"id"},
+		"name":         {"name"},
+		"project_id":   {"tenant_id"},
+		"project_name": {"tenant_id"},
+		"region":       nil,
+	}
+	tests := []struct {
+		columns  []string
+		expected []string
+	}{
+		{nil, nil},
+		{[]string{}, []string{"id", "project_id"}},
+		{[]string{"name", "region"}, []string{"id", "name", "project_id"}},
+		{[]string{"project_id", "project_name"}, []string{"id", "project_id", "tenant_id"}},
+		{[]string{"name", "unknown"}, nil},
+	}
+	for i, test := range tests {
+		d := testQueryData(openstackConfig{})
+		if test.columns != nil {
+			d.QueryContext = &plugin.QueryContext{Columns: test.columns}
+		}
+		if selected := fields.selected(d, "id", "project_id"); !reflect.DeepEqual(selected, test.expected) {
+			t.Errorf("test %d: expected %v, got %v", i, test.expected, selected)
+		}
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	tests := []struct {
+		query    string
+		fields   []string
+		expected string
+	}{
+		{"https://neutron/v2.0/ports/1", nil, "https://neutron/v2.0/ports/1"},
+		{"https://neutron/v2.0/ports/1", []string{"id", "name"}, "https://neutron/v2.0/ports/1?fields=id&fields=name"},
+		{"?limit=10", []string{"id"}, "?limit=10&fields=id"},
+	}
+	for _, test := range tests {
+		if query := withFields(test.query, test.fields); query != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, query)
+		}
+	}
+}
+
+func TestFilterFields(t *testing.T) {
+	ranges := timeRanges{"created_at": &timeRange{}}
+	tags := tagFilter{Tags: "a"}
+	if fields := filterFields("project_id", nil, tagFilter{}); !reflect.DeepEqual(fields, []string{"id", "project_id"}) {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if fields := filterFields("project_id", ranges, tags); !reflect.DeepEqual(fields, []string{"id", "project_id", "created_at", "updated_at", "tags"}) {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
@@ -0,0 +1,323 @@
+package openstack
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	pluginshared "github.com/turbot/steampipe-plugin-sdk/v5/grpc/shared"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// testPluginVariable is set in the environment of the test binary when it is
+// run as the plugin process the tests query.
+const testPluginVariable = "OPENSTACK_TEST_PLUGIN"
+
+// TestMain serves the plugin, as Steampipe runs it, when the test binary is
+// started as the plugin process; otherwise it runs the tests and stops the
+// plugin process they started, if any.
+func TestMain(m *testing.M) {
+	if os.Getenv(testPluginVariable) != "" {
+		plugin.Serve(&plugin.ServeOpts{PluginFunc: Plugin})
+		return
+	}
+	code := m.Run()
+	if testPlugin.client != nil {
+		testPlugin.client.Kill()
+	}
+	os.Exit(code)
+}
+
+// testPlugin is the plugin process shared by the tests, started on first use.
+var testPlugin struct {
+	once        sync.Once
+	client      *goplugin.Client
+	plugin      *grpc.PluginClient
+	err         error
+	connections int64
+}
+
+// startTestPlugin starts the test binary as a plugin process, if not yet
+// running, and returns the gRPC client Steampipe would use to talk to it.
+func startTestPlugin(t *testing.T) *grpc.PluginClient {
+	t.Helper()
+	testPlugin.once.Do(func() {
+		name := Plugin(testContext()).Name
+		command := exec.Command(os.Args[0])
+		command.Env = append(os.Environ(), testPluginVariable+"=1")
+		testPlugin.client = goplugin.NewClient(&goplugin.ClientConfig{
+			HandshakeConfig:  pluginshared.Handshake,
+			Plugins:          map[string]goplugin.Plugin{name: &pluginshared.WrapperPlugin{}},
+			Cmd:              command,
+			AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolGRPC},
+			Logger:           hclog.NewNullLogger(),
+		})
+		testPlugin.plugin, testPlugin.err = grpc.NewPluginClient(testPlugin.client, name)
+	})
+	if testPlugin.err != nil {
+		t.Fatalf("cannot start the plugin: %v", testPlugin.err)
+	}
+	return testPlugin.plugin
+}
+
+// testQual is a qual in a test query, on a key column of the table.
+type testQual struct {
+	column   string
+	operator string
+	// value is a string, a bool, an int, an int64, a float64 or a time.Time
+	value interface{}
+}
+
+// testQuery is a query run against a table, through the same gRPC calls
+// Steampipe makes: the configuration is set on a new connection of the
+// plugin process, so that no clients, settings or lookups are shared with
+// other queries, and the table is queried on it with the quals and limit
+// that Postgres would pass down; the SDK picks the Get call of the table
+// when the quals are on all its required key columns, as with a real query.
+type testQuery struct {
+	table   *plugin.Table
+	config  openstackConfig
+	columns []string
+	quals   []testQual
+	limit   *int64
+}
+
+// testRow maps the requested columns to their values in a row: strings,
+// bools, int64s, float64s, time.Times (in UTC) and, for JSON columns, the
+// values encoding/json decodes them into.
+type testRow map[string]interface{}
+
+// testTable returns the table with the given name, as registered in the plugin.
+func testTable(name string) *plugin.Table {
+	return Plugin(testContext()).TableMap[name]
+}
+
+// testConfig returns the configuration of a connection to the fake cloud.
+func testConfig(cloud *fakeCloud) openstackConfig {
+	return openstackConfig{
+		EndpointUrl:       utils.PointerTo(cloud.URL + "/identity/v3"),
+		Username:          utils.PointerTo("admin"),
+		Password:          utils.PointerTo("secret"),
+		ProjectName:       utils.PointerTo("admin"),
+		DomainName:        utils.PointerTo("Default"),
+		Region:            utils.PointerTo("RegionOne"),
+		IgnoreEnvironment: utils.PointerTo(true),
+		MaxRetries:        utils.PointerTo(0),
+	}
+}
+
+// run runs the query and returns the rows, failing the test on errors.
+func (q testQuery) run(t *testing.T) []testRow {
+	t.Helper()
+	rows, err := q.execute(t)
+	if err != nil {
+		t.Fatalf("query on %s failed: %v", q.table.Name, err)
+	}
+	return rows
+}
+
+// execute runs the query and returns the rows, or the first error.
+func (q testQuery) execute(t *testing.T) ([]testRow, error) {
+	t.Helper()
+	client := startTestPlugin(t)
+	connection := fmt.Sprintf("openstack_test_%d", atomic.AddInt64(&testPlugin.connections, 1))
+	err := client.SetAllConnectionConfigs(&proto.SetAllConnectionConfigsRequest{
+		Configs: []*proto.ConnectionConfig{{
+			Connection: connection,
+			Plugin:     client.Name,
+			Config:     toTestConfigHCL(q.config),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("cannot set the connection configuration: %v", err)
+	}
+
+	columns := q.columns
+	if len(columns) == 0 {
+		for _, column := range q.table.Columns {
+			columns = append(columns, column.Name)
+		}
+	}
+	data := &proto.ExecuteConnectionData{}
+	if q.limit != nil {
+		data.Limit = &proto.NullableInt{Value: *q.limit}
+	}
+	stream, _, cancel, err := client.Execute(&proto.ExecuteRequest{
+		Table:                 q.table.Name,
+		QueryContext:          &proto.QueryContext{Columns: columns, Quals: q.toProtoQuals(t)},
+		CallId:                connection,
+		ExecuteConnectionData: map[string]*proto.ExecuteConnectionData{connection: data},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	rows := []testRow{}
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if response.Row == nil {
+			continue
+		}
+		// the SDK may stream more columns than requested (e.g. _ctx), which
+		// Postgres would drop
+		row := testRow{}
+		for _, name := range columns {
+			if row[name], err = toTestValue(response.Row.Columns[name]); err != nil {
+				t.Fatalf("column %s: %v", name, err)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// toProtoQuals returns the quals of the query as Postgres would pass them
+// down, making sure that they are on key columns of the table and with
+// supported operators.
+func (q testQuery) toProtoQuals(t *testing.T) map[string]*proto.Quals {
+	t.Helper()
+	keyColumns := plugin.KeyColumnSlice{}
+	if q.table.Get != nil {
+		keyColumns = append(keyColumns, q.table.Get.KeyColumns...)
+	}
+	if q.table.List != nil {
+		keyColumns = append(keyColumns, q.table.List.KeyColumns...)
+	}
+	quals := map[string]*proto.Quals{}
+	for _, qual := range q.quals {
+		if !supportsQual(keyColumns, qual) {
+			t.Fatalf("%s does not support qual %s %s", q.table.Name, qual.column, qual.operator)
+		}
+		if quals[qual.column] == nil {
+			quals[qual.column] = &proto.Quals{}
+		}
+		quals[qual.column].Quals = append(quals[qual.column].Quals, &proto.Qual{
+			FieldName: qual.column,
+			Operator:  &proto.Qual_StringValue{StringValue: qual.operator},
+			Value:     toTestQualValue(t, qual.value),
+		})
+	}
+	return quals
+}
+
+// supportsQual returns whether a key column accepts the qual.
+func supportsQual(keyColumns plugin.KeyColumnSlice, qual testQual) bool {
+	for _, keyColumn := range keyColumns {
+		if keyColumn.Name != qual.column {
+			continue
+		}
+		operators := keyColumn.Operators
+		if len(operators) == 0 {
+			operators = []string{"="}
+		}
+		for _, operator := range operators {
+			if operator == qual.operator {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toTestQualValue(t *testing.T, value interface{}) *proto.QualValue {
+	switch v := value.(type) {
+	case string:
+		return &proto.QualValue{Value: &proto.QualValue_StringValue{StringValue: v}}
+	case bool:
+		return &proto.QualValue{Value: &proto.QualValue_BoolValue{BoolValue: v}}
+	case int:
+		return &proto.QualValue{Value: &proto.QualValue_Int64Value{Int64Value: int64(v)}}
+	case int64:
+		return &proto.QualValue{Value: &proto.QualValue_Int64Value{Int64Value: v}}
+	case float64:
+		return &proto.QualValue{Value: &proto.QualValue_DoubleValue{DoubleValue: v}}
+	case time.Time:
+		return &proto.QualValue{Value: &proto.QualValue_TimestampValue{TimestampValue: timestamppb.New(v)}}
+	}
+	t.Fatalf("unsupported qual value %v", value)
+	return nil
+}
+
+// toTestValue returns the value of a column streamed by the plugin.
+func toTestValue(column *proto.Column) (interface{}, error) {
+	if column == nil {
+		return nil, fmt.Errorf("column not streamed")
+	}
+	switch v := column.Value.(type) {
+	case *proto.Column_NullValue:
+		return nil, nil
+	case *proto.Column_StringValue:
+		return v.StringValue, nil
+	case *proto.Column_BoolValue:
+		return v.BoolValue, nil
+	case *proto.Column_IntValue:
+		return v.IntValue, nil
+	case *proto.Column_DoubleValue:
+		return v.DoubleValue, nil
+	case *proto.Column_TimestampValue:
+		return v.TimestampValue.AsTime(), nil
+	case *proto.Column_IpAddrValue:
+		return v.IpAddrValue, nil
+	case *proto.Column_CidrRangeValue:
+		return v.CidrRangeValue, nil
+	case *proto.Column_LtreeValue:
+		return v.LtreeValue, nil
+	case *proto.Column_JsonValue:
+		var value interface{}
+		err := json.Unmarshal(v.JsonValue, &value)
+		return value, err
+	}
+	return nil, fmt.Errorf("unsupported column value %v", column)
+}
+
+// toTestConfigHCL returns the configuration as the body of the connection
+// block Steampipe would read it from.
+func toTestConfigHCL(config openstackConfig) string {
+	quote := func(s string) string {
+		// HCL strings are Go-like, but for their templates
+		return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(strconv.Quote(s))
+	}
+	lines := []string{}
+	value := reflect.ValueOf(config)
+	for i := 0; i < value.NumField(); i++ {
+		name, field := value.Type().Field(i).Tag.Get("cty"), value.Field(i)
+		if name == "" || field.IsNil() {
+			continue
+		}
+		switch v := field.Elem().Interface().(type) {
+		case string:
+			lines = append(lines, fmt.Sprintf("%s = %s", name, quote(v)))
+		case []string:
+			items := []string{}
+			for _, item := range v {
+				items = append(items, quote(item))
+			}
+			lines = append(lines, fmt.Sprintf("%s = [%s]", name, strings.Join(items, ", ")))
+		default:
+			lines = append(lines, fmt.Sprintf("%s = %v", name, v))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
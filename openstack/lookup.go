@@ -0,0 +1,220 @@
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// DefaultLookupTTL is how long resolved names are cached by default.
+const DefaultLookupTTL = 5 * time.Minute
+
+// lookupKind is a kind of resources whose names can be resolved from their
+// IDs through the lookup cache.
+type lookupKind string
+
+const (
+	projectLookup       lookupKind = "projects"
+	userLookup          lookupKind = "users"
+	networkLookup       lookupKind = "networks"
+	imageLookup         lookupKind = "images"
+	flavorLookup        lookupKind = "flavors"
+	securityGroupLookup lookupKind = "security_groups"
+)
+
+// lookupServices maps each kind of resources to the service that lists them.
+var lookupServices = map[lookupKind]ServiceType{
+	projectLookup:       IdentityV3,
+	userLookup:          IdentityV3,
+	networkLookup:       NetworkV2,
+	imageLookup:         ImageServiceV2,
+	flavorLookup:        ComputeV2,
+	securityGroupLookup: NetworkV2,
+}
+
+// imageVisibilityAll has Glance list the images of any visibility, the
+// community ones included.
+const imageVisibilityAll images.ImageVisibility = "all"
+
+// lookupLocks holds a mutex per lookup cache key, so that concurrent
+// hydrate calls needing the same names list the resources only once.
+var lookupLocks sync.Map
+
+// lookupName returns the name of the resource of the given kind with the
+// given ID, or nil if there is no such resource (or it is not visible).
+func lookupName(ctx context.Context, d *plugin.QueryData, kind lookupKind, id string) (interface{}, error) {
+	if id == "" {
+		return nil, nil
+	}
+	names, err := getLookup(ctx, d, kind)
+	if err != nil {
+		return nil, err
+	}
+	if name, ok := names[id]; ok {
+		return name, nil
+	}
+	return nil, nil
+}
+
+// getLookup returns the names of all the resources of the given kind, by
+// ID, in the region of the current hydrate call; they are listed once and
+// cached for the lookup_ttl. Resources the user has no access to are not
+// resolved, rather than failing the query.
+func getLookup(ctx context.Context, d *plugin.QueryData, kind lookupKind) (map[string]string, error) {
+	settings, err := getConnectionSettings(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("openstack_lookup/%s/%s", kind, getQueryRegion(ctx, settings, lookupServices[kind]))
+	if cachedData, ok := d.ConnectionManager.Cache.Get(key); ok {
+		return cachedData.(map[string]string), nil
+	}
+
+	value, _ := lookupLocks.LoadOrStore(d.Connection.Name+"/"+key, &sync.Mutex{})
+	lock := value.(*sync.Mutex)
+	lock.Lock()
+	defer lock.Unlock()
+	if cachedData, ok := d.ConnectionManager.Cache.Get(key); ok {
+		return cachedData.(map[string]string), nil
+	}
+
+	ttl, err := getLookupTTL(d)
+	if err != nil {
+		return nil, err
+	}
+	names, err := listNames(ctx, d, kind)
+	if isForbiddenError(err) {
+		logger(ctx).Warn("listing resources for name lookup forbidden, names will not be resolved", "kind", kind, "error", err)
+		names, err = map[string]string{}, nil
+	}
+	if err != nil {
+		logger(ctx).Error("error listing resources for name lookup", "kind", kind, "error", err)
+		return nil, err
+	}
+	logger(ctx).Debug("names retrieved for lookup", "kind", kind, "count", len(names))
+
+	d.ConnectionManager.Cache.SetWithTTL(key, names, ttl)
+	return names, nil
+}
+
+// listNames lists the resources of the given kind and maps their IDs to
+// their names.
+func listNames(ctx context.Context, d *plugin.QueryData, kind lookupKind) (map[string]string, error) {
+	names := map[string]string{}
+	if kind == projectLookup {
+		allProjects, err := getProjects(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		for _, project := range allProjects {
+			names[project.ID] = project.Name
+		}
+		return names, nil
+	}
+	if kind == userLookup {
+		allUsers, err := getUsers(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range allUsers {
+			names[user.ID] = user.Name
+		}
+		return names, nil
+	}
+
+	client, err := getServiceClient(ctx, d, lookupServices[kind])
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+	var pager pagination.Pager
+	var extract func(page pagination.Page) error
+	switch kind {
+	case networkLookup:
+		pager = networks.List(client, networkListOpts{Fields: []string{"id", "name"}})
+		extract = func(page pagination.Page) error {
+			allNetworks, err := networks.ExtractNetworks(page)
+			for _, network := range allNetworks {
+				names[network.ID] = network.Name
+			}
+			return err
+		}
+	case imageLookup:
+		// the default list of Glance leaves out the community images, and
+		// every list but those asking for them the hidden ones
+		extract = func(page pagination.Page) error {
+			allImages, err := images.ExtractImages(page)
+			for _, image := range allImages {
+				names[image.ID] = image.Name
+			}
+			return err
+		}
+		opts := images.ListOpts{Limit: DefaultPageSize, Visibility: imageVisibilityAll, Hidden: true}
+		if err = images.List(client, opts).EachPage(eachNamesPage(ctx, extract)); err != nil {
+			return nil, err
+		}
+		opts.Hidden = false
+		pager = images.List(client, opts)
+	case flavorLookup:
+		pager = flavors.ListDetail(client, flavors.ListOpts{AccessType: flavors.AllAccess})
+		extract = func(page pagination.Page) error {
+			allFlavors, err := flavors.ExtractFlavors(page)
+			for _, flavor := range allFlavors {
+				names[flavor.ID] = flavor.Name
+			}
+			return err
+		}
+	case securityGroupLookup:
+		pager = listSecurityGroups(client, groups.ListOpts{}, []string{"id", "name"})
+		extract = func(page pagination.Page) error {
+			allGroups, err := groups.ExtractGroups(page)
+			for _, group := range allGroups {
+				names[group.ID] = group.Name
+			}
+			return err
+		}
+	default:
+		return nil, fmt.Errorf("invalid lookup kind %q", kind)
+	}
+	if err = pager.EachPage(eachNamesPage(ctx, extract)); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// eachNamesPage returns the function extracting the names from each page of
+// a list, which fails with the error of the context once the query is done:
+// a list that was not walked to the end must never be cached.
+func eachNamesPage(ctx context.Context, extract func(page pagination.Page) error) func(page pagination.Page) (bool, error) {
+	return func(page pagination.Page) (bool, error) {
+		if err := extract(page); err != nil {
+			return false, err
+		}
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+}
+
+// getLookupTTL returns how long resolved names are cached, as per the
+// lookup_ttl option (or its default).
+func getLookupTTL(d *plugin.QueryData) (time.Duration, error) {
+	config := GetConfig(d.Connection)
+	if config.LookupTTL == nil {
+		return DefaultLookupTTL, nil
+	}
+	ttl, err := time.ParseDuration(*config.LookupTTL)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid lookup_ttl %q: must be a positive duration", *config.LookupTTL)
+	}
+	return ttl, nil
+}
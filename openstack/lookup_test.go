@@ -0,0 +1,56 @@
+package openstack
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+	"github.com/gophercloud/gophercloud/pagination"
+)
+
+func TestLookupTTL(t *testing.T) {
+	tests := []struct {
+		value *string
+		ttl   time.Duration
+		err   bool
+	}{
+		{nil, DefaultLookupTTL, false},
+		{utils.PointerTo("30s"), 30 * time.Second, false},
+		{utils.PointerTo("1h"), time.Hour, false},
+		{utils.PointerTo("0s"), 0, true},
+		{utils.PointerTo("soon"), 0, true},
+	}
+	for i, test := range tests {
+		ttl, err := getLookupTTL(testQueryData(openstackConfig{LookupTTL: test.value}))
+		if (err != nil) != test.err {
+			t.Errorf("test %d: unexpected error %v", i, err)
+		}
+		if ttl != test.ttl {
+			t.Errorf("test %d: expected %s, got %s", i, test.ttl, ttl)
+		}
+	}
+}
+
+func TestEachNamesPage(t *testing.T) {
+	pages := 0
+	extract := func(page pagination.Page) error {
+		pages++
+		return nil
+	}
+	if more, err := eachNamesPage(testContext(), extract)(nil); !more || err != nil {
+		t.Errorf("expected the next page, got %t, %v", more, err)
+	}
+
+	// a cancelled query stops the list with an error, so that the names
+	// listed so far are not cached as if they were all of them
+	ctx, cancel := context.WithCancel(testContext())
+	cancel()
+	if more, err := eachNamesPage(ctx, extract)(nil); more || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the list to fail, got %t, %v", more, err)
+	}
+	if pages != 2 {
+		t.Errorf("expected 2 pages extracted, got %d", pages)
+	}
+}
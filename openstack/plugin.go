@@ -7,21 +7,42 @@ import (
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
 )
 
+// Version is the plugin version, as reported in the User-Agent header; it is
+// set at build time.
+var Version = "dev"
+
 func Plugin(ctx context.Context) *plugin.Plugin {
 	p := &plugin.Plugin{
 		Name:             "steampipe-plugin-openstack",
 		DefaultTransform: transform.FromGo().NullIfZero(),
+		// transient errors are retried by the HTTP client first; Get and
+		// column hydrate functions get a further chance here
+		DefaultRetryConfig: &plugin.RetryConfig{
+			ShouldRetryErrorFunc: shouldRetryError,
+			MaxAttempts:          3,
+			BackoffAlgorithm:     "Exponential",
+			RetryInterval:        1000,
+			CappedDuration:       30000,
+		},
 		TableMap: map[string]*plugin.Table{
-			"openstack_instance":            tableOpenStackInstance(ctx),
-			"openstack_project":             tableOpenStackProject(ctx),
-			"openstack_user":                tableOpenStackUser(ctx),
-			"openstack_port":                tableOpenStackPort(ctx),
-			"openstack_volume":              tableOpenStackVolume(ctx),
-			"openstack_attachment":          tableOpenStackAttachment(ctx),
-			"openstack_image":               tableOpenStackImage(ctx),
-			"openstack_security_group":      tableOpenStackSecurityGroup(ctx),
-			"openstack_security_group_rule": tableOpenStackSecurityGroupRule(ctx),
-			"openstack_network":             tableOpenStackNetwork(ctx),
+			"openstack_instance":                  tableOpenStackInstance(ctx),
+			"openstack_project":                   tableOpenStackProject(ctx),
+			"openstack_user":                      tableOpenStackUser(ctx),
+			"openstack_port":                      tableOpenStackPort(ctx),
+			"openstack_volume":                    tableOpenStackVolume(ctx),
+			"openstack_attachment":                tableOpenStackAttachment(ctx),
+			"openstack_image":                     tableOpenStackImage(ctx),
+			"openstack_security_group":            tableOpenStackSecurityGroup(ctx),
+			"openstack_security_group_rule":       tableOpenStackSecurityGroupRule(ctx),
+			"openstack_network":                   tableOpenStackNetwork(ctx),
+			"openstack_flavor":                    tableOpenStackFlavor(ctx),
+			"openstack_flavor_access":             tableOpenStackFlavorAccess(ctx),
+			"openstack_hypervisor":                tableOpenStackHypervisor(ctx),
+			"openstack_hypervisor_instance":       tableOpenStackHypervisorInstance(ctx),
+			"openstack_server_group":              tableOpenStackServerGroup(ctx),
+			"openstack_keypair":                   tableOpenStackKeyPair(ctx),
+			"openstack_aggregate":                 tableOpenStackAggregate(ctx),
+			"openstack_compute_availability_zone": tableOpenStackComputeAvailabilityZone(ctx),
 		},
 		ConnectionConfigSchema: &plugin.ConnectionConfigSchema{
 			NewInstance: ConfigInstance,
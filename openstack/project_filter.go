@@ -0,0 +1,283 @@
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/domains"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/projects"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/users"
+	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+const (
+	// AllowedProjects is the cache key for the projects the connection is
+	// restricted to.
+	AllowedProjects = "openstack_allowed_projects"
+	// Projects is the cache key for the list of all the projects in Keystone.
+	Projects = "openstack_projects"
+	// Users is the cache key for the list of all the users in Keystone.
+	Users = "openstack_users"
+)
+
+// getProjects returns all the projects in Keystone; the list is retrieved
+// once per connection, cached for the lookup_ttl and shared by all the
+// tables that need it.
+func getProjects(ctx context.Context, d *plugin.QueryData) ([]projects.Project, error) {
+	if cachedData, ok := d.ConnectionManager.Cache.Get(Projects); ok {
+		return cachedData.([]projects.Project), nil
+	}
+
+	ttl, err := getLookupTTL(d)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := getServiceClient(ctx, d, IdentityV3)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+	allPages, err := projects.List(client, projects.ListOpts{}).AllPages()
+	if err != nil {
+		logger(ctx).Error("error listing projects", "error", err)
+		return nil, err
+	}
+	allProjects, err := projects.ExtractProjects(allPages)
+	if err != nil {
+		logger(ctx).Error("error extracting projects", "error", err)
+		return nil, err
+	}
+	logger(ctx).Debug("projects retrieved", "count", len(allProjects))
+
+	d.ConnectionManager.Cache.SetWithTTL(Projects, allProjects, ttl)
+	return allProjects, nil
+}
+
+// getUsers returns all the users in Keystone; like the projects, the list is
+// retrieved once per connection, cached for the lookup_ttl and shared by all
+// the tables that need it.
+func getUsers(ctx context.Context, d *plugin.QueryData) ([]users.User, error) {
+	if cachedData, ok := d.ConnectionManager.Cache.Get(Users); ok {
+		return cachedData.([]users.User), nil
+	}
+
+	ttl, err := getLookupTTL(d)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := getServiceClient(ctx, d, IdentityV3)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+	allPages, err := users.List(client, users.ListOpts{}).AllPages()
+	if err != nil {
+		logger(ctx).Error("error listing users", "error", err)
+		return nil, err
+	}
+	allUsers, err := users.ExtractUsers(allPages)
+	if err != nil {
+		logger(ctx).Error("error extracting users", "error", err)
+		return nil, err
+	}
+	logger(ctx).Debug("users retrieved", "count", len(allUsers))
+
+	d.ConnectionManager.Cache.SetWithTTL(Users, allUsers, ttl)
+	return allUsers, nil
+}
+
+// allowedProjects is the set of the IDs of the projects the connection is
+// restricted to by the include_projects, exclude_projects and
+// include_domains options; nil means that the connection is unrestricted.
+type allowedProjects map[string]struct{}
+
+// getAllowedProjects returns the projects the connection is restricted to,
+// or nil if none of the restricting options is set; the projects are
+// resolved listing all the projects in Keystone (or, if that is forbidden,
+// the projects of the current user) and cached for the lookup_ttl, like the
+// project list itself.
+func getAllowedProjects(ctx context.Context, d *plugin.QueryData) (allowedProjects, error) {
+	config := GetConfig(d.Connection)
+	include, exclude, includeDomains := toPatterns(config.IncludeProjects), toPatterns(config.ExcludeProjects), toPatterns(config.IncludeDomains)
+	if len(include) == 0 && len(exclude) == 0 && len(includeDomains) == 0 {
+		return nil, nil
+	}
+	if cachedData, ok := d.ConnectionManager.Cache.Get(AllowedProjects); ok {
+		return cachedData.(allowedProjects), nil
+	}
+	ttl, err := getLookupTTL(d)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := getServiceClient(ctx, d, IdentityV3)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	domainNames := map[string]string{}
+	if len(includeDomains) > 0 {
+		err := domains.List(client, domains.ListOpts{}).EachPage(func(page pagination.Page) (bool, error) {
+			allDomains, err := domains.ExtractDomains(page)
+			if err != nil {
+				return false, err
+			}
+			for _, domain := range allDomains {
+				domainNames[domain.ID] = domain.Name
+			}
+			return true, nil
+		})
+		if isForbiddenError(err) {
+			// the names are then retrieved one by one, for the domains of
+			// the projects
+			logger(ctx).Warn("listing domains forbidden, retrieving the domains of the projects", "error", err)
+			err = nil
+		}
+		if err != nil {
+			logger(ctx).Error("error listing domains", "error", err)
+			return nil, err
+		}
+	}
+
+	allProjects, err := getProjects(ctx, d)
+	if isForbiddenError(err) {
+		// only the projects the current user is a member of
+		logger(ctx).Warn("listing projects forbidden, restricting to the projects of the current user", "error", err)
+		var userID string
+		if _, userID, err = getTokenScope(ctx, d); err == nil {
+			var allPages pagination.Page
+			if allPages, err = users.ListProjects(client, userID).AllPages(); err == nil {
+				allProjects, err = projects.ExtractProjects(allPages)
+			}
+		}
+	}
+	if err != nil {
+		logger(ctx).Error("error listing projects", "error", err)
+		return nil, err
+	}
+
+	if len(includeDomains) > 0 {
+		if err = getDomainNames(ctx, client, allProjects, includeDomains, domainNames); err != nil {
+			logger(ctx).Error("error retrieving domains", "error", err)
+			return nil, err
+		}
+	}
+
+	allowed := allowedProjects{}
+	for _, project := range allProjects {
+		if len(include) > 0 && !matchAny(include, project.ID, project.Name) {
+			continue
+		}
+		if len(includeDomains) > 0 && !matchAny(includeDomains, project.DomainID, domainNames[project.DomainID]) {
+			continue
+		}
+		if matchAny(exclude, project.ID, project.Name) {
+			continue
+		}
+		allowed[project.ID] = struct{}{}
+	}
+	logger(ctx).Debug("connection restricted to projects", "count", len(allowed), "projects", toRedactedJSON(allowed))
+
+	d.ConnectionManager.Cache.SetWithTTL(AllowedProjects, allowed, ttl)
+	return allowed, nil
+}
+
+// getDomainNames adds the names of the domains of the projects that were
+// not listed to domainNames, retrieving each domain; if that is forbidden
+// too, the domains can only be matched by ID, so patterns that are not the
+// ID of any of those domains make it fail rather than match nothing.
+func getDomainNames(ctx context.Context, client *gophercloud.ServiceClient, allProjects []projects.Project, patterns []string, domainNames map[string]string) error {
+	unresolved := map[string]struct{}{}
+	for _, project := range allProjects {
+		if _, ok := domainNames[project.DomainID]; ok {
+			continue
+		}
+		if _, ok := unresolved[project.DomainID]; ok {
+			continue
+		}
+		domain, err := domains.Get(client, project.DomainID).Extract()
+		if isForbiddenError(err) {
+			logger(ctx).Warn("retrieving domain forbidden, it can only be matched by ID", "domain", project.DomainID, "error", err)
+			unresolved[project.DomainID] = struct{}{}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		domainNames[domain.ID] = domain.Name
+	}
+	if len(unresolved) == 0 {
+		return nil
+	}
+	for _, pattern := range patterns {
+		if _, ok := unresolved[pattern]; ok {
+			continue
+		}
+		if _, ok := domainNames[pattern]; ok {
+			continue
+		}
+		return fmt.Errorf("invalid include_domains pattern %q: the names of some domains cannot be retrieved, so domains must be given by ID", pattern)
+	}
+	return nil
+}
+
+// contains returns whether the connection may return the resources of the
+// given project.
+func (a allowedProjects) contains(projectID string) bool {
+	if a == nil {
+		return true
+	}
+	_, ok := a[projectID]
+	return ok
+}
+
+// restrict pushes the restriction down to the project filter of a List
+// call: if the filter is already set, it returns whether the project is
+// allowed (if not, there is no need to make the call); otherwise, if only
+// one project is allowed, it sets the filter to it. In all other cases,
+// resources must be filtered client-side with contains.
+func (a allowedProjects) restrict(filter *string) bool {
+	if a == nil {
+		return true
+	}
+	if *filter != "" {
+		return a.contains(*filter)
+	}
+	switch len(a) {
+	case 0:
+		return false
+	case 1:
+		for projectID := range a {
+			*filter = projectID
+		}
+	}
+	return true
+}
+
+// matchAny returns whether the ID or the name match any of the patterns,
+// which are either IDs or name globs.
+func matchAny(patterns []string, id string, name string) bool {
+	for _, pattern := range patterns {
+		if pattern == id {
+			return true
+		}
+		if ok, err := path.Match(pattern, name); err == nil && ok && name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// toPatterns returns the values of a list option, or nil if unset.
+func toPatterns(values *[]string) []string {
+	if values == nil {
+		return nil
+	}
+	return *values
+}
@@ -0,0 +1,51 @@
+package openstack
+
+import "testing"
+
+func TestAllowedProjects(t *testing.T) {
+	var unrestricted allowedProjects
+	filter := ""
+	if !unrestricted.contains("any") || !unrestricted.restrict(&filter) || filter != "" {
+		t.Errorf("a nil set must not restrict anything")
+	}
+
+	single := allowedProjects{"p1": {}}
+	if !single.restrict(&filter) || filter != "p1" {
+		t.Errorf("a single allowed project must be pushed down, got %q", filter)
+	}
+	filter = "p2"
+	if single.restrict(&filter) {
+		t.Errorf("a filter on a project that is not allowed must skip the call")
+	}
+
+	filter = ""
+	if (allowedProjects{}).restrict(&filter) {
+		t.Errorf("an empty set must skip the call")
+	}
+	several := allowedProjects{"p1": {}, "p2": {}}
+	if !several.restrict(&filter) || filter != "" {
+		t.Errorf("several allowed projects must be filtered client-side")
+	}
+	if !several.contains("p2") || several.contains("p3") {
+		t.Errorf("unexpected client-side filtering")
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	patterns := []string{"0123456789abcdef", "prod-*"}
+	tests := []struct {
+		id    string
+		name  string
+		match bool
+	}{
+		{"0123456789abcdef", "whatever", true},
+		{"fedcba9876543210", "prod-web", true},
+		{"fedcba9876543210", "test-web", false},
+		{"fedcba9876543210", "", false},
+	}
+	for _, test := range tests {
+		if match := matchAny(patterns, test.id, test.name); match != test.match {
+			t.Errorf("%s/%s: expected %t, got %t", test.id, test.name, test.match, match)
+		}
+	}
+}
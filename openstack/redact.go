@@ -0,0 +1,220 @@
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// redactedValue replaces sensitive values in the log output.
+const redactedValue = "********"
+
+// minSecretLength is the minimum length of a registered secret; shorter
+// values would cause too many false positives when scrubbing log messages.
+const minSecretLength = 4
+
+// sensitiveKeys is the set of (normalised) field names, both in connection
+// settings and in OpenStack resources, whose values must never be logged;
+// names are normalised by lower-casing them and dropping any character that
+// is not a letter or a digit, so "app_credential_secret", "AppCredentialSecret"
+// and "app-credential-secret" all match the same entry.
+var sensitiveKeys = map[string]struct{}{
+	"password":                    {},
+	"appcredentialsecret":         {},
+	"applicationcredentialsecret": {},
+	"accesstoken":                 {},
+	"token":                       {},
+	"tokenid":                     {},
+	"authtoken":                   {},
+	"xauthtoken":                  {},
+	"xsubjecttoken":               {},
+	"secret":                      {},
+	"adminpass":                   {},
+	"userdata":                    {},
+	"osextsrvattruserdata":        {},
+	"connectioninfo":              {},
+	"keyring":                     {},
+	"extraheaders":                {},
+}
+
+// secrets holds the actual secret values known to the plugin (passwords,
+// application credential secrets, tokens), which are scrubbed from every log
+// message regardless of where they appear.
+var secrets = struct {
+	sync.RWMutex
+	values map[string]struct{}
+}{
+	values: map[string]struct{}{},
+}
+
+// registerSecrets adds the given values to the set of secrets that must be
+// scrubbed from the log output.
+func registerSecrets(values ...string) {
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, value := range values {
+		if len(value) >= minSecretLength {
+			secrets.values[value] = struct{}{}
+		}
+	}
+}
+
+// scrubSecrets replaces any registered secret in s with the redacted value.
+func scrubSecrets(s string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	for secret := range secrets.values {
+		s = strings.ReplaceAll(s, secret, redactedValue)
+	}
+	return s
+}
+
+// isSensitiveKey returns whether the given field name is known to hold
+// sensitive data.
+func isSensitiveKey(key string) bool {
+	normalised := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, key)
+	_, ok := sensitiveKeys[normalised]
+	return ok
+}
+
+// toRedactedJSON dumps the input object to indented JSON, masking the values
+// of all sensitive fields at any depth; it must be used instead of a plain
+// JSON dump whenever an object is logged.
+func toRedactedJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return ""
+	}
+	data, err = json.MarshalIndent(redactValue(generic), "", "  ")
+	if err != nil {
+		return ""
+	}
+	return scrubSecrets(string(data))
+}
+
+// redactValue walks a generic JSON value, masking sensitive fields.
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if isSensitiveKey(key) && value != nil && value != "" {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactValue(value)
+			}
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// redactArgs returns a copy of the key/value pairs in args where the values
+// of sensitive keys are masked, registered secrets are scrubbed from strings
+// and errors, and complex values are dumped as redacted JSON.
+func redactArgs(args []any) []any {
+	result := make([]any, len(args))
+	for i, arg := range args {
+		if i%2 == 1 {
+			if key, ok := args[i-1].(string); ok && isSensitiveKey(key) && arg != nil {
+				result[i] = redactedValue
+				continue
+			}
+		}
+		switch arg := arg.(type) {
+		case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			result[i] = arg
+		case string:
+			result[i] = scrubSecrets(arg)
+		case error:
+			result[i] = scrubSecrets(arg.Error())
+		case fmt.Stringer:
+			result[i] = scrubSecrets(arg.String())
+		default:
+			if value := reflect.ValueOf(arg); value.Kind() == reflect.String {
+				result[i] = scrubSecrets(value.String())
+			} else {
+				result[i] = toRedactedJSON(arg)
+			}
+		}
+	}
+	return result
+}
+
+// redactingLogger is an hclog.Logger that redacts sensitive information
+// from messages and arguments before handing them to the wrapped logger.
+type redactingLogger struct {
+	hclog.Logger
+}
+
+// newRedactingLogger wraps the given logger so that it never outputs any
+// sensitive information.
+func newRedactingLogger(l hclog.Logger) hclog.Logger {
+	if _, ok := l.(*redactingLogger); ok {
+		return l
+	}
+	return &redactingLogger{Logger: l}
+}
+
+// logger returns the plugin logger, wrapped so that it redacts sensitive
+// information; all logging in this package must go through it.
+func logger(ctx context.Context) hclog.Logger {
+	return newRedactingLogger(plugin.Logger(ctx))
+}
+
+func (l *redactingLogger) Log(level hclog.Level, msg string, args ...any) {
+	l.Logger.Log(level, scrubSecrets(msg), redactArgs(args)...)
+}
+
+func (l *redactingLogger) Trace(msg string, args ...any) {
+	l.Logger.Trace(scrubSecrets(msg), redactArgs(args)...)
+}
+
+func (l *redactingLogger) Debug(msg string, args ...any) {
+	l.Logger.Debug(scrubSecrets(msg), redactArgs(args)...)
+}
+
+func (l *redactingLogger) Info(msg string, args ...any) {
+	l.Logger.Info(scrubSecrets(msg), redactArgs(args)...)
+}
+
+func (l *redactingLogger) Warn(msg string, args ...any) {
+	l.Logger.Warn(scrubSecrets(msg), redactArgs(args)...)
+}
+
+func (l *redactingLogger) Error(msg string, args ...any) {
+	l.Logger.Error(scrubSecrets(msg), redactArgs(args)...)
+}
+
+func (l *redactingLogger) With(args ...any) hclog.Logger {
+	return newRedactingLogger(l.Logger.With(redactArgs(args)...))
+}
+
+func (l *redactingLogger) Named(name string) hclog.Logger {
+	return newRedactingLogger(l.Logger.Named(name))
+}
+
+func (l *redactingLogger) ResetNamed(name string) hclog.Logger {
+	return newRedactingLogger(l.Logger.ResetNamed(name))
+}
@@ -0,0 +1,87 @@
+package openstack
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestRedactingLoggerHidesConfigSecrets(t *testing.T) {
+	config := openstackConfig{
+		EndpointUrl:         utils.PointerTo("https://keystone.example.com:5000/v3"),
+		Username:            utils.PointerTo("admin"),
+		Password:            utils.PointerTo("pa55w0rd-from-config"),
+		AccessToken:         utils.PointerTo("gAAAAAB-access-token"),
+		AppCredentialID:     utils.PointerTo("app-credential-id"),
+		AppCredentialSecret: utils.PointerTo("app-credential-s3cr3t"),
+		ExtraHeaders:        &[]string{"X-Gateway-Key: g4t3w4y-k3y"},
+	}
+	secretValues := []string{*config.Password, *config.AccessToken, *config.AppCredentialSecret, "g4t3w4y-k3y"}
+
+	settings, err := resolveConnectionSettings(config, noEnvironment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerConfigSecrets(&config)
+
+	buffer := &bytes.Buffer{}
+	log := newRedactingLogger(hclog.New(&hclog.LoggerOptions{
+		Level:  hclog.Trace,
+		Output: buffer,
+	}))
+
+	log.Info("configuration", "info", toRedactedJSON(settings))
+	log.Debug("raw configuration", "config", config, "settings", settings)
+	log.Debug("secret in message "+*config.Password, "password", *config.Password, "token", config.AccessToken)
+	log.Error("error authenticating", "error", errors.New("invalid secret "+*config.AppCredentialSecret))
+	log.With("secret", *config.AppCredentialSecret).Named("child").Warn("derived logger", "value", "x"+*config.Password+"x")
+	log.Log(hclog.Info, "generic", "dump", []string{*config.AccessToken})
+	log.Debug("extra headers", "headers", *config.ExtraHeaders)
+
+	output := buffer.String()
+	for _, secret := range secretValues {
+		if strings.Contains(output, secret) {
+			t.Errorf("secret %q found in log output:\n%s", secret, output)
+		}
+	}
+	if !strings.Contains(output, "admin") || !strings.Contains(output, redactedValue) {
+		t.Errorf("unexpected log output:\n%s", output)
+	}
+}
+
+func TestToRedactedJSONMasksResourceAttributes(t *testing.T) {
+	instance := &apiInstance{
+		ID:        "instance-id",
+		UserData:  "I2Nsb3VkLWNvbmZpZwpwYXNzd29yZDogZm9v",
+		AdminPass: "initial-admin-pass",
+	}
+	attachment := &apiAttachment{
+		ID: "attachment-id",
+	}
+	attachment.ConnectionInfo.Keyring = "ceph-keyring-content"
+	attachment.ConnectionInfo.AuthUsername = "cinder"
+
+	for _, test := range []struct {
+		value   any
+		visible string
+		hidden  []string
+	}{
+		{instance, "instance-id", []string{instance.UserData, instance.AdminPass}},
+		{attachment, "attachment-id", []string{"ceph-keyring-content", "cinder"}},
+		{&openstackConfig{Username: utils.PointerTo("admin"), ExtraHeaders: &[]string{"Authorization: Bearer h34d3r-t0k3n"}}, "admin", []string{"h34d3r-t0k3n"}},
+	} {
+		output := toRedactedJSON(test.value)
+		if !strings.Contains(output, test.visible) {
+			t.Errorf("expected %q in output:\n%s", test.visible, output)
+		}
+		for _, hidden := range test.hidden {
+			if strings.Contains(output, hidden) {
+				t.Errorf("sensitive value %q found in output:\n%s", hidden, output)
+			}
+		}
+	}
+}
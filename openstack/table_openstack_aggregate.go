@@ -0,0 +1,166 @@
+package openstack
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/aggregates"
+	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableOpenStackAggregate(_ context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:              "openstack_aggregate",
+		Description:       "OpenStack Host Aggregate",
+		GetMatrixItemFunc: regionMatrix(ComputeV2),
+		Columns: []*plugin.Column{
+			{
+				Name:        "id",
+				Type:        proto.ColumnType_INT,
+				Description: "The id of the aggregate.",
+				Transform:   transform.FromField("ID"),
+			},
+			{
+				Name:        "uuid",
+				Type:        proto.ColumnType_STRING,
+				Description: "The unique id of the aggregate (microversion 2.41 and later).",
+				Transform:   transform.FromField("UUID"),
+			},
+			{
+				Name:        "name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the aggregate.",
+				Transform:   transform.FromField("Name"),
+			},
+			{
+				Name:        "availability_zone",
+				Type:        proto.ColumnType_STRING,
+				Description: "The availability zone of the aggregate, as in the availability_zone of the instances on its hosts.",
+				Transform:   transform.FromField("AvailabilityZone"),
+			},
+			{
+				Name:        "hosts",
+				Type:        proto.ColumnType_JSON,
+				Description: "The hosts in the aggregate, as in the host_name of the instances and the service_host of the hypervisors.",
+				Transform:   transform.FromField("Hosts"),
+			},
+			{
+				Name:        "metadata",
+				Type:        proto.ColumnType_JSON,
+				Description: "The metadata of the aggregate, matched against the flavor and image properties by the scheduler.",
+				Transform:   transform.FromField("Metadata"),
+			},
+			{
+				Name:        "created_at",
+				Type:        proto.ColumnType_TIMESTAMP,
+				Description: "When the aggregate was created.",
+				Transform:   transform.FromField("CreatedAt").Transform(ToTime),
+			},
+			{
+				Name:        "updated_at",
+				Type:        proto.ColumnType_TIMESTAMP,
+				Description: "When the aggregate was last updated.",
+				Transform:   transform.FromField("UpdatedAt").Transform(ToTime),
+			},
+			regionColumn(),
+		},
+		List: &plugin.ListConfig{
+			Hydrate: listOpenStackAggregate,
+			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
+			},
+		},
+		Get: &plugin.GetConfig{
+			KeyColumns: plugin.SingleColumn("id"),
+			Hydrate:    getOpenStackAggregate,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
+		},
+	}
+}
+
+//// LIST FUNCTION
+
+func listOpenStackAggregate(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	logger(ctx).Debug("retrieving openstack aggregates list", "query data", toRedactedJSON(d))
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	err = aggregates.List(client).EachPage(func(page pagination.Page) (bool, error) {
+		allAggregates := []*apiAggregate{}
+		if err := page.(aggregates.AggregatesPage).ExtractIntoSlicePtr(&allAggregates, "aggregates"); err != nil {
+			logger(ctx).Error("error extracting aggregates", "error", err)
+			return false, err
+		}
+		logger(ctx).Debug("aggregates retrieved", "count", len(allAggregates))
+
+		for _, aggregate := range allAggregates {
+			if ctx.Err() != nil {
+				logger(ctx).Debug("context done, exit")
+				return false, nil
+			}
+			d.StreamListItem(ctx, aggregate)
+			if d.RowsRemaining(ctx) == 0 {
+				logger(ctx).Debug("row limit reached, exit")
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err = ignoreForbidden(ctx, d, err); err != nil {
+		logger(ctx).Error("error listing aggregates", "error", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+//// HYDRATE FUNCTIONS
+
+func getOpenStackAggregate(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	id := int(d.EqualsQuals["id"].GetInt64Value())
+	logger(ctx).Debug("retrieving openstack aggregate", "id", id)
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	aggregate := &apiAggregate{}
+	if err := aggregates.Get(client, id).ExtractInto(&struct {
+		Aggregate *apiAggregate `json:"aggregate"`
+	}{aggregate}); err != nil {
+		logger(ctx).Error("error retrieving aggregate", "error", err)
+		return nil, err
+	}
+
+	logger(ctx).Debug("returning aggregate", "data", toRedactedJSON(aggregate))
+	return aggregate, nil
+}
+
+// apiAggregate replaces aggregates.Aggregate, which lacks the uuid.
+type apiAggregate struct {
+	ID               int               `json:"id"`
+	UUID             string            `json:"uuid"`
+	Name             string            `json:"name"`
+	AvailabilityZone string            `json:"availability_zone"`
+	Hosts            []string          `json:"hosts"`
+	Metadata         map[string]string `json:"metadata"`
+	CreatedAt        Time              `json:"created_at"`
+	UpdatedAt        Time              `json:"updated_at"`
+}
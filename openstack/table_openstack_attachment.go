@@ -2,10 +2,12 @@ package openstack
 
 import (
 	"context"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
 
-	"github.com/dihedron/steampipe-plugin-utils/utils"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/attachments"
-	"github.com/gophercloud/gophercloud/openstack/identity/v3/projects"
+	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
@@ -15,8 +17,9 @@ import (
 
 func tableOpenStackAttachment(_ context.Context) *plugin.Table {
 	return &plugin.Table{
-		Name:        "openstack_attachment",
-		Description: "OpenStack Disk Volume Attachment",
+		Name:              "openstack_attachment",
+		Description:       "OpenStack Disk Volume Attachment",
+		GetMatrixItemFunc: regionMatrix(BlockStorageV3),
 		Columns: []*plugin.Column{
 			{
 				Name:        "id",
@@ -26,13 +29,13 @@ func tableOpenStackAttachment(_ context.Context) *plugin.Table {
 			},
 			{
 				Name:        "attached_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "When the attachment was created.",
 				Transform:   transform.FromField("AttachedAt").Transform(ToTime),
 			},
 			{
 				Name:        "detached_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "When the attachment was destroyed.",
 				Transform:   transform.FromField("DetachedAt").Transform(ToTime),
 			},
@@ -72,16 +75,25 @@ func tableOpenStackAttachment(_ context.Context) *plugin.Table {
 				Description: "The id of the project the attachment belongs to.",
 				Transform:   transform.FromField("ProjectID"), //FromField("OsVolTenantAttrTenantID"),
 			},
+			{
+				Name:        "project_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the project the attachment belongs to.",
+				Hydrate:     getOpenStackAttachmentProjectName,
+				Transform:   transform.FromValue(),
+			},
 			{
 				Name:        "connection_info",
 				Type:        proto.ColumnType_JSON,
 				Description: "The connection info used for server to connect the volume.",
 				Transform:   transform.FromField("ConnectionInfo"),
 			},
+			regionColumn(),
 		},
 		List: &plugin.ListConfig{
 			Hydrate: listOpenStackAttachment,
 			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
 				&plugin.KeyColumn{
 					Name:    "instance_id",
 					Require: plugin.Optional,
@@ -101,6 +113,8 @@ func tableOpenStackAttachment(_ context.Context) *plugin.Table {
 					Name:    "project_id",
 					Require: plugin.Optional,
 				},
+				timeKeyColumn("attached_at"),
+				timeKeyColumn("detached_at"),
 			},
 		},
 		Get: &plugin.GetConfig{
@@ -115,6 +129,9 @@ func tableOpenStackAttachment(_ context.Context) *plugin.Table {
 					Require: plugin.Optional,
 				},
 			},
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
 		},
 	}
 }
@@ -125,81 +142,121 @@ func listOpenStackAttachment(ctx context.Context, d *plugin.QueryData, h *plugin
 
 	setLogLevel(ctx, d)
 
-	plugin.Logger(ctx).Debug("retrieving openstack attachment list", "query data", utils.ToPrettyJSON(d))
+	logger(ctx).Debug("retrieving openstack attachment list", "query data", toRedactedJSON(d))
 
 	client, err := getServiceClient(ctx, d, BlockStorageV3)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
 	// the OpenStack Cinder v2 API required that the project_id be specified in
 	// the request path; this can be cumbersome when working with SQL, so if the
 	// user did NOT specify the project_id filter, we get a list of all project
-	// IDs and then loop over them all, one by one. Therefore, the filter function
-	// will NOT handle the project_id filter because we set it ourselves.
+	// IDs and then list the attachments of each of them, in parallel.
 	projectIDs := []string{}
 
+	// the attachments API takes no time filters, so quals on time columns
+	// are applied client-side
+	ranges := getTimeRanges(d.Quals, "attached_at", "detached_at")
 	opts := buildOpenStackAttachmentFilter(ctx, d.EqualsQuals)
-	if projectID, ok := d.EqualsQuals["id"]; ok {
+	// the attachments of other projects than the current one are only
+	// returned with all_tenants, as for the volumes
+	allTenants := getAllProjects(d)
+	if projectID, ok := d.EqualsQuals["project_id"]; ok {
 		projectIDs = append(projectIDs, projectID.GetStringValue())
 	} else {
+		err := listWithPolicy(ctx, d, func(scoped bool) error {
+			allTenants = !scoped
+			if scoped {
+				// only the project the connection is scoped to
+				projectID, _, err := getTokenScope(ctx, d)
+				if err != nil {
+					return err
+				}
+				projectIDs = []string{projectID}
+				return nil
+			}
 
-		client, err := getServiceClient(ctx, d, IdentityV3)
-		if err != nil {
-			plugin.Logger(ctx).Error("error retrieving client", "error", err)
-			return nil, err
-		}
-
-		allPages, err := projects.List(client, &projects.ListOpts{}).AllPages()
-		if err != nil {
-			plugin.Logger(ctx).Error("error listing projects", "error", err)
-			return nil, err
-		}
-		allProjects, err := projects.ExtractProjects(allPages)
+			allProjects, err := getProjects(ctx, d)
+			if err != nil {
+				return err
+			}
+			for _, project := range allProjects {
+				projectIDs = append(projectIDs, project.ID)
+			}
+			return nil
+		})
 		if err != nil {
-			plugin.Logger(ctx).Error("error extracting projects", "error", err)
 			return nil, err
 		}
-		plugin.Logger(ctx).Debug("projects retrieved", "count", len(allProjects))
+	}
 
-		for _, project := range allProjects {
-			if ctx.Err() != nil {
-				plugin.Logger(ctx).Debug("context done, exit")
-				break
-			}
-			project := project
-			projectIDs = append(projectIDs, project.ID)
-		}
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
+		return nil, err
 	}
 
+	opts.Limit = getPageSize(ctx, d)
+	allowedIDs := []string{}
 	for _, projectID := range projectIDs {
+		if allowed.contains(projectID) {
+			allowedIDs = append(allowedIDs, projectID)
+		}
+	}
+	err = listInParallel(ctx, d, allowedIDs, func(projectID string) error {
+		opts := opts
 		opts.ProjectID = projectID
-
-		allPages, err := attachments.List(client, opts).AllPages()
+		opts.AllTenants = allTenants
+		err := listOpenStackProjectAttachments(ctx, d, client, opts, ranges)
+		if isForbiddenError(err) || isNotFoundError(err) {
+			// e.g. a project deleted in the meantime, or one whose
+			// attachments the user has no access to
+			logger(ctx).Warn("error listing project attachments, skipping", "project", projectID, "error", err)
+			return nil
+		}
 		if err != nil {
-			plugin.Logger(ctx).Error("error listing attachments with options", "options", utils.ToPrettyJSON(opts), "error", err)
-			return nil, err
+			logger(ctx).Error("error listing attachments with options", "options", toRedactedJSON(opts), "error", err)
 		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// listOpenStackProjectAttachments streams the attachments of the project
+// in the options.
+func listOpenStackProjectAttachments(ctx context.Context, d *plugin.QueryData, client *gophercloud.ServiceClient, opts attachments.ListOpts, ranges timeRanges) error {
+	return attachments.List(client, opts).EachPage(func(page pagination.Page) (bool, error) {
 		allAttachments := []*apiAttachment{}
-		err = attachments.ExtractAttachmentsInto(allPages, &allAttachments)
+		err := attachments.ExtractAttachmentsInto(page, &allAttachments)
 		if err != nil {
-			plugin.Logger(ctx).Error("error extracting attachment", "error", err)
-			return nil, err
+			logger(ctx).Error("error extracting attachment", "error", err)
+			return false, err
 		}
-		plugin.Logger(ctx).Debug("attachment retrieved", "count", len(allAttachments))
+		logger(ctx).Debug("attachment retrieved", "project", opts.ProjectID, "count", len(allAttachments))
 
 		for _, attachment := range allAttachments {
 			if ctx.Err() != nil {
-				plugin.Logger(ctx).Debug("context done, exit")
-				break
+				logger(ctx).Debug("context done, exit")
+				return false, nil
 			}
 			attachment := attachment
-			attachment.ProjectID = projectID
+			if !ranges.match("attached_at", time.Time(attachment.AttachedAt)) || !ranges.match("detached_at", time.Time(attachment.DetachedAt)) {
+				continue
+			}
+			attachment.ProjectID = opts.ProjectID
 			d.StreamListItem(ctx, attachment)
+			if d.RowsRemaining(ctx) == 0 {
+				logger(ctx).Debug("row limit reached, exit")
+				return false, nil
+			}
 		}
-	}
-	return nil, nil
+		return true, nil
+	})
 }
 
 //// HYDRATE FUNCTIONS
@@ -210,21 +267,21 @@ func getOpenStackAttachment(ctx context.Context, d *plugin.QueryData, h *plugin.
 
 	id := d.EqualsQuals["id"].GetStringValue()
 
-	plugin.Logger(ctx).Debug("retrieving openstack attachment", "id", id)
+	logger(ctx).Debug("retrieving openstack attachment", "id", id)
 
 	client, err := getServiceClient(ctx, d, BlockStorageV3)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
 	result := attachments.Get(client, id)
-	//plugin.Logger(ctx).Debug("request run", "result", utils.ToPrettyJSON(result))
+	//logger(ctx).Debug("request run", "result", toRedactedJSON(result))
 
 	attachment := &apiAttachment{}
 	err = result.ExtractInto(attachment)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving attachment", "error", err)
+		logger(ctx).Error("error retrieving attachment", "error", err)
 		return nil, err
 	}
 
@@ -232,12 +289,30 @@ func getOpenStackAttachment(ctx context.Context, d *plugin.QueryData, h *plugin.
 		attachment.ProjectID = value.GetStringValue()
 	}
 
+	// without a project_id qual the project of the attachment is unknown,
+	// so it is not returned if the connection is restricted to some projects
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
+		return nil, err
+	}
+	if !allowed.contains(attachment.ProjectID) {
+		logger(ctx).Debug("project not allowed", "project", attachment.ProjectID)
+		return nil, nil
+	}
+
 	return attachment, nil
 }
+
+// getOpenStackAttachmentProjectName resolves the name of the attachment's project.
+func getOpenStackAttachmentProjectName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	attachment := h.Item.(*apiAttachment)
+	return lookupName(ctx, d, projectLookup, attachment.ProjectID)
+}
+
 func buildOpenStackAttachmentFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap) attachments.ListOpts {
-	opts := attachments.ListOpts{
-		AllTenants: true,
-	}
+	opts := attachments.ListOpts{}
 	if value, ok := quals["instance_id"]; ok {
 		opts.InstanceID = value.GetStringValue()
 	}
@@ -253,7 +328,7 @@ func buildOpenStackAttachmentFilter(ctx context.Context, quals plugin.KeyColumnE
 	if value, ok := quals["project_id"]; ok {
 		opts.ProjectID = value.GetStringValue()
 	}
-	plugin.Logger(ctx).Debug("returning", "filter", utils.ToPrettyJSON(opts))
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
 	return opts
 }
 
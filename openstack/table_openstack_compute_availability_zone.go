@@ -0,0 +1,139 @@
+package openstack
+
+import (
+	"context"
+	"sort"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/availabilityzones"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableOpenStackComputeAvailabilityZone(_ context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:              "openstack_compute_availability_zone",
+		Description:       "OpenStack Compute Availability Zone",
+		GetMatrixItemFunc: regionMatrix(ComputeV2),
+		Columns: []*plugin.Column{
+			{
+				Name:        "zone_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the availability zone, as in the availability_zone of the instances and aggregates.",
+				Transform:   transform.FromField("ZoneName"),
+			},
+			{
+				Name:        "available",
+				Type:        proto.ColumnType_BOOL,
+				Description: "Whether the availability zone is available.",
+				Transform:   transform.FromField("ZoneState.Available"),
+			},
+			{
+				Name:        "hosts",
+				Type:        proto.ColumnType_JSON,
+				Description: "The state of the services on each host of the availability zone, by host and service name (admin only).",
+				Transform:   transform.FromField("Hosts"),
+			},
+			{
+				Name:        "host_names",
+				Type:        proto.ColumnType_JSON,
+				Description: "The names of the hosts in the availability zone, as in the host_name of the instances (admin only).",
+				Transform:   transform.From(availabilityZoneHostNames),
+			},
+			regionColumn(),
+		},
+		List: &plugin.ListConfig{
+			Hydrate: listOpenStackComputeAvailabilityZone,
+			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
+				&plugin.KeyColumn{
+					Name:    "zone_name",
+					Require: plugin.Optional,
+				},
+			},
+		},
+	}
+}
+
+//// LIST FUNCTION
+
+func listOpenStackComputeAvailabilityZone(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	logger(ctx).Debug("retrieving openstack compute availability zones list", "query data", toRedactedJSON(d))
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	// the hosts are only listed in the details, which are reserved to admins
+	// by default; other users get the zones without their hosts
+	page, err := availabilityzones.ListDetail(client).AllPages()
+	if isForbiddenError(err) {
+		logger(ctx).Debug("availability zone details forbidden, listing zones only", "error", err)
+		page, err = availabilityzones.List(client).AllPages()
+	}
+	if err != nil {
+		logger(ctx).Error("error listing availability zones", "error", err)
+		return nil, err
+	}
+	allZones := []*apiAvailabilityZone{}
+	if err := page.(availabilityzones.AvailabilityZonePage).ExtractIntoSlicePtr(&allZones, "availabilityZoneInfo"); err != nil {
+		logger(ctx).Error("error extracting availability zones", "error", err)
+		return nil, err
+	}
+	logger(ctx).Debug("availability zones retrieved", "count", len(allZones))
+
+	for _, zone := range allZones {
+		if ctx.Err() != nil {
+			logger(ctx).Debug("context done, exit")
+			return nil, nil
+		}
+		if value, ok := d.EqualsQuals["zone_name"]; ok && zone.ZoneName != value.GetStringValue() {
+			continue
+		}
+		d.StreamListItem(ctx, zone)
+		if d.RowsRemaining(ctx) == 0 {
+			logger(ctx).Debug("row limit reached, exit")
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+// availabilityZoneHostNames returns the sorted names of the hosts in the
+// availability zone, or nil if they were not listed.
+func availabilityZoneHostNames(_ context.Context, d *transform.TransformData) (interface{}, error) {
+	zone := d.HydrateItem.(*apiAvailabilityZone)
+	if zone.Hosts == nil {
+		return nil, nil
+	}
+	names := []string{}
+	for name := range zone.Hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// apiAvailabilityZone replaces availabilityzones.AvailabilityZone so that
+// the update times of the services are NULL rather than zero when unknown.
+type apiAvailabilityZone struct {
+	ZoneName  string `json:"zoneName"`
+	ZoneState struct {
+		Available bool `json:"available"`
+	} `json:"zoneState"`
+	Hosts map[string]map[string]apiServiceState `json:"hosts"`
+}
+
+// apiServiceState is the state of a service on a host.
+type apiServiceState struct {
+	Active    bool  `json:"active"`
+	Available bool  `json:"available"`
+	UpdatedAt *Time `json:"updated_at"`
+}
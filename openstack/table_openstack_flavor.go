@@ -0,0 +1,365 @@
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableOpenStackFlavor(_ context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:              "openstack_flavor",
+		Description:       "OpenStack Flavor",
+		GetMatrixItemFunc: regionMatrix(ComputeV2),
+		Columns: []*plugin.Column{
+			{
+				Name:        "id",
+				Type:        proto.ColumnType_STRING,
+				Description: "The unique id of the flavor.",
+				Transform:   transform.FromField("ID"),
+			},
+			{
+				Name:        "name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the flavor.",
+				Transform:   transform.FromField("Name"),
+			},
+			{
+				Name:        "description",
+				Type:        proto.ColumnType_STRING,
+				Description: "The description of the flavor (microversion 2.55 and later).",
+				Transform:   transform.FromField("Description"),
+			},
+			{
+				Name:        "vcpus",
+				Type:        proto.ColumnType_INT,
+				Description: "The number of virtual CPUs.",
+				Transform:   transform.FromField("VCPUs"),
+			},
+			{
+				Name:        "ram",
+				Type:        proto.ColumnType_INT,
+				Description: "The amount of memory, in MB.",
+				Transform:   transform.FromField("RAM"),
+			},
+			{
+				Name:        "disk",
+				Type:        proto.ColumnType_INT,
+				Description: "The size of the root disk, in GB.",
+				Transform:   transform.FromField("Disk"),
+			},
+			{
+				Name:        "swap",
+				Type:        proto.ColumnType_INT,
+				Description: "The size of the swap disk, in MB.",
+				Transform:   transform.FromField("Swap"),
+			},
+			{
+				Name:        "ephemeral",
+				Type:        proto.ColumnType_INT,
+				Description: "The size of the ephemeral disk, in GB.",
+				Transform:   transform.FromField("Ephemeral"),
+			},
+			{
+				Name:        "rxtx_factor",
+				Type:        proto.ColumnType_DOUBLE,
+				Description: "The bandwidth scaling factor of the flavor.",
+				Transform:   transform.FromField("RxTxFactor"),
+			},
+			{
+				Name:        "is_public",
+				Type:        proto.ColumnType_BOOL,
+				Description: "Whether the flavor is available to all projects, or only to those in its access list.",
+				Transform:   transform.FromField("IsPublic"),
+			},
+			{
+				Name:        "disabled",
+				Type:        proto.ColumnType_BOOL,
+				Description: "Whether the flavor is disabled, i.e. cannot be used to create new instances.",
+				Transform:   transform.FromField("Disabled"),
+			},
+			{
+				Name:        "extra_specs",
+				Type:        proto.ColumnType_JSON,
+				Description: "All the extra specs of the flavor.",
+				Hydrate:     getOpenStackFlavorExtraSpecs,
+				Transform:   transform.FromValue(),
+			},
+			{
+				Name:        "cpu_policy",
+				Type:        proto.ColumnType_STRING,
+				Description: "The CPU pinning policy (hw:cpu_policy), e.g. shared or dedicated.",
+				Hydrate:     getOpenStackFlavorExtraSpecs,
+				Transform:   transform.FromValue().TransformP(extraSpec, "hw:cpu_policy"),
+			},
+			{
+				Name:        "numa_nodes",
+				Type:        proto.ColumnType_INT,
+				Description: "The number of NUMA nodes the instances are spread across (hw:numa_nodes).",
+				Hydrate:     getOpenStackFlavorExtraSpecs,
+				Transform:   transform.FromValue().TransformP(extraSpec, "hw:numa_nodes").Transform(transform.ToInt),
+			},
+			{
+				Name:        "mem_page_size",
+				Type:        proto.ColumnType_STRING,
+				Description: "The size of the memory pages backing the instances (hw:mem_page_size), e.g. small, large or 1GB.",
+				Hydrate:     getOpenStackFlavorExtraSpecs,
+				Transform:   transform.FromValue().TransformP(extraSpec, "hw:mem_page_size"),
+			},
+			{
+				Name:        "quotas",
+				Type:        proto.ColumnType_JSON,
+				Description: "The resource quotas of the instances (quota:* extra specs, without the prefix), e.g. disk_read_iops_sec.",
+				Hydrate:     getOpenStackFlavorExtraSpecs,
+				Transform:   transform.FromValue().TransformP(extraSpecsWithPrefix, "quota:"),
+			},
+			{
+				Name:        "traits",
+				Type:        proto.ColumnType_JSON,
+				Description: "The traits required or forbidden on the hosts (trait:* extra specs, without the prefix).",
+				Hydrate:     getOpenStackFlavorExtraSpecs,
+				Transform:   transform.FromValue().TransformP(extraSpecsWithPrefix, "trait:"),
+			},
+			{
+				Name:        "resources",
+				Type:        proto.ColumnType_JSON,
+				Description: "The placement resources requested or overridden (resources:* extra specs, without the prefix), e.g. VGPU.",
+				Hydrate:     getOpenStackFlavorExtraSpecs,
+				Transform:   transform.FromValue().TransformP(extraSpecsWithPrefix, "resources:"),
+			},
+			regionColumn(),
+		},
+		List: &plugin.ListConfig{
+			Hydrate: listOpenStackFlavor,
+			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
+				&plugin.KeyColumn{
+					Name:    "is_public",
+					Require: plugin.Optional,
+				},
+				&plugin.KeyColumn{
+					Name:      "disk",
+					Require:   plugin.Optional,
+					Operators: []string{">=", ">"},
+				},
+				&plugin.KeyColumn{
+					Name:      "ram",
+					Require:   plugin.Optional,
+					Operators: []string{">=", ">"},
+				},
+			},
+		},
+		Get: &plugin.GetConfig{
+			KeyColumns: plugin.SingleColumn("id"),
+			Hydrate:    getOpenStackFlavor,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
+		},
+	}
+}
+
+//// LIST FUNCTION
+
+func listOpenStackFlavor(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	logger(ctx).Debug("retrieving openstack flavors list", "query data", toRedactedJSON(d))
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	opts := buildOpenStackFlavorFilter(ctx, d.EqualsQuals, d.Quals)
+	opts.Limit = getPageSize(ctx, d)
+	err = flavors.ListDetail(client, opts).EachPage(func(page pagination.Page) (bool, error) {
+		allFlavors, err := extractFlavors(page)
+		if err != nil {
+			logger(ctx).Error("error extracting flavors", "error", err)
+			return false, err
+		}
+		logger(ctx).Debug("flavors retrieved", "count", len(allFlavors))
+
+		for _, flavor := range allFlavors {
+			if ctx.Err() != nil {
+				logger(ctx).Debug("context done, exit")
+				return false, nil
+			}
+			// non-admin users get the private flavors of their project even
+			// when asking for the public ones only
+			if value, ok := d.EqualsQuals["is_public"]; ok && flavor.IsPublic != value.GetBoolValue() {
+				continue
+			}
+			d.StreamListItem(ctx, flavor)
+			if d.RowsRemaining(ctx) == 0 {
+				logger(ctx).Debug("row limit reached, exit")
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err = ignoreForbidden(ctx, d, err); err != nil {
+		logger(ctx).Error("error listing flavors with options", "options", toRedactedJSON(opts), "error", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+//// HYDRATE FUNCTIONS
+
+func getOpenStackFlavor(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	id := d.EqualsQuals["id"].GetStringValue()
+	logger(ctx).Debug("retrieving openstack flavor", "id", id)
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	flavor := &apiFlavor{}
+	if err := flavors.Get(client, id).ExtractInto(&struct {
+		Flavor *apiFlavor `json:"flavor"`
+	}{flavor}); err != nil {
+		logger(ctx).Error("error retrieving flavor", "error", err)
+		return nil, err
+	}
+
+	logger(ctx).Debug("returning flavor", "data", toRedactedJSON(flavor))
+	return flavor, nil
+}
+
+// getOpenStackFlavorExtraSpecs returns the extra specs of the flavor, which
+// Nova embeds in the flavor starting from microversion 2.61; with older
+// microversions they are retrieved with a separate call.
+func getOpenStackFlavorExtraSpecs(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	flavor := h.Item.(*apiFlavor)
+	if flavor.ExtraSpecs != nil {
+		return flavor.ExtraSpecs, nil
+	}
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+	specs, err := flavors.ListExtraSpecs(client, flavor.ID).Extract()
+	if err != nil {
+		logger(ctx).Error("error retrieving flavor extra specs", "id", flavor.ID, "error", err)
+		return nil, err
+	}
+	return specs, nil
+}
+
+func buildOpenStackFlavorFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap, ranges plugin.KeyColumnQualMap) flavors.ListOpts {
+	opts := flavors.ListOpts{
+		AccessType: flavors.AllAccess,
+	}
+
+	if value, ok := quals["is_public"]; ok {
+		opts.AccessType = flavors.PrivateAccess
+		if value.GetBoolValue() {
+			opts.AccessType = flavors.PublicAccess
+		}
+	}
+	for column, minimum := range map[string]*int{"disk": &opts.MinDisk, "ram": &opts.MinRAM} {
+		if ranges[column] == nil {
+			continue
+		}
+		for _, qual := range ranges[column].Quals {
+			value := int(qual.Value.GetInt64Value())
+			if qual.Operator == ">" {
+				value++
+			}
+			if value > *minimum {
+				*minimum = value
+			}
+		}
+	}
+
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
+	return opts
+}
+
+// extractFlavors extracts the flavors in a page of results, with the fields
+// that flavors.Flavor does not support.
+func extractFlavors(page pagination.Page) ([]*apiFlavor, error) {
+	allFlavors := []*apiFlavor{}
+	err := page.(flavors.FlavorPage).ExtractIntoSlicePtr(&allFlavors, "flavors")
+	return allFlavors, err
+}
+
+// apiFlavor adds to flavors.Flavor the disabled flag and the extra specs,
+// which are returned starting from microversion 2.61.
+type apiFlavor struct {
+	flavors.Flavor
+	Disabled   bool              `json:"OS-FLV-DISABLED:disabled"`
+	ExtraSpecs map[string]string `json:"extra_specs"`
+}
+
+// UnmarshalJSON is needed since flavors.Flavor has its own, which would
+// otherwise be promoted and skip the additional fields.
+func (f *apiFlavor) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &f.Flavor); err != nil {
+		return err
+	}
+	var extra struct {
+		Disabled   bool              `json:"OS-FLV-DISABLED:disabled"`
+		ExtraSpecs map[string]string `json:"extra_specs"`
+	}
+	if err := json.Unmarshal(b, &extra); err != nil {
+		return err
+	}
+	f.Disabled = extra.Disabled
+	f.ExtraSpecs = extra.ExtraSpecs
+	return nil
+}
+
+// extraSpec returns the value of the extra spec named in the transform
+// parameter, or nil if the flavor does not have it.
+func extraSpec(_ context.Context, d *transform.TransformData) (interface{}, error) {
+	specs, ok := d.Value.(map[string]string)
+	if !ok {
+		return nil, nil
+	}
+	if value, ok := specs[d.Param.(string)]; ok {
+		return value, nil
+	}
+	return nil, nil
+}
+
+// extraSpecsWithPrefix returns the extra specs whose names start with the
+// prefix in the transform parameter, without the prefix, or nil if there
+// are none.
+func extraSpecsWithPrefix(_ context.Context, d *transform.TransformData) (interface{}, error) {
+	specs, ok := d.Value.(map[string]string)
+	if !ok {
+		return nil, nil
+	}
+	prefix := d.Param.(string)
+	values := map[string]string{}
+	for name, value := range specs {
+		if strings.HasPrefix(name, prefix) {
+			values[strings.TrimPrefix(name, prefix)] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values, nil
+}
@@ -0,0 +1,187 @@
+package openstack
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableOpenStackFlavorAccess(_ context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:              "openstack_flavor_access",
+		Description:       "OpenStack Flavor Access",
+		GetMatrixItemFunc: regionMatrix(ComputeV2),
+		Columns: []*plugin.Column{
+			{
+				Name:        "flavor_id",
+				Type:        proto.ColumnType_STRING,
+				Description: "The id of the private flavor.",
+				Transform:   transform.FromField("FlavorID"),
+			},
+			{
+				Name:        "flavor_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the private flavor.",
+				Hydrate:     getOpenStackFlavorAccessFlavorName,
+				Transform:   transform.FromValue(),
+			},
+			{
+				Name:        "project_id",
+				Type:        proto.ColumnType_STRING,
+				Description: "The id of the project the flavor is available to.",
+				Transform:   transform.FromField("TenantID"),
+			},
+			{
+				Name:        "project_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the project the flavor is available to.",
+				Hydrate:     getOpenStackFlavorAccessProjectName,
+				Transform:   transform.FromValue(),
+			},
+			regionColumn(),
+		},
+		List: &plugin.ListConfig{
+			Hydrate: listOpenStackFlavorAccess,
+			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
+				&plugin.KeyColumn{
+					Name:    "flavor_id",
+					Require: plugin.Optional,
+				},
+				&plugin.KeyColumn{
+					Name:    "project_id",
+					Require: plugin.Optional,
+				},
+			},
+		},
+	}
+}
+
+//// LIST FUNCTION
+
+func listOpenStackFlavorAccess(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	logger(ctx).Debug("retrieving openstack flavor access list", "query data", toRedactedJSON(d))
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
+		return nil, err
+	}
+
+	// public flavors have no access list, so unless the flavor is given,
+	// the access lists of all the private flavors are retrieved one by one
+	flavorIDs := []string{}
+	if value, ok := d.EqualsQuals["flavor_id"]; ok {
+		flavorIDs = append(flavorIDs, value.GetStringValue())
+	} else {
+		opts := flavors.ListOpts{
+			AccessType: flavors.PrivateAccess,
+			Limit:      getPageSize(ctx, d),
+		}
+		err = flavors.ListDetail(client, opts).EachPage(func(page pagination.Page) (bool, error) {
+			allFlavors, err := flavors.ExtractFlavors(page)
+			if err != nil {
+				logger(ctx).Error("error extracting flavors", "error", err)
+				return false, err
+			}
+			for _, flavor := range allFlavors {
+				// non-admin users get the public flavors as well
+				if !flavor.IsPublic {
+					flavorIDs = append(flavorIDs, flavor.ID)
+				}
+			}
+			return ctx.Err() == nil, nil
+		})
+		if err = ignoreForbidden(ctx, d, err); err != nil {
+			logger(ctx).Error("error listing flavors with options", "options", toRedactedJSON(opts), "error", err)
+			return nil, err
+		}
+	}
+	logger(ctx).Debug("private flavors retrieved", "count", len(flavorIDs))
+
+	for _, flavorID := range flavorIDs {
+		if ctx.Err() != nil {
+			logger(ctx).Debug("context done, exit")
+			return nil, nil
+		}
+		done, err := listOpenStackFlavorAccesses(ctx, d, client, flavorID, allowed)
+		if isNotFoundError(err) {
+			// e.g. a flavor deleted in the meantime, or a public one
+			logger(ctx).Warn("error listing flavor access, skipping", "flavor", flavorID, "error", err)
+			continue
+		}
+		if err = ignoreForbidden(ctx, d, err); err != nil {
+			logger(ctx).Error("error listing flavor access", "flavor", flavorID, "error", err)
+			return nil, err
+		}
+		if done {
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+// listOpenStackFlavorAccesses streams the projects the flavor is available
+// to, and returns whether the row limit was reached.
+func listOpenStackFlavorAccesses(ctx context.Context, d *plugin.QueryData, client *gophercloud.ServiceClient, flavorID string, allowed allowedProjects) (bool, error) {
+	done := false
+	err := flavors.ListAccesses(client, flavorID).EachPage(func(page pagination.Page) (bool, error) {
+		allAccesses, err := flavors.ExtractAccesses(page)
+		if err != nil {
+			logger(ctx).Error("error extracting flavor access", "error", err)
+			return false, err
+		}
+		logger(ctx).Debug("flavor access retrieved", "flavor", flavorID, "count", len(allAccesses))
+
+		for _, access := range allAccesses {
+			access := access
+			if value, ok := d.EqualsQuals["project_id"]; ok && access.TenantID != value.GetStringValue() {
+				continue
+			}
+			if !allowed.contains(access.TenantID) {
+				continue
+			}
+			d.StreamListItem(ctx, &access)
+			if d.RowsRemaining(ctx) == 0 {
+				logger(ctx).Debug("row limit reached, exit")
+				done = true
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	return done, err
+}
+
+//// HYDRATE FUNCTIONS
+
+// getOpenStackFlavorAccessFlavorName resolves the name of the flavor.
+func getOpenStackFlavorAccessFlavorName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	access := h.Item.(*flavors.FlavorAccess)
+	return lookupName(ctx, d, flavorLookup, access.FlavorID)
+}
+
+// getOpenStackFlavorAccessProjectName resolves the name of the project the
+// flavor is available to.
+func getOpenStackFlavorAccessProjectName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	access := h.Item.(*flavors.FlavorAccess)
+	return lookupName(ctx, d, projectLookup, access.TenantID)
+}
@@ -0,0 +1,454 @@
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/hypervisors"
+	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableOpenStackHypervisor(_ context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:              "openstack_hypervisor",
+		Description:       "OpenStack Hypervisor",
+		GetMatrixItemFunc: regionMatrix(ComputeV2),
+		Columns: []*plugin.Column{
+			{
+				Name:        "id",
+				Type:        proto.ColumnType_STRING,
+				Description: "The unique id of the hypervisor.",
+				Transform:   transform.FromField("ID"),
+			},
+			{
+				Name:        "hypervisor_hostname",
+				Type:        proto.ColumnType_STRING,
+				Description: "The hostname of the hypervisor, as in the hypervisor_hostname of its instances.",
+				Transform:   transform.FromField("HypervisorHostname"),
+			},
+			{
+				Name:        "host_ip",
+				Type:        proto.ColumnType_IPADDR,
+				Description: "The IP address of the hypervisor's host.",
+				Transform:   transform.FromField("HostIP"),
+			},
+			{
+				Name:        "state",
+				Type:        proto.ColumnType_STRING,
+				Description: "The state of the hypervisor, up or down.",
+				Transform:   transform.FromField("State"),
+			},
+			{
+				Name:        "status",
+				Type:        proto.ColumnType_STRING,
+				Description: "The status of the hypervisor, enabled or disabled.",
+				Transform:   transform.FromField("Status"),
+			},
+			{
+				Name:        "hypervisor_type",
+				Type:        proto.ColumnType_STRING,
+				Description: "The type of the hypervisor, e.g. QEMU.",
+				Transform:   transform.FromField("HypervisorType"),
+			},
+			{
+				Name:        "hypervisor_version",
+				Type:        proto.ColumnType_INT,
+				Description: "The version of the hypervisor, as an integer (e.g. 6002000 for 6.2.0).",
+				Transform:   transform.FromField("HypervisorVersion"),
+			},
+			{
+				Name:        "vcpus",
+				Type:        proto.ColumnType_INT,
+				Description: "The number of virtual CPUs of the hypervisor (up to microversion 2.87).",
+				Transform:   transform.FromField("VCPUs"),
+			},
+			{
+				Name:        "vcpus_used",
+				Type:        proto.ColumnType_INT,
+				Description: "The number of virtual CPUs used by the instances on the hypervisor (up to microversion 2.87).",
+				Transform:   transform.FromField("VCPUsUsed"),
+			},
+			{
+				Name:        "memory_mb",
+				Type:        proto.ColumnType_INT,
+				Description: "The amount of memory of the hypervisor, in MB (up to microversion 2.87).",
+				Transform:   transform.FromField("MemoryMB"),
+			},
+			{
+				Name:        "memory_mb_used",
+				Type:        proto.ColumnType_INT,
+				Description: "The amount of memory used by the instances on the hypervisor, in MB (up to microversion 2.87).",
+				Transform:   transform.FromField("MemoryMBUsed"),
+			},
+			{
+				Name:        "local_gb",
+				Type:        proto.ColumnType_INT,
+				Description: "The size of the local disk of the hypervisor, in GB (up to microversion 2.87).",
+				Transform:   transform.FromField("LocalGB"),
+			},
+			{
+				Name:        "local_gb_used",
+				Type:        proto.ColumnType_INT,
+				Description: "The size of the local disk used by the instances on the hypervisor, in GB (up to microversion 2.87).",
+				Transform:   transform.FromField("LocalGBUsed"),
+			},
+			{
+				Name:        "disk_available_least",
+				Type:        proto.ColumnType_INT,
+				Description: "The actual free space on the local disk of the hypervisor, in GB (up to microversion 2.87).",
+				Transform:   transform.FromField("DiskAvailableLeast"),
+			},
+			{
+				Name:        "running_vms",
+				Type:        proto.ColumnType_INT,
+				Description: "The number of instances running on the hypervisor (up to microversion 2.87).",
+				Transform:   transform.FromField("RunningVMs"),
+			},
+			{
+				Name:        "current_workload",
+				Type:        proto.ColumnType_INT,
+				Description: "The number of tasks the hypervisor is running (up to microversion 2.87).",
+				Transform:   transform.FromField("CurrentWorkload"),
+			},
+			{
+				Name:        "service_id",
+				Type:        proto.ColumnType_STRING,
+				Description: "The id of the compute service of the hypervisor.",
+				Transform:   transform.FromField("Service.ID"),
+			},
+			{
+				Name:        "service_host",
+				Type:        proto.ColumnType_STRING,
+				Description: "The host of the compute service of the hypervisor, as in the host_name of its instances.",
+				Transform:   transform.FromField("Service.Host"),
+			},
+			{
+				Name:        "service_disabled_reason",
+				Type:        proto.ColumnType_STRING,
+				Description: "Why the compute service of the hypervisor was disabled, if it was.",
+				Transform:   transform.FromField("Service.DisabledReason"),
+			},
+			{
+				Name:        "uptime",
+				Type:        proto.ColumnType_STRING,
+				Description: "The uptime of the hypervisor's host, as reported by the driver (not all drivers do).",
+				Hydrate:     getOpenStackHypervisorUptime,
+				Transform:   transform.FromValue(),
+			},
+			regionColumn(),
+		},
+		List: &plugin.ListConfig{
+			Hydrate: listOpenStackHypervisor,
+			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
+				&plugin.KeyColumn{
+					Name:    "hypervisor_hostname",
+					Require: plugin.Optional,
+				},
+			},
+		},
+		Get: &plugin.GetConfig{
+			KeyColumns: plugin.SingleColumn("id"),
+			Hydrate:    getOpenStackHypervisor,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
+		},
+	}
+}
+
+//// LIST FUNCTION
+
+func listOpenStackHypervisor(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	logger(ctx).Debug("retrieving openstack hypervisors list", "query data", toRedactedJSON(d))
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	err = listOpenStackHypervisors(ctx, d, client, false, func(hypervisor *apiHypervisor) bool {
+		d.StreamListItem(ctx, hypervisor)
+		return d.RowsRemaining(ctx) != 0
+	})
+	if err = ignoreForbidden(ctx, d, err); err != nil {
+		logger(ctx).Error("error listing hypervisors", "error", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// listOpenStackHypervisors calls the given function with each hypervisor
+// matching the hypervisor_hostname qual, if any, until it returns false;
+// withServers has the hypervisors include the servers they host.
+func listOpenStackHypervisors(ctx context.Context, d *plugin.QueryData, client *gophercloud.ServiceClient, withServers bool, stream func(*apiHypervisor) bool) error {
+	opts := buildOpenStackHypervisorFilter(ctx, d, client, withServers)
+	hostname, filtered := d.EqualsQuals["hypervisor_hostname"]
+	err := listHypervisors(client, opts).EachPage(func(page pagination.Page) (bool, error) {
+		allHypervisors, err := extractHypervisors(page)
+		if err != nil {
+			logger(ctx).Error("error extracting hypervisors", "error", err)
+			return false, err
+		}
+		logger(ctx).Debug("hypervisors retrieved", "count", len(allHypervisors))
+
+		for _, hypervisor := range allHypervisors {
+			if ctx.Err() != nil {
+				logger(ctx).Debug("context done, exit")
+				return false, nil
+			}
+			// Nova matches hostname patterns, not hostnames
+			if filtered && hypervisor.HypervisorHostname != hostname.GetStringValue() {
+				continue
+			}
+			if withServers && opts.WithServers == nil {
+				if err := getOpenStackHypervisorServers(ctx, client, hypervisor); err != nil {
+					return false, err
+				}
+			}
+			if !stream(hypervisor) {
+				logger(ctx).Debug("row limit reached, exit")
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if isNotFoundError(err) && opts.HypervisorHostnamePattern != nil {
+		// no hypervisor matching the pattern
+		return nil
+	}
+	return err
+}
+
+//// HYDRATE FUNCTIONS
+
+func getOpenStackHypervisor(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	id := d.EqualsQuals["id"].GetStringValue()
+	logger(ctx).Debug("retrieving openstack hypervisor", "id", id)
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	hypervisor := &apiHypervisor{}
+	if err := hypervisors.Get(client, id).ExtractInto(&struct {
+		Hypervisor *apiHypervisor `json:"hypervisor"`
+	}{hypervisor}); err != nil {
+		logger(ctx).Error("error retrieving hypervisor", "error", err)
+		return nil, err
+	}
+
+	logger(ctx).Debug("returning hypervisor", "data", toRedactedJSON(hypervisor))
+	return hypervisor, nil
+}
+
+// getOpenStackHypervisorUptime returns the uptime of the hypervisor, which
+// Nova includes in the hypervisor details starting from microversion 2.88;
+// with older microversions it is retrieved with a separate call. Drivers
+// that cannot report it yield NULL.
+func getOpenStackHypervisorUptime(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	hypervisor := h.Item.(*apiHypervisor)
+	if hypervisor.Uptime != nil {
+		return *hypervisor.Uptime, nil
+	}
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+	if supportsMicroversion(client, "2.88") {
+		return nil, nil
+	}
+	uptime, err := hypervisors.GetUptime(client, hypervisor.ID).Extract()
+	if response, ok := responseError(err); isNotFoundError(err) || ok && response.Actual == http.StatusNotImplemented {
+		logger(ctx).Debug("hypervisor uptime not available", "id", hypervisor.ID, "error", err)
+		return nil, nil
+	}
+	if err != nil {
+		logger(ctx).Error("error retrieving hypervisor uptime", "id", hypervisor.ID, "error", err)
+		return nil, err
+	}
+	if uptime.Uptime == "" {
+		return nil, nil
+	}
+	return strings.TrimSpace(uptime.Uptime), nil
+}
+
+// getOpenStackHypervisorServers sets the servers of the hypervisor, which
+// Nova only includes in the list of hypervisors starting from microversion
+// 2.53; with older microversions they are searched by hostname.
+func getOpenStackHypervisorServers(ctx context.Context, client *gophercloud.ServiceClient, hypervisor *apiHypervisor) error {
+	result := struct {
+		Hypervisors []*apiHypervisor `json:"hypervisors"`
+	}{}
+	_, err := client.Get(client.ServiceURL("os-hypervisors", hypervisor.HypervisorHostname, "servers"), &result, nil)
+	if isNotFoundError(err) {
+		// the hypervisor was removed in the meantime
+		return nil
+	}
+	if err != nil {
+		logger(ctx).Error("error retrieving hypervisor servers", "hostname", hypervisor.HypervisorHostname, "error", err)
+		return err
+	}
+	for _, found := range result.Hypervisors {
+		if found.ID == hypervisor.ID {
+			hypervisor.Servers = found.Servers
+		}
+	}
+	return nil
+}
+
+func buildOpenStackHypervisorFilter(ctx context.Context, d *plugin.QueryData, client *gophercloud.ServiceClient, withServers bool) hypervisorListOpts {
+	opts := hypervisorListOpts{}
+	if supportsMicroversion(client, "2.33") {
+		opts.Limit = getPageSize(ctx, d)
+	}
+	if supportsMicroversion(client, "2.53") {
+		if value, ok := d.EqualsQuals["hypervisor_hostname"]; ok {
+			pattern := value.GetStringValue()
+			opts.HypervisorHostnamePattern = &pattern
+		}
+		if withServers {
+			opts.WithServers = &withServers
+		}
+	}
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
+	return opts
+}
+
+// hypervisorListOpts adds pagination to hypervisors.ListOpts, which Nova
+// supports starting from microversion 2.33.
+type hypervisorListOpts struct {
+	Limit                     int     `q:"limit"`
+	HypervisorHostnamePattern *string `q:"hypervisor_hostname_pattern"`
+	WithServers               *bool   `q:"with_servers"`
+}
+
+// listHypervisors lists the hypervisors following the pagination links,
+// which hypervisors.List does not.
+func listHypervisors(client *gophercloud.ServiceClient, opts hypervisorListOpts) pagination.Pager {
+	query, err := gophercloud.BuildQueryString(&opts)
+	if err != nil {
+		return pagination.Pager{Err: err}
+	}
+	return pagination.NewPager(client, client.ServiceURL("os-hypervisors", "detail")+query.String(), func(r pagination.PageResult) pagination.Page {
+		return hypervisorPage{LinkedPageBase: pagination.LinkedPageBase{PageResult: r}}
+	})
+}
+
+type hypervisorPage struct {
+	pagination.LinkedPageBase
+}
+
+func (page hypervisorPage) IsEmpty() (bool, error) {
+	allHypervisors, err := extractHypervisors(page)
+	return len(allHypervisors) == 0, err
+}
+
+func (page hypervisorPage) NextPageURL() (string, error) {
+	var s struct {
+		Links []gophercloud.Link `json:"hypervisors_links"`
+	}
+	if err := page.ExtractInto(&s); err != nil {
+		return "", err
+	}
+	return gophercloud.ExtractNextURL(s.Links)
+}
+
+func extractHypervisors(page pagination.Page) ([]*apiHypervisor, error) {
+	allHypervisors := []*apiHypervisor{}
+	err := page.(hypervisorPage).ExtractIntoSlicePtr(&allHypervisors, "hypervisors")
+	return allHypervisors, err
+}
+
+// apiHypervisor replaces hypervisors.Hypervisor, which fails to parse the
+// hypervisors returned with microversion 2.88 and later, where the usage
+// fields were removed and the uptime added.
+type apiHypervisor struct {
+	ID                 string                `json:"-"`
+	HypervisorHostname string                `json:"hypervisor_hostname"`
+	HostIP             string                `json:"host_ip"`
+	State              string                `json:"state"`
+	Status             string                `json:"status"`
+	HypervisorType     string                `json:"hypervisor_type"`
+	HypervisorVersion  int64                 `json:"hypervisor_version"`
+	VCPUs              *int                  `json:"vcpus"`
+	VCPUsUsed          *int                  `json:"vcpus_used"`
+	MemoryMB           *int                  `json:"memory_mb"`
+	MemoryMBUsed       *int                  `json:"memory_mb_used"`
+	LocalGB            *int                  `json:"local_gb"`
+	LocalGBUsed        *int                  `json:"local_gb_used"`
+	DiskAvailableLeast *int                  `json:"disk_available_least"`
+	RunningVMs         *int                  `json:"running_vms"`
+	CurrentWorkload    *int                  `json:"current_workload"`
+	Uptime             *string               `json:"uptime"`
+	Service            apiHypervisorService  `json:"service"`
+	Servers            *[]hypervisors.Server `json:"servers"`
+}
+
+// UnmarshalJSON reads the id, which is a number up to microversion 2.52
+// and a UUID afterwards.
+func (h *apiHypervisor) UnmarshalJSON(b []byte) error {
+	type hypervisor apiHypervisor
+	s := struct {
+		*hypervisor
+		ID interface{} `json:"id"`
+	}{hypervisor: (*hypervisor)(h)}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	h.ID = toID(s.ID)
+	return nil
+}
+
+type apiHypervisorService struct {
+	ID             string `json:"-"`
+	Host           string `json:"host"`
+	DisabledReason string `json:"disabled_reason"`
+}
+
+// UnmarshalJSON reads the id, which is a number up to microversion 2.52
+// and a UUID afterwards.
+func (r *apiHypervisorService) UnmarshalJSON(b []byte) error {
+	type service apiHypervisorService
+	s := struct {
+		*service
+		ID interface{} `json:"id"`
+	}{service: (*service)(r)}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	r.ID = toID(s.ID)
+	return nil
+}
+
+// toID returns the string form of a numeric or string id.
+func toID(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package openstack
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableOpenStackHypervisorInstance(_ context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:              "openstack_hypervisor_instance",
+		Description:       "OpenStack Instance on Hypervisor",
+		GetMatrixItemFunc: regionMatrix(ComputeV2),
+		Columns: []*plugin.Column{
+			{
+				Name:        "hypervisor_id",
+				Type:        proto.ColumnType_STRING,
+				Description: "The id of the hypervisor.",
+				Transform:   transform.FromField("HypervisorID"),
+			},
+			{
+				Name:        "hypervisor_hostname",
+				Type:        proto.ColumnType_STRING,
+				Description: "The hostname of the hypervisor, as in the hypervisor_hostname of the instance.",
+				Transform:   transform.FromField("HypervisorHostname"),
+			},
+			{
+				Name:        "service_host",
+				Type:        proto.ColumnType_STRING,
+				Description: "The host of the compute service of the hypervisor, as in the host_name of the instance.",
+				Transform:   transform.FromField("ServiceHost"),
+			},
+			{
+				Name:        "instance_id",
+				Type:        proto.ColumnType_STRING,
+				Description: "The id of the instance.",
+				Transform:   transform.FromField("InstanceID"),
+			},
+			{
+				Name:        "instance_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the instance on the hypervisor, e.g. instance-0000002a.",
+				Transform:   transform.FromField("InstanceName"),
+			},
+			regionColumn(),
+		},
+		List: &plugin.ListConfig{
+			Hydrate: listOpenStackHypervisorInstance,
+			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
+				&plugin.KeyColumn{
+					Name:    "hypervisor_hostname",
+					Require: plugin.Optional,
+				},
+			},
+		},
+	}
+}
+
+//// LIST FUNCTION
+
+func listOpenStackHypervisorInstance(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	logger(ctx).Debug("retrieving openstack hypervisor instances list", "query data", toRedactedJSON(d))
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	// the hypervisors do not report the projects of their servers, so on a
+	// connection restricted to some projects only the instances listed in
+	// those projects are returned
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
+		return nil, err
+	}
+	var instances map[string]struct{}
+	if allowed != nil {
+		if instances, err = listAllowedInstanceIDs(ctx, d, client, allowed); err != nil {
+			logger(ctx).Error("error listing allowed instances", "error", err)
+			return nil, err
+		}
+	}
+
+	err = listOpenStackHypervisors(ctx, d, client, true, func(hypervisor *apiHypervisor) bool {
+		if hypervisor.Servers == nil {
+			return true
+		}
+		for _, server := range *hypervisor.Servers {
+			if _, ok := instances[server.UUID]; instances != nil && !ok {
+				continue
+			}
+			d.StreamListItem(ctx, &apiHypervisorInstance{
+				HypervisorID:       hypervisor.ID,
+				HypervisorHostname: hypervisor.HypervisorHostname,
+				ServiceHost:        hypervisor.Service.Host,
+				InstanceID:         server.UUID,
+				InstanceName:       server.Name,
+			})
+			if d.RowsRemaining(ctx) == 0 {
+				return false
+			}
+		}
+		return true
+	})
+	if err = ignoreForbidden(ctx, d, err); err != nil {
+		logger(ctx).Error("error listing hypervisor instances", "error", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+// listAllowedInstanceIDs returns the IDs of the instances in the projects
+// the connection is restricted to.
+func listAllowedInstanceIDs(ctx context.Context, d *plugin.QueryData, client *gophercloud.ServiceClient, allowed allowedProjects) (map[string]struct{}, error) {
+	instances := map[string]struct{}{}
+	opts := servers.ListOpts{}
+	if !allowed.restrict(&opts.TenantID) {
+		return instances, nil
+	}
+	opts.Limit = getPageSize(ctx, d)
+	err := listWithPolicy(ctx, d, func(scoped bool) error {
+		opts.AllTenants = !scoped
+		return servers.List(client, opts).EachPage(func(page pagination.Page) (bool, error) {
+			allInstances := []*apiInstance{}
+			if err := servers.ExtractServersInto(page, &allInstances); err != nil {
+				return false, err
+			}
+			for _, instance := range allInstances {
+				if allowed.contains(instance.TenantID) {
+					instances[instance.ID] = struct{}{}
+				}
+			}
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+			return true, nil
+		})
+	})
+	return instances, err
+}
+
+// apiHypervisorInstance is an instance running on a hypervisor.
+type apiHypervisorInstance struct {
+	HypervisorID       string
+	HypervisorHostname string
+	ServiceHost        string
+	InstanceID         string
+	InstanceName       string
+}
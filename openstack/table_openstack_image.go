@@ -4,8 +4,8 @@ import (
 	"context"
 	"strings"
 
-	"github.com/dihedron/steampipe-plugin-utils/utils"
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
@@ -15,8 +15,9 @@ import (
 
 func tableOpenStackImage(_ context.Context) *plugin.Table {
 	return &plugin.Table{
-		Name:        "openstack_image",
-		Description: "OpenStack Disk Image",
+		Name:              "openstack_image",
+		Description:       "OpenStack Disk Image",
+		GetMatrixItemFunc: regionMatrix(ImageServiceV2),
 		Columns: []*plugin.Column{
 			{
 				Name:        "id",
@@ -72,6 +73,13 @@ func tableOpenStackImage(_ context.Context) *plugin.Table {
 				Description: "The id of the project the image belongs to.",
 				Transform:   transform.FromField("Owner"),
 			},
+			{
+				Name:        "project_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the project the image belongs to.",
+				Hydrate:     getOpenStackImageProjectName,
+				Transform:   transform.FromValue(),
+			},
 			{
 				Name:        "protected",
 				Type:        proto.ColumnType_BOOL,
@@ -116,13 +124,13 @@ func tableOpenStackImage(_ context.Context) *plugin.Table {
 			},
 			{
 				Name:        "created_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "Timestamp when the volume was created.",
 				Transform:   transform.FromField("CreatedAt").Transform(ToTime),
 			},
 			{
 				Name:        "updated_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "The date when this volume was last updated.",
 				Transform:   transform.FromField("UpdatedAt").Transform(ToTime),
 			},
@@ -132,10 +140,16 @@ func tableOpenStackImage(_ context.Context) *plugin.Table {
 				Description: "VirtualSize is the virtual size of the image.",
 				Transform:   transform.FromField("VirtualSize").Transform(transform.NullIfZeroValue),
 			},
+			tagFilterColumn("tags_all"),
+			tagFilterColumn("tags_any"),
+			tagFilterColumn("not_tags"),
+			tagFilterColumn("not_tags_any"),
+			regionColumn(),
 		},
 		List: &plugin.ListConfig{
 			Hydrate: listOpenStackImage,
 			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
 				&plugin.KeyColumn{
 					Name:    "id",
 					Require: plugin.Optional,
@@ -156,11 +170,32 @@ func tableOpenStackImage(_ context.Context) *plugin.Table {
 					Name:    "disk_format",
 					Require: plugin.Optional,
 				},
+				&plugin.KeyColumn{
+					Name:    "project_id",
+					Require: plugin.Optional,
+				},
+				&plugin.KeyColumn{
+					Name:    "visibility",
+					Require: plugin.Optional,
+				},
+				&plugin.KeyColumn{
+					Name:    "hidden",
+					Require: plugin.Optional,
+				},
+				timeKeyColumn("created_at"),
+				timeKeyColumn("updated_at"),
+				tagKeyColumn("tags_all"),
+				tagKeyColumn("tags_any"),
+				tagKeyColumn("not_tags"),
+				tagKeyColumn("not_tags_any"),
 			},
 		},
 		Get: &plugin.GetConfig{
 			KeyColumns: plugin.SingleColumn("id"),
 			Hydrate:    getOpenStackImage,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
 		},
 	}
 }
@@ -171,35 +206,59 @@ func listOpenStackImage(ctx context.Context, d *plugin.QueryData, h *plugin.Hydr
 
 	setLogLevel(ctx, d)
 
-	plugin.Logger(ctx).Debug("retrieving openstack images list", "query data", utils.ToPrettyJSON(d))
+	logger(ctx).Debug("retrieving openstack images list", "query data", toRedactedJSON(d))
 
 	client, err := getServiceClient(ctx, d, ImageServiceV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
-	opts := buildOpenStackImageFilter(ctx, d.EqualsQuals)
-
-	allPages, err := images.List(client, opts).AllPages()
+	ranges := getTimeRanges(d.Quals, "created_at", "updated_at")
+	tags := getTagFilter(d.EqualsQuals)
+	opts := buildOpenStackImageFilter(ctx, d.EqualsQuals, ranges, tags)
+	allowed, err := getAllowedProjects(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("error listing images with options", "options", utils.ToPrettyJSON(opts), "error", err)
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
-	allImages, err := images.ExtractImages(allPages)
-	if err != nil {
-		plugin.Logger(ctx).Error("error extracting images", "error", err)
-		return nil, err
+	if !allowed.restrict(&opts.Owner) {
+		logger(ctx).Debug("project not allowed, exit")
+		return nil, nil
 	}
-	plugin.Logger(ctx).Debug("images retrieved", "count", len(allImages))
 
-	for _, image := range allImages {
-		if ctx.Err() != nil {
-			plugin.Logger(ctx).Debug("context done, exit")
-			break
+	opts.Limit = getPageSize(ctx, d)
+	err = images.List(client, opts).EachPage(func(page pagination.Page) (bool, error) {
+		allImages, err := images.ExtractImages(page)
+		if err != nil {
+			logger(ctx).Error("error extracting images", "error", err)
+			return false, err
+		}
+		logger(ctx).Debug("images retrieved", "count", len(allImages))
+
+		for _, image := range allImages {
+			if ctx.Err() != nil {
+				logger(ctx).Debug("context done, exit")
+				return false, nil
+			}
+			image := image
+			if !allowed.contains(image.Owner) {
+				continue
+			}
+			if !ranges.match("created_at", image.CreatedAt) || !ranges.match("updated_at", image.UpdatedAt) || !tags.match(image.Tags) {
+				continue
+			}
+			d.StreamListItem(ctx, &image)
+			if d.RowsRemaining(ctx) == 0 {
+				logger(ctx).Debug("row limit reached, exit")
+				return false, nil
+			}
 		}
-		image := image
-		d.StreamListItem(ctx, image)
+		return true, nil
+	})
+	if err = ignoreForbidden(ctx, d, err); err != nil {
+		logger(ctx).Error("error listing images with options", "options", toRedactedJSON(opts), "error", err)
+		return nil, err
 	}
 	return nil, nil
 }
@@ -211,28 +270,50 @@ func getOpenStackImage(ctx context.Context, d *plugin.QueryData, h *plugin.Hydra
 	setLogLevel(ctx, d)
 
 	id := d.EqualsQuals["id"].GetStringValue()
-	plugin.Logger(ctx).Debug("retrieving openstack image", "id", id)
+	logger(ctx).Debug("retrieving openstack image", "id", id)
 
 	client, err := getServiceClient(ctx, d, ImageServiceV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
 	result := images.Get(client, id)
-	//plugin.Logger(ctx).Debug("request run", "result", utils.ToPrettyJSON(result))
+	//logger(ctx).Debug("request run", "result", toRedactedJSON(result))
 
 	image := &images.Image{}
 	err = result.ExtractInto(image)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving image", "error", err)
+		logger(ctx).Error("error retrieving image", "error", err)
+		return nil, err
+	}
+
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
+	if !allowed.contains(image.Owner) {
+		logger(ctx).Debug("project not allowed", "project", image.Owner)
+		return nil, nil
+	}
 
 	return image, nil
 }
-func buildOpenStackImageFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap) images.ListOpts {
-	opts := images.ListOpts{}
+
+// getOpenStackImageProjectName resolves the name of the image's project.
+func getOpenStackImageProjectName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	image := h.Item.(*images.Image)
+	return lookupName(ctx, d, projectLookup, image.Owner)
+}
+
+func buildOpenStackImageFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap, ranges timeRanges, tags tagFilter) images.ListOpts {
+	// Glance can only filter on images having all the given tags, the other
+	// tag filters are applied client-side
+	opts := images.ListOpts{
+		Tags: splitTags(tags.Tags),
+	}
 	if value, ok := quals["id"]; ok {
 		opts.ID = value.GetStringValue()
 	}
@@ -265,6 +346,32 @@ func buildOpenStackImageFilter(ctx context.Context, quals plugin.KeyColumnEquals
 	if value, ok := quals["container_format"]; ok {
 		opts.ContainerFormat = value.GetStringValue()
 	}
-	plugin.Logger(ctx).Debug("returning", "filter", utils.ToPrettyJSON(opts))
+	if value, ok := quals["project_id"]; ok {
+		opts.Owner = value.GetStringValue()
+	}
+	if value, ok := quals["visibility"]; ok {
+		opts.Visibility = images.ImageVisibility(strings.ToLower(value.GetStringValue()))
+	}
+	// Glance leaves the hidden images out unless asked for them, so only
+	// hidden = true needs to be sent
+	if value, ok := quals["hidden"]; ok {
+		opts.Hidden = value.GetBoolValue()
+	}
+	// Glance takes a single filter per time column, the other bound of the
+	// range (if any) is applied client-side
+	opts.CreatedAtQuery = buildImageDateQuery(ranges["created_at"])
+	opts.UpdatedAtQuery = buildImageDateQuery(ranges["updated_at"])
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
 	return opts
 }
+
+// buildImageDateQuery converts a time range into a Glance date filter.
+func buildImageDateQuery(r *timeRange) *images.ImageDateQuery {
+	if operator, t, ok := r.filter(); ok {
+		return &images.ImageDateQuery{
+			Date:   t.UTC(),
+			Filter: images.ImageDateFilter(operator),
+		}
+	}
+	return nil
+}
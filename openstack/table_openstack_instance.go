@@ -2,9 +2,11 @@ package openstack
 
 import (
 	"context"
+	"net/url"
+	"time"
 
-	"github.com/dihedron/steampipe-plugin-utils/utils"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
@@ -14,8 +16,9 @@ import (
 
 func tableOpenStackInstance(_ context.Context) *plugin.Table {
 	return &plugin.Table{
-		Name:        "openstack_instance",
-		Description: "OpenStack Virtual Machine Instance",
+		Name:              "openstack_instance",
+		Description:       "OpenStack Virtual Machine Instance",
+		GetMatrixItemFunc: regionMatrix(ComputeV2),
 		Columns: []*plugin.Column{
 			{
 				Name:        "id",
@@ -41,6 +44,13 @@ func tableOpenStackInstance(_ context.Context) *plugin.Table {
 				Description: "The ID of the instance's project (aka tenant)",
 				Transform:   transform.FromField("TenantID"),
 			},
+			{
+				Name:        "project_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the instance's project (aka tenant)",
+				Hydrate:     getOpenStackInstanceProjectName,
+				Transform:   transform.FromValue(),
+			},
 			{
 				Name:        "user_id",
 				Type:        proto.ColumnType_STRING,
@@ -48,26 +58,33 @@ func tableOpenStackInstance(_ context.Context) *plugin.Table {
 				Transform:   transform.FromField("UserID"),
 			},
 			{
-				Name:        "created_at",
+				Name:        "user_name",
 				Type:        proto.ColumnType_STRING,
+				Description: "The name of the instance's user",
+				Hydrate:     getOpenStackInstanceUserName,
+				Transform:   transform.FromValue(),
+			},
+			{
+				Name:        "created_at",
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "The creation time of the instance",
 				Transform:   transform.FromField("CreatedAt").Transform(ToTime),
 			},
 			{
 				Name:        "launched_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "The launch time of the instance",
 				Transform:   transform.FromField("LaunchedAt").Transform(ToTime),
 			},
 			{
 				Name:        "updated_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "The update time of the instance",
 				Transform:   transform.FromField("UpdatedAt").Transform(ToTime),
 			},
 			{
 				Name:        "terminated_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "The termination time of the instance",
 				Transform:   transform.FromField("TerminatedAt").Transform(ToTime),
 			},
@@ -81,12 +98,12 @@ func tableOpenStackInstance(_ context.Context) *plugin.Table {
 				Name:        "host_name",
 				Type:        proto.ColumnType_STRING,
 				Description: "The name of the host the instance is running on",
-				Transform:   transform.FromField("HostName"),
+				Transform:   transform.FromField("Host"),
 			},
 			{
 				Name:        "availability_zone",
 				Type:        proto.ColumnType_STRING,
-				Description: "The ID of the hypervisor (host) the instance is running on",
+				Description: "The availability zone the instance is running in",
 				Transform:   transform.FromField("AvailabilityZone"),
 			},
 			{
@@ -199,7 +216,8 @@ func tableOpenStackInstance(_ context.Context) *plugin.Table {
 				Name:        "flavor_name",
 				Type:        proto.ColumnType_STRING,
 				Description: "The original name of the flavor used to start the instance.",
-				Transform:   transform.FromField("Flavor.OriginalName"),
+				Hydrate:     getOpenStackInstanceFlavorName,
+				Transform:   transform.FromValue(),
 			},
 			{
 				Name:        "flavor_vcpus",
@@ -253,7 +271,7 @@ func tableOpenStackInstance(_ context.Context) *plugin.Table {
 				Name:        "flavor_rng_allowed",
 				Type:        proto.ColumnType_BOOL,
 				Description: "Whether the RNG is allowed on the flavor used to start the instance.",
-				Transform:   transform.FromField("Flavor.ExtraSpecs.RNGAllowed"),
+				Transform:   transform.FromField("Flavor.ExtraSpecs.RNGAllowed").Transform(transform.NullIfZeroValue),
 			},
 			{
 				Name:        "flavor_watchdog_action",
@@ -274,6 +292,13 @@ func tableOpenStackInstance(_ context.Context) *plugin.Table {
 					return nil, nil
 				}),
 			},
+			{
+				Name:        "image_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the Glance image used to start the instance.",
+				Hydrate:     getOpenStackInstanceImageName,
+				Transform:   transform.FromValue(),
+			},
 			{
 				Name:        "attached_volume_ids",
 				Type:        proto.ColumnType_JSON,
@@ -291,10 +316,28 @@ func tableOpenStackInstance(_ context.Context) *plugin.Table {
 					return nil, nil
 				}),
 			},
+			{
+				Name:        "key_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the key pair injected into the instance, as in the name of the key pair of the instance's user.",
+				Transform:   transform.FromField("KeyName"),
+			},
+			{
+				Name:        "server_groups",
+				Type:        proto.ColumnType_JSON,
+				Description: "The ids of the server groups the instance belongs to (microversion 2.71 and later).",
+				Transform:   transform.FromField("ServerGroups"),
+			},
+			tagFilterColumn("tags_all"),
+			tagFilterColumn("tags_any"),
+			tagFilterColumn("not_tags"),
+			tagFilterColumn("not_tags_any"),
+			regionColumn(),
 		},
 		List: &plugin.ListConfig{
 			Hydrate: listOpenStackInstance,
 			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
 				&plugin.KeyColumn{
 					Name:    "name",
 					Require: plugin.Optional,
@@ -335,12 +378,22 @@ func tableOpenStackInstance(_ context.Context) *plugin.Table {
 					Name:    "availability_zone",
 					Require: plugin.Optional,
 				},
-				// TODO: add tags
+				timeKeyColumn("created_at"),
+				timeKeyColumn("launched_at"),
+				timeKeyColumn("updated_at"),
+				timeKeyColumn("terminated_at"),
+				tagKeyColumn("tags_all"),
+				tagKeyColumn("tags_any"),
+				tagKeyColumn("not_tags"),
+				tagKeyColumn("not_tags_any"),
 			},
 		},
 		Get: &plugin.GetConfig{
 			KeyColumns: plugin.SingleColumn("id"),
 			Hydrate:    getOpenStackInstance,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
 		},
 	}
 }
@@ -351,37 +404,76 @@ func listOpenStackInstance(ctx context.Context, d *plugin.QueryData, h *plugin.H
 
 	setLogLevel(ctx, d)
 
-	plugin.Logger(ctx).Debug("retrieving openstack instance list", "query data", utils.ToPrettyJSON(d))
+	logger(ctx).Debug("retrieving openstack instance list", "query data", toRedactedJSON(d))
 
 	client, err := getServiceClient(ctx, d, ComputeV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
-	opts := buildOpenStackInstanceFilter(ctx, d.EqualsQuals)
-
-	allPages, err := servers.List(client, opts).AllPages()
+	ranges := getTimeRanges(d.Quals, "created_at", "launched_at", "updated_at", "terminated_at")
+	tags := getTagFilter(d.EqualsQuals)
+	opts := buildOpenStackInstanceFilter(ctx, d.EqualsQuals, ranges, tags, supportsMicroversion(client, "2.66"))
+	allowed, err := getAllowedProjects(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("error listing instances with options", "options", utils.ToPrettyJSON(opts), "error", err)
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
-	allInstances := []*apiInstance{}
-	err = servers.ExtractServersInto(allPages, &allInstances)
-	if err != nil {
-		plugin.Logger(ctx).Error("error extracting instances", "error", err)
-		return nil, err
+	if !allowed.restrict(&opts.TenantID) {
+		logger(ctx).Debug("project not allowed, exit")
+		return nil, nil
 	}
-	plugin.Logger(ctx).Debug("instances retrieved", "count", len(allInstances))
 
-	for _, instance := range allInstances {
-		if ctx.Err() != nil {
-			plugin.Logger(ctx).Debug("context done, exit")
-			break
-		}
-		instance := instance
-		plugin.Logger(ctx).Debug("streaming instance", "data", utils.ToPrettyJSON(instance))
-		d.StreamListItem(ctx, instance)
+	opts.Limit = getPageSize(ctx, d)
+	err = listWithPolicy(ctx, d, func(scoped bool) error {
+		opts.AllTenants = !scoped
+		return servers.List(client, opts).EachPage(func(page pagination.Page) (bool, error) {
+			allInstances := []*apiInstance{}
+			err := servers.ExtractServersInto(page, &allInstances)
+			if err != nil {
+				logger(ctx).Error("error extracting instances", "error", err)
+				return false, err
+			}
+			logger(ctx).Debug("instances retrieved", "count", len(allInstances))
+
+			for _, instance := range allInstances {
+				if ctx.Err() != nil {
+					logger(ctx).Debug("context done, exit")
+					return false, nil
+				}
+				instance := instance
+				if !allowed.contains(instance.TenantID) {
+					continue
+				}
+				instanceTags := []string{}
+				if instance.Tags != nil {
+					instanceTags = *instance.Tags
+				}
+				if !ranges.match("created_at", time.Time(instance.CreatedAt)) ||
+					!ranges.match("launched_at", time.Time(instance.LaunchedAt)) ||
+					!ranges.match("updated_at", time.Time(instance.UpdatedAt)) ||
+					!ranges.match("terminated_at", time.Time(instance.TerminatedAt)) ||
+					!tags.match(instanceTags) {
+					continue
+				}
+				if instance.Status == "DELETED" && opts.ChangesSince != "" && opts.Status == "" {
+					// changes-since also returns the servers deleted in the meantime
+					continue
+				}
+				logger(ctx).Debug("streaming instance", "data", toRedactedJSON(instance))
+				d.StreamListItem(ctx, instance)
+				if d.RowsRemaining(ctx) == 0 {
+					logger(ctx).Debug("row limit reached, exit")
+					return false, nil
+				}
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		logger(ctx).Error("error listing instances with options", "options", toRedactedJSON(opts), "error", err)
+		return nil, err
 	}
 	return nil, nil
 }
@@ -393,30 +485,86 @@ func getOpenStackInstance(ctx context.Context, d *plugin.QueryData, h *plugin.Hy
 	setLogLevel(ctx, d)
 
 	id := d.EqualsQuals["id"].GetStringValue()
-	plugin.Logger(ctx).Debug("retrieving openstack instance", "id", id)
+	logger(ctx).Debug("retrieving openstack instance", "id", id)
 
 	client, err := getServiceClient(ctx, d, ComputeV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
 	result := servers.Get(client, id)
-	plugin.Logger(ctx).Debug("API call complete", "result", utils.ToPrettyJSON(result))
+	logger(ctx).Debug("API call complete", "result", toRedactedJSON(result))
 
 	instance := &apiInstance{}
 	if err := result.ExtractInto(instance); err != nil {
-		plugin.Logger(ctx).Error("error retrieving instance", "error", err)
+		logger(ctx).Error("error retrieving instance", "error", err)
+		return nil, err
+	}
+
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
+	if !allowed.contains(instance.TenantID) {
+		logger(ctx).Debug("project not allowed", "project", instance.TenantID)
+		return nil, nil
+	}
 
-	plugin.Logger(ctx).Debug("returning instance", "data", utils.ToPrettyJSON(instance))
+	logger(ctx).Debug("returning instance", "data", toRedactedJSON(instance))
 	return instance, nil
 }
 
-func buildOpenStackInstanceFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap) servers.ListOpts {
-	opts := servers.ListOpts{
-		AllTenants: true,
+// getOpenStackInstanceProjectName resolves the name of the instance's project.
+func getOpenStackInstanceProjectName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	instance := h.Item.(*apiInstance)
+	return lookupName(ctx, d, projectLookup, instance.TenantID)
+}
+
+// getOpenStackInstanceUserName resolves the name of the instance's user.
+func getOpenStackInstanceUserName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	instance := h.Item.(*apiInstance)
+	return lookupName(ctx, d, userLookup, instance.UserID)
+}
+
+// getOpenStackInstanceImageName resolves the name of the image used to start
+// the instance, if any (instances booted from volume have none).
+func getOpenStackInstanceImageName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	instance := h.Item.(*apiInstance)
+	image, ok := instance.Image.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	id, _ := image["id"].(string)
+	return lookupName(ctx, d, imageLookup, id)
+}
+
+// getOpenStackInstanceFlavorName returns the original name of the flavor,
+// which Nova embeds in the instance starting from microversion 2.47; with
+// older microversions only the flavor ID is returned, and the name is
+// resolved through the lookup cache.
+func getOpenStackInstanceFlavorName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	instance := h.Item.(*apiInstance)
+	if instance.Flavor.OriginalName != "" {
+		return instance.Flavor.OriginalName, nil
+	}
+	return lookupName(ctx, d, flavorLookup, instance.Flavor.ID)
+}
+
+func buildOpenStackInstanceFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap, ranges timeRanges, tags tagFilter, changesBefore bool) instanceListOpts {
+	opts := instanceListOpts{
+		ListOpts: servers.ListOpts{
+			AllTenants: true,
+			Tags:       tags.Tags,
+			TagsAny:    tags.TagsAny,
+			NotTags:    tags.NotTags,
+			NotTagsAny: tags.NotTagsAny,
+		},
 	}
 
 	if value, ok := quals["name"]; ok {
@@ -449,10 +597,42 @@ func buildOpenStackInstanceFilter(ctx context.Context, quals plugin.KeyColumnEqu
 	if value, ok := quals["availability_zone"]; ok {
 		opts.AvailabilityZone = value.GetStringValue()
 	}
-	plugin.Logger(ctx).Debug("returning", "filter", utils.ToPrettyJSON(opts))
+	// Nova can only filter on the last change, but since a server cannot
+	// change before being created, the lower bound of the creation time is
+	// a lower bound for the last change too; the exact filtering on the
+	// creation time is then performed client-side
+	for _, since := range []string{ranges["created_at"].since(), ranges["updated_at"].since()} {
+		if since > opts.ChangesSince {
+			opts.ChangesSince = since
+		}
+	}
+	if changesBefore && ranges["updated_at"] != nil && ranges["updated_at"].Upper != nil {
+		upper := ranges["updated_at"].Upper.Time
+		if truncated := upper.Truncate(time.Second); truncated != upper {
+			upper = truncated.Add(time.Second)
+		}
+		opts.ChangesBefore = formatQualTime(upper)
+	}
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
 	return opts
 }
 
+// instanceListOpts adds to servers.ListOpts the changes-before filter,
+// which is available starting from microversion 2.66.
+type instanceListOpts struct {
+	servers.ListOpts
+	ChangesBefore string
+}
+
+func (opts instanceListOpts) ToServerListQuery() (string, error) {
+	query, err := opts.ListOpts.ToServerListQuery()
+	params := url.Values{}
+	if opts.ChangesBefore != "" {
+		params.Set("changes-before", opts.ChangesBefore)
+	}
+	return appendQuery(query, err, params)
+}
+
 // apiInstance is an internal type used to unmarshal more datafrom the API
 // response than would usually be possible through the ordinary gophercloud
 // struct. OpenStack API microversions enable more response data that is not
@@ -476,8 +656,9 @@ type apiInstance struct {
 	AccessIPv6   string `json:"accessIPv6"`
 	Image        any    `json:"image"`
 	Flavor       struct {
-		Disk       int `json:"disk"`
-		Ephemeral  int `json:"ephemeral"`
+		ID         string `json:"id"`
+		Disk       int    `json:"disk"`
+		Ephemeral  int    `json:"ephemeral"`
 		ExtraSpecs struct {
 			CPUCores        string `json:"hw:cpu_cores"`
 			CPUSockets      string `json:"hw:cpu_sockets"`
@@ -0,0 +1,314 @@
+package openstack
+
+import (
+	"context"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
+	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableOpenStackKeyPair(_ context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:              "openstack_keypair",
+		Description:       "OpenStack Key Pair",
+		GetMatrixItemFunc: regionMatrix(ComputeV2),
+		Columns: []*plugin.Column{
+			{
+				Name:        "name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the key pair, unique for its user.",
+				Transform:   transform.FromField("Name"),
+			},
+			{
+				Name:        "user_id",
+				Type:        proto.ColumnType_STRING,
+				Description: "The id of the user the key pair belongs to.",
+				Transform:   transform.FromField("UserID"),
+			},
+			{
+				Name:        "user_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the user the key pair belongs to.",
+				Hydrate:     getOpenStackKeyPairUserName,
+				Transform:   transform.FromValue(),
+			},
+			{
+				Name:        "type",
+				Type:        proto.ColumnType_STRING,
+				Description: "The type of the key pair, ssh or x509.",
+				Transform:   transform.FromField("Type"),
+			},
+			{
+				Name:        "fingerprint",
+				Type:        proto.ColumnType_STRING,
+				Description: "The fingerprint of the public key.",
+				Transform:   transform.FromField("Fingerprint"),
+			},
+			{
+				Name:        "public_key",
+				Type:        proto.ColumnType_STRING,
+				Description: "The public key.",
+				Transform:   transform.FromField("PublicKey"),
+			},
+			{
+				Name:        "created_at",
+				Type:        proto.ColumnType_TIMESTAMP,
+				Description: "When the key pair was created.",
+				Hydrate:     getOpenStackKeyPairDetails,
+				Transform:   transform.FromField("CreatedAt").Transform(ToTime),
+			},
+			regionColumn(),
+		},
+		List: &plugin.ListConfig{
+			Hydrate: listOpenStackKeyPair,
+			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
+				&plugin.KeyColumn{
+					Name:    "user_id",
+					Require: plugin.Optional,
+				},
+				&plugin.KeyColumn{
+					Name:    "name",
+					Require: plugin.Optional,
+				},
+			},
+		},
+		Get: &plugin.GetConfig{
+			KeyColumns: plugin.KeyColumnSlice{
+				&plugin.KeyColumn{
+					Name:    "name",
+					Require: plugin.Required,
+				},
+				&plugin.KeyColumn{
+					Name:    "user_id",
+					Require: plugin.Optional,
+				},
+			},
+			Hydrate: getOpenStackKeyPair,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
+		},
+	}
+}
+
+//// LIST FUNCTION
+
+func listOpenStackKeyPair(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	logger(ctx).Debug("retrieving openstack key pairs list", "query data", toRedactedJSON(d))
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	// Nova only lists the key pairs of one user at a time, those of the
+	// current user unless another one is given; so if the user did NOT
+	// specify the user_id filter, we get a list of all user IDs and then
+	// list the key pairs of each of them, in parallel.
+	userIDs := []string{}
+	if userID, ok := d.EqualsQuals["user_id"]; ok {
+		userIDs = append(userIDs, userID.GetStringValue())
+	} else {
+		err = listWithPolicy(ctx, d, func(scoped bool) error {
+			if scoped {
+				// only the current user
+				_, userID, err := getTokenScope(ctx, d)
+				if err != nil {
+					return err
+				}
+				userIDs = []string{userID}
+				return nil
+			}
+
+			allUsers, err := getUsers(ctx, d)
+			if err != nil {
+				return err
+			}
+			for _, user := range allUsers {
+				userIDs = append(userIDs, user.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			logger(ctx).Error("error listing users", "error", err)
+			return nil, err
+		}
+	}
+
+	opts := keyPairListOpts{}
+	if supportsMicroversion(client, "2.35") {
+		opts.Limit = getPageSize(ctx, d)
+	}
+	err = listInParallel(ctx, d, userIDs, func(userID string) error {
+		opts := opts
+		opts.UserID = userID
+		err := listOpenStackUserKeyPairs(ctx, d, client, opts)
+		if isForbiddenError(err) || isNotFoundError(err) {
+			// e.g. a user deleted in the meantime, or one whose key
+			// pairs the user has no access to
+			logger(ctx).Warn("error listing user key pairs, skipping", "user", userID, "error", err)
+			return nil
+		}
+		if err != nil {
+			logger(ctx).Error("error listing key pairs", "user", userID, "error", err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// listOpenStackUserKeyPairs streams the key pairs of the user in the
+// options.
+func listOpenStackUserKeyPairs(ctx context.Context, d *plugin.QueryData, client *gophercloud.ServiceClient, opts keyPairListOpts) error {
+	return listKeyPairs(client, opts).EachPage(func(page pagination.Page) (bool, error) {
+		allKeyPairs, err := keypairs.ExtractKeyPairs(page.(keyPairPage).KeyPairPage)
+		if err != nil {
+			logger(ctx).Error("error extracting key pairs", "error", err)
+			return false, err
+		}
+		logger(ctx).Debug("key pairs retrieved", "user", opts.UserID, "count", len(allKeyPairs))
+
+		for _, keypair := range allKeyPairs {
+			if ctx.Err() != nil {
+				logger(ctx).Debug("context done, exit")
+				return false, nil
+			}
+			if value, ok := d.EqualsQuals["name"]; ok && keypair.Name != value.GetStringValue() {
+				continue
+			}
+			// the list does not include the user
+			d.StreamListItem(ctx, &apiKeyPair{
+				Name:        keypair.Name,
+				UserID:      opts.UserID,
+				Type:        keypair.Type,
+				Fingerprint: keypair.Fingerprint,
+				PublicKey:   keypair.PublicKey,
+			})
+			if d.RowsRemaining(ctx) == 0 {
+				logger(ctx).Debug("row limit reached, exit")
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+}
+
+// keyPairListOpts adds pagination to keypairs.ListOpts, which Nova supports
+// starting from microversion 2.35.
+type keyPairListOpts struct {
+	UserID string `q:"user_id"`
+	Limit  int    `q:"limit"`
+}
+
+// listKeyPairs lists the key pairs following the pagination links, which
+// keypairs.List does not.
+func listKeyPairs(client *gophercloud.ServiceClient, opts keyPairListOpts) pagination.Pager {
+	query, err := gophercloud.BuildQueryString(&opts)
+	if err != nil {
+		return pagination.Pager{Err: err}
+	}
+	return pagination.NewPager(client, client.ServiceURL("os-keypairs")+query.String(), func(r pagination.PageResult) pagination.Page {
+		return keyPairPage{KeyPairPage: keypairs.KeyPairPage{SinglePageBase: pagination.SinglePageBase(r)}}
+	})
+}
+
+// keyPairPage follows the links of keypairs.KeyPairPage, which only ever
+// has one page.
+type keyPairPage struct {
+	keypairs.KeyPairPage
+}
+
+func (page keyPairPage) NextPageURL() (string, error) {
+	var s struct {
+		Links []gophercloud.Link `json:"keypairs_links"`
+	}
+	if err := page.ExtractInto(&s); err != nil {
+		return "", err
+	}
+	return gophercloud.ExtractNextURL(s.Links)
+}
+
+//// HYDRATE FUNCTIONS
+
+func getOpenStackKeyPair(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	name := d.EqualsQuals["name"].GetStringValue()
+	userID := d.EqualsQuals["user_id"].GetStringValue()
+	logger(ctx).Debug("retrieving openstack key pair", "name", name, "user", userID)
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	keypair := &apiKeyPair{}
+	if err := keypairs.Get(client, name, keypairs.GetOpts{UserID: userID}).ExtractInto(&struct {
+		KeyPair *apiKeyPair `json:"keypair"`
+	}{keypair}); err != nil {
+		logger(ctx).Error("error retrieving key pair", "error", err)
+		return nil, err
+	}
+
+	logger(ctx).Debug("returning key pair", "data", toRedactedJSON(keypair))
+	return keypair, nil
+}
+
+// getOpenStackKeyPairDetails returns the full key pair, which Nova only
+// returns one at a time.
+func getOpenStackKeyPairDetails(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	keypair := h.Item.(*apiKeyPair)
+	if !time.Time(keypair.CreatedAt).IsZero() {
+		return keypair, nil
+	}
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+	details := &apiKeyPair{}
+	if err := keypairs.Get(client, keypair.Name, keypairs.GetOpts{UserID: keypair.UserID}).ExtractInto(&struct {
+		KeyPair *apiKeyPair `json:"keypair"`
+	}{details}); err != nil {
+		logger(ctx).Error("error retrieving key pair", "name", keypair.Name, "user", keypair.UserID, "error", err)
+		return nil, err
+	}
+	return details, nil
+}
+
+// getOpenStackKeyPairUserName resolves the name of the key pair's user.
+func getOpenStackKeyPairUserName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	keypair := h.Item.(*apiKeyPair)
+	return lookupName(ctx, d, userLookup, keypair.UserID)
+}
+
+// apiKeyPair adds to keypairs.KeyPair the creation time, which Nova only
+// returns when getting a single key pair.
+type apiKeyPair struct {
+	Name        string `json:"name"`
+	UserID      string `json:"user_id"`
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"public_key"`
+	CreatedAt   Time   `json:"created_at"`
+}
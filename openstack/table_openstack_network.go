@@ -2,9 +2,11 @@ package openstack
 
 import (
 	"context"
+	"net/url"
 
 	"github.com/dihedron/steampipe-plugin-utils/utils"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
@@ -14,8 +16,9 @@ import (
 
 func tableOpenStackNetwork(_ context.Context) *plugin.Table {
 	return &plugin.Table{
-		Name:        "openstack_network",
-		Description: "OpenStack Network",
+		Name:              "openstack_network",
+		Description:       "OpenStack Network",
+		GetMatrixItemFunc: regionMatrix(NetworkV2),
 		Columns: []*plugin.Column{
 			{
 				Name:        "id",
@@ -41,6 +44,13 @@ func tableOpenStackNetwork(_ context.Context) *plugin.Table {
 				Description: "The ID of the project owning this network.",
 				Transform:   transform.FromField("ProjectID"),
 			},
+			{
+				Name:        "project_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the project owning this network.",
+				Hydrate:     getOpenStackNetworkProjectName,
+				Transform:   transform.FromValue(),
+			},
 			{
 				Name:        "admin_state_up",
 				Type:        proto.ColumnType_BOOL,
@@ -169,26 +179,32 @@ func tableOpenStackNetwork(_ context.Context) *plugin.Table {
 			},
 			{
 				Name:        "created_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "Timestamp when the port was created.",
 				Transform:   transform.FromField("CreatedAt").Transform(ToTime),
 			},
 			{
 				Name:        "updated_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "Timestamp when the port was last updated.",
 				Transform:   transform.FromField("UpdatedAt").Transform(ToTime),
 			},
 			{
 				Name:        "tags",
 				Type:        proto.ColumnType_JSON,
-				Description: "Tags is a list of security group tags. Tags are arbitrarily defined strings attached to a security group.",
+				Description: "Tags is a list of network tags. Tags are arbitrarily defined strings attached to a network.",
 				Transform:   transform.FromField("Tags"),
 			},
+			tagFilterColumn("tags_all"),
+			tagFilterColumn("tags_any"),
+			tagFilterColumn("not_tags"),
+			tagFilterColumn("not_tags_any"),
+			regionColumn(),
 		},
 		List: &plugin.ListConfig{
 			Hydrate: listOpenStackNetwork,
 			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
 				&plugin.KeyColumn{
 					Name:    "id",
 					Require: plugin.Optional,
@@ -217,12 +233,20 @@ func tableOpenStackNetwork(_ context.Context) *plugin.Table {
 					Name:    "admin_state_up",
 					Require: plugin.Optional,
 				},
-				// TODO: add tags support
+				timeKeyColumn("created_at"),
+				timeKeyColumn("updated_at"),
+				tagKeyColumn("tags_all"),
+				tagKeyColumn("tags_any"),
+				tagKeyColumn("not_tags"),
+				tagKeyColumn("not_tags_any"),
 			},
 		},
 		Get: &plugin.GetConfig{
 			KeyColumns: plugin.SingleColumn("id"),
 			Hydrate:    getOpenStackNetwork,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
 		},
 	}
 }
@@ -233,35 +257,60 @@ func listOpenStackNetwork(ctx context.Context, d *plugin.QueryData, h *plugin.Hy
 
 	setLogLevel(ctx, d)
 
-	plugin.Logger(ctx).Debug("retrieving openstack networks list", "query data", utils.ToPrettyJSON(d))
+	logger(ctx).Debug("retrieving openstack networks list", "query data", toRedactedJSON(d))
 
 	client, err := getServiceClient(ctx, d, NetworkV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
-	opts := buildOpenStackNetworkFilter(ctx, d.EqualsQuals)
-
-	allPages, err := networks.List(client, opts).AllPages()
+	ranges := getTimeRanges(d.Quals, "created_at", "updated_at")
+	tags := getTagFilter(d.EqualsQuals)
+	opts := buildOpenStackNetworkFilter(ctx, d.EqualsQuals, ranges, tags)
+	opts.Fields = networkFields.selected(d, filterFields("project_id", ranges, tags)...)
+	allowed, err := getAllowedProjects(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("error listing networks with options", "options", utils.ToPrettyJSON(opts), "error", err)
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
-	allNetworks, err := networks.ExtractNetworks(allPages)
-	if err != nil {
-		plugin.Logger(ctx).Error("error extracting networks", "error", err)
-		return nil, err
+	if !allowed.restrict(&opts.ProjectID) {
+		logger(ctx).Debug("project not allowed, exit")
+		return nil, nil
 	}
-	plugin.Logger(ctx).Debug("networks retrieved", "count", len(allNetworks))
 
-	for _, network := range allNetworks {
-		if ctx.Err() != nil {
-			plugin.Logger(ctx).Debug("context done, exit")
-			break
+	opts.Limit = getPageSize(ctx, d)
+	err = networks.List(client, opts).EachPage(func(page pagination.Page) (bool, error) {
+		allNetworks, err := networks.ExtractNetworks(page)
+		if err != nil {
+			logger(ctx).Error("error extracting networks", "error", err)
+			return false, err
+		}
+		logger(ctx).Debug("networks retrieved", "count", len(allNetworks))
+
+		for _, network := range allNetworks {
+			if ctx.Err() != nil {
+				logger(ctx).Debug("context done, exit")
+				return false, nil
+			}
+			network := network
+			if !allowed.contains(network.ProjectID) {
+				continue
+			}
+			if !ranges.match("created_at", network.CreatedAt) || !ranges.match("updated_at", network.UpdatedAt) || !tags.match(network.Tags) {
+				continue
+			}
+			d.StreamListItem(ctx, &network)
+			if d.RowsRemaining(ctx) == 0 {
+				logger(ctx).Debug("row limit reached, exit")
+				return false, nil
+			}
 		}
-		network := network
-		d.StreamListItem(ctx, &network)
+		return true, nil
+	})
+	if err = ignoreForbidden(ctx, d, err); err != nil {
+		logger(ctx).Error("error listing networks with options", "options", toRedactedJSON(opts), "error", err)
+		return nil, err
 	}
 	return nil, nil
 }
@@ -273,27 +322,50 @@ func getOpenStackNetwork(ctx context.Context, d *plugin.QueryData, h *plugin.Hyd
 	setLogLevel(ctx, d)
 
 	id := d.EqualsQuals["id"].GetStringValue()
-	plugin.Logger(ctx).Debug("retrieving openstack network", "id", id)
+	logger(ctx).Debug("retrieving openstack network", "id", id)
 
 	client, err := getServiceClient(ctx, d, NetworkV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
-	result := networks.Get(client, id)
+	// networks.Get takes no query parameters, so the fields are added to the URL
+	result := networks.GetResult{}
+	_, result.Err = client.Get(withFields(client.ServiceURL("networks", id), networkFields.selected(d, "id", "project_id")), &result.Body, nil)
 	var network *networks.Network
 	network, err = result.Extract()
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving network", "error", err)
+		logger(ctx).Error("error retrieving network", "error", err)
+		return nil, err
+	}
+
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
+	if !allowed.contains(network.ProjectID) {
+		logger(ctx).Debug("project not allowed", "project", network.ProjectID)
+		return nil, nil
+	}
 
 	return network, nil
 }
 
-func buildOpenStackNetworkFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap) networks.ListOpts {
-	opts := networks.ListOpts{}
+// getOpenStackNetworkProjectName resolves the name of the network's project.
+func getOpenStackNetworkProjectName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	network := h.Item.(*networks.Network)
+	return lookupName(ctx, d, projectLookup, network.ProjectID)
+}
+
+func buildOpenStackNetworkFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap, ranges timeRanges, tags tagFilter) networkListOpts {
+	opts := networkListOpts{}
+	opts.Tags = tags.Tags
+	opts.TagsAny = tags.TagsAny
+	opts.NotTags = tags.NotTags
+	opts.NotTagsAny = tags.NotTagsAny
 
 	if value, ok := quals["id"]; ok {
 		opts.ID = value.GetStringValue()
@@ -317,6 +389,60 @@ func buildOpenStackNetworkFilter(ctx context.Context, quals plugin.KeyColumnEqua
 		opts.Shared = utils.PointerTo(value.GetBoolValue())
 	}
 
-	plugin.Logger(ctx).Debug("returning", "filter", utils.ToPrettyJSON(opts))
+	// Neutron can only filter on the last change, but since a network cannot
+	// change before being created, the lower bound of the creation time is
+	// a lower bound for the last change too
+	for _, since := range []string{ranges["created_at"].since(), ranges["updated_at"].since()} {
+		if since > opts.ChangedSince {
+			opts.ChangedSince = since
+		}
+	}
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
 	return opts
 }
+
+// networkListOpts adds to networks.ListOpts the changed_since filter of the
+// standard-attr-timestamp extension and the fields projection.
+type networkListOpts struct {
+	networks.ListOpts
+	ChangedSince string
+	Fields       []string
+}
+
+func (opts networkListOpts) ToNetworkListQuery() (string, error) {
+	query, err := opts.ListOpts.ToNetworkListQuery()
+	params := url.Values{}
+	if opts.ChangedSince != "" {
+		params.Set("changed_since", opts.ChangedSince)
+	}
+	if len(opts.Fields) > 0 {
+		params["fields"] = opts.Fields
+	}
+	return appendQuery(query, err, params)
+}
+
+// networkFields maps the network columns to the Neutron network fields.
+var networkFields = apiFields{
+	"id":                      {"id"},
+	"name":                    {"name"},
+	"description":             {"description"},
+	"project_id":              {"project_id"},
+	"project_name":            {"project_id"},
+	"admin_state_up":          {"admin_state_up"},
+	"availability_zone_hints": {"availability_zone_hints"},
+	"qos_policy_id":           {"qos_policy_id"},
+	"revision_number":         {"revision_number"},
+	"shared":                  {"shared"},
+	"status":                  {"status"},
+	"subnets":                 {"subnets"},
+	"vlan_transparent":        {"vlan_transparent"},
+	"is_default":              {"is_default"},
+	"created_at":              {"created_at"},
+	"updated_at":              {"updated_at"},
+	"tags":                    {"tags"},
+	"tags_all":                nil,
+	"tags_any":                nil,
+	"not_tags":                nil,
+	"not_tags_any":            nil,
+	"region":                  nil,
+}
@@ -2,9 +2,11 @@ package openstack
 
 import (
 	"context"
+	"net/url"
 
 	"github.com/dihedron/steampipe-plugin-utils/utils"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
@@ -14,8 +16,9 @@ import (
 
 func tableOpenStackPort(_ context.Context) *plugin.Table {
 	return &plugin.Table{
-		Name:        "openstack_port",
-		Description: "OpenStack Network Port",
+		Name:              "openstack_port",
+		Description:       "OpenStack Network Port",
+		GetMatrixItemFunc: regionMatrix(NetworkV2),
 		Columns: []*plugin.Column{
 			{
 				Name:        "id",
@@ -41,6 +44,13 @@ func tableOpenStackPort(_ context.Context) *plugin.Table {
 				Description: "Network that this port is associated with.",
 				Transform:   transform.FromField("NetworkID"),
 			},
+			{
+				Name:        "network_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "Name of the network that this port is associated with.",
+				Hydrate:     getOpenStackPortNetworkName,
+				Transform:   transform.FromValue(),
+			},
 			{
 				Name:        "admin_state_up",
 				Type:        proto.ColumnType_BOOL,
@@ -65,6 +75,13 @@ func tableOpenStackPort(_ context.Context) *plugin.Table {
 				Description: "The ID of the project owning this port.",
 				Transform:   transform.FromField("ProjectID"),
 			},
+			{
+				Name:        "project_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the project owning this port.",
+				Hydrate:     getOpenStackPortProjectName,
+				Transform:   transform.FromValue(),
+			},
 			{
 				Name:        "device_owner",
 				Type:        proto.ColumnType_STRING,
@@ -85,26 +102,38 @@ func tableOpenStackPort(_ context.Context) *plugin.Table {
 			},
 			{
 				Name:        "created_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "Timestamp when the port was created.",
 				Transform:   transform.FromField("CreatedAt").Transform(ToTime),
 			},
 			{
 				Name:        "updated_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "Timestamp when the port was last updated.",
 				Transform:   transform.FromField("UpdatedAt").Transform(ToTime),
 			},
+			{
+				Name:        "tags",
+				Type:        proto.ColumnType_JSON,
+				Description: "Tags is a list of port tags. Tags are arbitrarily defined strings attached to a port.",
+				Transform:   transform.FromField("Tags"),
+			},
 			{
 				Name:        "security_group_ids",
 				Type:        proto.ColumnType_STRING,
 				Description: "The IDs of the security groups that apply to the current port.",
 				Transform:   transform.FromField("SecurityGroups").Transform(transform.EnsureStringArray),
 			},
+			tagFilterColumn("tags_all"),
+			tagFilterColumn("tags_any"),
+			tagFilterColumn("not_tags"),
+			tagFilterColumn("not_tags_any"),
+			regionColumn(),
 		},
 		List: &plugin.ListConfig{
 			Hydrate: listOpenStackPort,
 			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
 				&plugin.KeyColumn{
 					Name:    "id",
 					Require: plugin.Optional,
@@ -145,12 +174,20 @@ func tableOpenStackPort(_ context.Context) *plugin.Table {
 					Name:    "mac_address",
 					Require: plugin.Optional,
 				},
-				// TODO: add tags support
+				timeKeyColumn("created_at"),
+				timeKeyColumn("updated_at"),
+				tagKeyColumn("tags_all"),
+				tagKeyColumn("tags_any"),
+				tagKeyColumn("not_tags"),
+				tagKeyColumn("not_tags_any"),
 			},
 		},
 		Get: &plugin.GetConfig{
 			KeyColumns: plugin.SingleColumn("id"),
 			Hydrate:    getOpenStackPort,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
 		},
 	}
 }
@@ -161,35 +198,60 @@ func listOpenStackPort(ctx context.Context, d *plugin.QueryData, h *plugin.Hydra
 
 	setLogLevel(ctx, d)
 
-	plugin.Logger(ctx).Debug("retrieving openstack ports list", "query data", utils.ToPrettyJSON(d))
+	logger(ctx).Debug("retrieving openstack ports list", "query data", toRedactedJSON(d))
 
 	client, err := getServiceClient(ctx, d, NetworkV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
-	opts := buildOpenStackPortFilter(ctx, d.EqualsQuals)
-
-	allPages, err := ports.List(client, opts).AllPages()
+	ranges := getTimeRanges(d.Quals, "created_at", "updated_at")
+	tags := getTagFilter(d.EqualsQuals)
+	opts := buildOpenStackPortFilter(ctx, d.EqualsQuals, ranges, tags)
+	opts.Fields = portFields.selected(d, filterFields("project_id", ranges, tags)...)
+	allowed, err := getAllowedProjects(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("error listing ports with options", "options", utils.ToPrettyJSON(opts), "error", err)
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
-	allPorts, err := ports.ExtractPorts(allPages)
-	if err != nil {
-		plugin.Logger(ctx).Error("error extracting ports", "error", err)
-		return nil, err
+	if !allowed.restrict(&opts.ProjectID) {
+		logger(ctx).Debug("project not allowed, exit")
+		return nil, nil
 	}
-	plugin.Logger(ctx).Debug("ports retrieved", "count", len(allPorts))
 
-	for _, port := range allPorts {
-		if ctx.Err() != nil {
-			plugin.Logger(ctx).Debug("context done, exit")
-			break
+	opts.Limit = getPageSize(ctx, d)
+	err = ports.List(client, opts).EachPage(func(page pagination.Page) (bool, error) {
+		allPorts, err := ports.ExtractPorts(page)
+		if err != nil {
+			logger(ctx).Error("error extracting ports", "error", err)
+			return false, err
 		}
-		port := port
-		d.StreamListItem(ctx, &port)
+		logger(ctx).Debug("ports retrieved", "count", len(allPorts))
+
+		for _, port := range allPorts {
+			if ctx.Err() != nil {
+				logger(ctx).Debug("context done, exit")
+				return false, nil
+			}
+			port := port
+			if !allowed.contains(port.ProjectID) {
+				continue
+			}
+			if !ranges.match("created_at", port.CreatedAt) || !ranges.match("updated_at", port.UpdatedAt) || !tags.match(port.Tags) {
+				continue
+			}
+			d.StreamListItem(ctx, &port)
+			if d.RowsRemaining(ctx) == 0 {
+				logger(ctx).Debug("row limit reached, exit")
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err = ignoreForbidden(ctx, d, err); err != nil {
+		logger(ctx).Error("error listing ports with options", "options", toRedactedJSON(opts), "error", err)
+		return nil, err
 	}
 	return nil, nil
 }
@@ -201,27 +263,57 @@ func getOpenStackPort(ctx context.Context, d *plugin.QueryData, h *plugin.Hydrat
 	setLogLevel(ctx, d)
 
 	id := d.EqualsQuals["id"].GetStringValue()
-	plugin.Logger(ctx).Debug("retrieving openstack port", "id", id)
+	logger(ctx).Debug("retrieving openstack port", "id", id)
 
 	client, err := getServiceClient(ctx, d, NetworkV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
-	result := ports.Get(client, id)
+	// ports.Get takes no query parameters, so the fields are added to the URL
+	result := ports.GetResult{}
+	_, result.Err = client.Get(withFields(client.ServiceURL("ports", id), portFields.selected(d, "id", "project_id")), &result.Body, nil)
 	var port *ports.Port
 	port, err = result.Extract()
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving port", "error", err)
+		logger(ctx).Error("error retrieving port", "error", err)
+		return nil, err
+	}
+
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
+	if !allowed.contains(port.ProjectID) {
+		logger(ctx).Debug("project not allowed", "project", port.ProjectID)
+		return nil, nil
+	}
 
 	return port, nil
 }
 
-func buildOpenStackPortFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap) ports.ListOpts {
-	opts := ports.ListOpts{}
+// getOpenStackPortNetworkName resolves the name of the port's network.
+func getOpenStackPortNetworkName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	port := h.Item.(*ports.Port)
+	return lookupName(ctx, d, networkLookup, port.NetworkID)
+}
+
+// getOpenStackPortProjectName resolves the name of the port's project.
+func getOpenStackPortProjectName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	port := h.Item.(*ports.Port)
+	return lookupName(ctx, d, projectLookup, port.ProjectID)
+}
+
+func buildOpenStackPortFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap, ranges timeRanges, tags tagFilter) portListOpts {
+	opts := portListOpts{}
+	opts.Tags = tags.Tags
+	opts.TagsAny = tags.TagsAny
+	opts.NotTags = tags.NotTags
+	opts.NotTagsAny = tags.NotTagsAny
 
 	if value, ok := quals["id"]; ok {
 		opts.ID = value.GetStringValue()
@@ -253,6 +345,60 @@ func buildOpenStackPortFilter(ctx context.Context, quals plugin.KeyColumnEqualsQ
 	if value, ok := quals["mac_address"]; ok {
 		opts.MACAddress = value.GetStringValue()
 	}
-	plugin.Logger(ctx).Debug("returning", "filter", utils.ToPrettyJSON(opts))
+	// Neutron can only filter on the last change, but since a port cannot
+	// change before being created, the lower bound of the creation time is
+	// a lower bound for the last change too
+	for _, since := range []string{ranges["created_at"].since(), ranges["updated_at"].since()} {
+		if since > opts.ChangedSince {
+			opts.ChangedSince = since
+		}
+	}
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
 	return opts
 }
+
+// portListOpts adds to ports.ListOpts the changed_since filter of the
+// standard-attr-timestamp extension and the fields projection.
+type portListOpts struct {
+	ports.ListOpts
+	ChangedSince string
+	Fields       []string
+}
+
+func (opts portListOpts) ToPortListQuery() (string, error) {
+	query, err := opts.ListOpts.ToPortListQuery()
+	params := url.Values{}
+	if opts.ChangedSince != "" {
+		params.Set("changed_since", opts.ChangedSince)
+	}
+	if len(opts.Fields) > 0 {
+		params["fields"] = opts.Fields
+	}
+	return appendQuery(query, err, params)
+}
+
+// portFields maps the port columns to the Neutron port fields.
+var portFields = apiFields{
+	"id":                 {"id"},
+	"name":               {"name"},
+	"description":        {"description"},
+	"network_id":         {"network_id"},
+	"network_name":       {"network_id"},
+	"admin_state_up":     {"admin_state_up"},
+	"status":             {"status"},
+	"mac_address":        {"mac_address"},
+	"project_id":         {"project_id"},
+	"project_name":       {"project_id"},
+	"device_owner":       {"device_owner"},
+	"device_id":          {"device_id"},
+	"revision_number":    {"revision_number"},
+	"created_at":         {"created_at"},
+	"updated_at":         {"updated_at"},
+	"tags":               {"tags"},
+	"security_group_ids": {"security_groups"},
+	"tags_all":           nil,
+	"tags_any":           nil,
+	"not_tags":           nil,
+	"not_tags_any":       nil,
+	"region":             nil,
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/dihedron/steampipe-plugin-utils/utils"
 	"github.com/gophercloud/gophercloud/openstack/identity/v3/projects"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/users"
+	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
@@ -14,8 +16,9 @@ import (
 
 func tableOpenStackProject(_ context.Context) *plugin.Table {
 	return &plugin.Table{
-		Name:        "openstack_project",
-		Description: "OpenStack Project (aka Tenant)",
+		Name:              "openstack_project",
+		Description:       "OpenStack Project (aka Tenant)",
+		GetMatrixItemFunc: regionMatrix(IdentityV3),
 		Columns: []*plugin.Column{
 			{
 				Name:        "id",
@@ -59,10 +62,22 @@ func tableOpenStackProject(_ context.Context) *plugin.Table {
 				Description: "The ID of the parent project.",
 				Transform:   transform.FromField("ParentID"),
 			},
+			{
+				Name:        "tags",
+				Type:        proto.ColumnType_JSON,
+				Description: "The list of tags associated with the project.",
+				Transform:   transform.FromField("Tags"),
+			},
+			tagFilterColumn("tags_all"),
+			tagFilterColumn("tags_any"),
+			tagFilterColumn("not_tags"),
+			tagFilterColumn("not_tags_any"),
+			regionColumn(),
 		},
 		List: &plugin.ListConfig{
 			Hydrate: listOpenStackProject,
 			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
 				&plugin.KeyColumn{
 					Name:    "name",
 					Require: plugin.Optional,
@@ -83,12 +98,18 @@ func tableOpenStackProject(_ context.Context) *plugin.Table {
 					Name:    "parent_id",
 					Require: plugin.Optional,
 				},
-				// TODO: add tags support
+				tagKeyColumn("tags_all"),
+				tagKeyColumn("tags_any"),
+				tagKeyColumn("not_tags"),
+				tagKeyColumn("not_tags_any"),
 			},
 		},
 		Get: &plugin.GetConfig{
 			KeyColumns: plugin.SingleColumn("id"),
 			Hydrate:    getOpenStackProject,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
 		},
 	}
 }
@@ -99,35 +120,68 @@ func listOpenStackProject(ctx context.Context, d *plugin.QueryData, h *plugin.Hy
 
 	setLogLevel(ctx, d)
 
-	plugin.Logger(ctx).Debug("retrieving openstack projects list", "query data", utils.ToPrettyJSON(d))
+	logger(ctx).Debug("retrieving openstack projects list", "query data", toRedactedJSON(d))
 
 	client, err := getServiceClient(ctx, d, IdentityV3)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
-	opts := buildOpenStackProjectFilter(ctx, d.EqualsQuals)
-
-	allPages, err := projects.List(client, opts).AllPages()
+	tags := getTagFilter(d.EqualsQuals)
+	opts := buildOpenStackProjectFilter(ctx, d.EqualsQuals, tags)
+	allowed, err := getAllowedProjects(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("error listing projects with options", "options", utils.ToPrettyJSON(opts), "error", err)
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
-	allProjects, err := projects.ExtractProjects(allPages)
-	if err != nil {
-		plugin.Logger(ctx).Error("error extracting projects", "error", err)
-		return nil, err
-	}
-	plugin.Logger(ctx).Debug("projects retrieved", "count", len(allProjects))
 
-	for _, project := range allProjects {
-		if ctx.Err() != nil {
-			plugin.Logger(ctx).Debug("context done, exit")
-			break
+	err = listWithPolicy(ctx, d, func(scoped bool) error {
+		pager := projects.List(client, opts)
+		if scoped {
+			// the projects the current user is a member of
+			_, userID, err := getTokenScope(ctx, d)
+			if err != nil {
+				return err
+			}
+			pager = users.ListProjects(client, userID)
 		}
-		project := project
-		d.StreamListItem(ctx, &project)
+		return pager.EachPage(func(page pagination.Page) (bool, error) {
+			allProjects, err := projects.ExtractProjects(page)
+			if err != nil {
+				logger(ctx).Error("error extracting projects", "error", err)
+				return false, err
+			}
+			logger(ctx).Debug("projects retrieved", "count", len(allProjects))
+
+			for _, project := range allProjects {
+				if ctx.Err() != nil {
+					logger(ctx).Debug("context done, exit")
+					return false, nil
+				}
+				project := project
+				if !allowed.contains(project.ID) {
+					continue
+				}
+				if !tags.match(project.Tags) {
+					continue
+				}
+				if scoped && !matchProjectFilter(&project, opts) {
+					// the projects of the user are not filtered by Keystone
+					continue
+				}
+				d.StreamListItem(ctx, &project)
+				if d.RowsRemaining(ctx) == 0 {
+					logger(ctx).Debug("row limit reached, exit")
+					return false, nil
+				}
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		logger(ctx).Error("error listing projects with options", "options", toRedactedJSON(opts), "error", err)
+		return nil, err
 	}
 	return nil, nil
 }
@@ -139,11 +193,11 @@ func getOpenStackProject(ctx context.Context, d *plugin.QueryData, h *plugin.Hyd
 	setLogLevel(ctx, d)
 
 	id := d.EqualsQuals["id"].GetStringValue()
-	plugin.Logger(ctx).Debug("retrieving openstack project", "id", id)
+	logger(ctx).Debug("retrieving openstack project", "id", id)
 
 	client, err := getServiceClient(ctx, d, IdentityV3)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
@@ -151,15 +205,30 @@ func getOpenStackProject(ctx context.Context, d *plugin.QueryData, h *plugin.Hyd
 	var project *projects.Project
 	project, err = result.Extract()
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving project", "error", err)
+		logger(ctx).Error("error retrieving project", "error", err)
 		return nil, err
 	}
 
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
+		return nil, err
+	}
+	if !allowed.contains(project.ID) {
+		logger(ctx).Debug("project not allowed", "project", project.ID)
+		return nil, nil
+	}
+
 	return project, nil
 }
 
-func buildOpenStackProjectFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap) projects.ListOpts {
-	opts := projects.ListOpts{}
+func buildOpenStackProjectFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap, tags tagFilter) projects.ListOpts {
+	opts := projects.ListOpts{
+		Tags:       tags.Tags,
+		TagsAny:    tags.TagsAny,
+		NotTags:    tags.NotTags,
+		NotTagsAny: tags.NotTagsAny,
+	}
 	if value, ok := quals["name"]; ok {
 		opts.Name = value.GetStringValue()
 	}
@@ -175,6 +244,16 @@ func buildOpenStackProjectFilter(ctx context.Context, quals plugin.KeyColumnEqua
 	if value, ok := quals["parent_id"]; ok {
 		opts.ParentID = value.GetStringValue()
 	}
-	plugin.Logger(ctx).Debug("returning", "filter", utils.ToPrettyJSON(opts))
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
 	return opts
 }
+
+// matchProjectFilter returns whether the project matches the filters that
+// projects.List passes down to Keystone, for the lists that take none.
+func matchProjectFilter(project *projects.Project, opts projects.ListOpts) bool {
+	return (opts.Name == "" || project.Name == opts.Name) &&
+		(opts.IsDomain == nil || project.IsDomain == *opts.IsDomain) &&
+		(opts.DomainID == "" || project.DomainID == opts.DomainID) &&
+		(opts.Enabled == nil || project.Enabled == *opts.Enabled) &&
+		(opts.ParentID == "" || project.ParentID == opts.ParentID)
+}
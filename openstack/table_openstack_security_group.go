@@ -3,9 +3,10 @@ package openstack
 import (
 	"context"
 
-	"github.com/dihedron/steampipe-plugin-utils/utils"
+	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
@@ -15,8 +16,9 @@ import (
 
 func tableOpenStackSecurityGroup(ctx context.Context) *plugin.Table {
 	return &plugin.Table{
-		Name:        "openstack_security_group",
-		Description: "OpenStack Security Group",
+		Name:              "openstack_security_group",
+		Description:       "OpenStack Security Group",
+		GetMatrixItemFunc: regionMatrix(NetworkV2),
 		Columns: []*plugin.Column{
 			{
 				Name:        "id",
@@ -43,14 +45,21 @@ func tableOpenStackSecurityGroup(ctx context.Context) *plugin.Table {
 				Transform:   transform.FromField("TenantID"),
 			},
 			{
-				Name:        "created_at",
+				Name:        "project_name",
 				Type:        proto.ColumnType_STRING,
+				Description: "The name of the security group's project (aka tenant)",
+				Hydrate:     getOpenStackSecurityGroupProjectName,
+				Transform:   transform.FromValue(),
+			},
+			{
+				Name:        "created_at",
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "The creation time of the security group",
 				Transform:   transform.FromField("CreatedAt").Transform(ToTime),
 			},
 			{
 				Name:        "updated_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "The update time of the security group",
 				Transform:   transform.FromField("UpdatedAt").Transform(ToTime),
 			},
@@ -72,10 +81,16 @@ func tableOpenStackSecurityGroup(ctx context.Context) *plugin.Table {
 				Description: "The security group rules that belong to the current security group.",
 				Transform:   transform.FromField("Rules"), //.Transform(transform.EnsureStringArray),
 			},
+			tagFilterColumn("tags_all"),
+			tagFilterColumn("tags_any"),
+			tagFilterColumn("not_tags"),
+			tagFilterColumn("not_tags_any"),
+			regionColumn(),
 		},
 		List: &plugin.ListConfig{
 			Hydrate: listOpenStackSecurityGroup,
 			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
 				&plugin.KeyColumn{
 					Name:    "id",
 					Require: plugin.Optional,
@@ -92,11 +107,20 @@ func tableOpenStackSecurityGroup(ctx context.Context) *plugin.Table {
 					Name:    "project_id",
 					Require: plugin.Optional,
 				},
+				timeKeyColumn("created_at"),
+				timeKeyColumn("updated_at"),
+				tagKeyColumn("tags_all"),
+				tagKeyColumn("tags_any"),
+				tagKeyColumn("not_tags"),
+				tagKeyColumn("not_tags_any"),
 			},
 		},
 		Get: &plugin.GetConfig{
 			KeyColumns: plugin.SingleColumn("id"),
 			Hydrate:    getOpenStackSecurityGroup,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
 		},
 	}
 }
@@ -107,35 +131,62 @@ func listOpenStackSecurityGroup(ctx context.Context, d *plugin.QueryData, h *plu
 
 	setLogLevel(ctx, d)
 
-	plugin.Logger(ctx).Debug("list security groups", "query data", utils.ToPrettyJSON(d), "hydrate data", utils.ToPrettyJSON(h))
+	logger(ctx).Debug("list security groups", "query data", toRedactedJSON(d), "hydrate data", toRedactedJSON(h))
 
 	client, err := getServiceClient(ctx, d, NetworkV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
-	opts := buildOpenStackSecurityGroupFilter(ctx, d.EqualsQuals)
-
-	allPages, err := groups.List(client, opts).AllPages()
+	// the security groups API takes no time filters, so quals on time
+	// columns are applied client-side
+	ranges := getTimeRanges(d.Quals, "created_at", "updated_at")
+	tags := getTagFilter(d.EqualsQuals)
+	opts := buildOpenStackSecurityGroupFilter(ctx, d.EqualsQuals, tags)
+	allowed, err := getAllowedProjects(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("error listing security groups with options", "options", utils.ToPrettyJSON(opts), "error", err)
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
-	allGroups, err := groups.ExtractGroups(allPages)
-	if err != nil {
-		plugin.Logger(ctx).Error("error extracting groups", "error", err)
-		return nil, err
+	if !allowed.restrict(&opts.ProjectID) {
+		logger(ctx).Debug("project not allowed, exit")
+		return nil, nil
 	}
-	plugin.Logger(ctx).Debug("groups retrieved", "count", len(allGroups))
 
-	for _, group := range allGroups {
-		if ctx.Err() != nil {
-			plugin.Logger(ctx).Debug("context done, exit")
-			break
+	opts.Limit = getPageSize(ctx, d)
+	fields := securityGroupFields.selected(d, filterFields("project_id", ranges, tags)...)
+	err = listSecurityGroups(client, opts, fields).EachPage(func(page pagination.Page) (bool, error) {
+		allGroups, err := groups.ExtractGroups(page)
+		if err != nil {
+			logger(ctx).Error("error extracting groups", "error", err)
+			return false, err
+		}
+		logger(ctx).Debug("groups retrieved", "count", len(allGroups))
+
+		for _, group := range allGroups {
+			if ctx.Err() != nil {
+				logger(ctx).Debug("context done, exit")
+				return false, nil
+			}
+			group := group
+			if !allowed.contains(group.ProjectID) {
+				continue
+			}
+			if !ranges.match("created_at", group.CreatedAt) || !ranges.match("updated_at", group.UpdatedAt) || !tags.match(group.Tags) {
+				continue
+			}
+			d.StreamListItem(ctx, &group)
+			if d.RowsRemaining(ctx) == 0 {
+				logger(ctx).Debug("row limit reached, exit")
+				return false, nil
+			}
 		}
-		group := group
-		d.StreamListItem(ctx, &group)
+		return true, nil
+	})
+	if err = ignoreForbidden(ctx, d, err); err != nil {
+		logger(ctx).Error("error listing security groups with options", "options", toRedactedJSON(opts), "error", err)
+		return nil, err
 	}
 	return nil, nil
 
@@ -148,27 +199,51 @@ func getOpenStackSecurityGroup(ctx context.Context, d *plugin.QueryData, h *plug
 	setLogLevel(ctx, d)
 
 	id := d.EqualsQuals["id"].GetStringValue()
-	plugin.Logger(ctx).Debug("retrieving openstack security group", "id", id)
+	logger(ctx).Debug("retrieving openstack security group", "id", id)
 
 	client, err := getServiceClient(ctx, d, NetworkV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
-	result := groups.Get(client, id)
+	// groups.Get takes no query parameters, so the fields are added to the URL
+	result := groups.GetResult{}
+	_, result.Err = client.Get(withFields(client.ServiceURL("security-groups", id), securityGroupFields.selected(d, "id", "project_id")), &result.Body, nil)
 	var group *groups.SecGroup
 	group, err = result.Extract()
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving security group", "error", err)
+		logger(ctx).Error("error retrieving security group", "error", err)
 		return nil, err
 	}
 
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
+		return nil, err
+	}
+	if !allowed.contains(group.ProjectID) {
+		logger(ctx).Debug("project not allowed", "project", group.ProjectID)
+		return nil, nil
+	}
+
 	return group, nil
 }
 
-func buildOpenStackSecurityGroupFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap) groups.ListOpts {
-	opts := groups.ListOpts{}
+// getOpenStackSecurityGroupProjectName resolves the name of the security group's project.
+func getOpenStackSecurityGroupProjectName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	group := h.Item.(*groups.SecGroup)
+	return lookupName(ctx, d, projectLookup, group.TenantID)
+}
+
+func buildOpenStackSecurityGroupFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap, tags tagFilter) groups.ListOpts {
+	opts := groups.ListOpts{
+		Tags:       tags.Tags,
+		TagsAny:    tags.TagsAny,
+		NotTags:    tags.NotTags,
+		NotTagsAny: tags.NotTagsAny,
+	}
 
 	if value, ok := quals["id"]; ok {
 		opts.ID = value.GetStringValue()
@@ -186,11 +261,22 @@ func buildOpenStackSecurityGroupFilter(ctx context.Context, quals plugin.KeyColu
 		opts.ProjectID = value.GetStringValue()
 	}
 
-	// TODO: handle tags
-	plugin.Logger(ctx).Debug("returning", "filter", utils.ToPrettyJSON(opts))
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
 	return opts
 }
 
+// listSecurityGroups is groups.List with the fields projection, which groups.ListOpts
+// does not support and, being passed by value, cannot be extended.
+func listSecurityGroups(client *gophercloud.ServiceClient, opts groups.ListOpts, fields []string) pagination.Pager {
+	query, err := gophercloud.BuildQueryString(&opts)
+	if err != nil {
+		return pagination.Pager{Err: err}
+	}
+	return pagination.NewPager(client, withFields(client.ServiceURL("security-groups")+query.String(), fields), func(r pagination.PageResult) pagination.Page {
+		return groups.SecGroupPage{LinkedPageBase: pagination.LinkedPageBase{PageResult: r}}
+	})
+}
+
 func extractSecGroupRuleIDs(_ context.Context, d *transform.TransformData) (interface{}, error) {
 	var values []string
 	if d.Value != nil {
@@ -202,3 +288,22 @@ func extractSecGroupRuleIDs(_ context.Context, d *transform.TransformData) (inte
 	}
 	return values, nil
 }
+
+// securityGroupFields maps the security group columns to the Neutron security group fields.
+var securityGroupFields = apiFields{
+	"id":                      {"id"},
+	"name":                    {"name"},
+	"description":             {"description"},
+	"project_id":              {"tenant_id"},
+	"project_name":            {"tenant_id"},
+	"created_at":              {"created_at"},
+	"updated_at":              {"updated_at"},
+	"tags":                    {"tags"},
+	"security_group_rule_ids": {"security_group_rules"},
+	"security_group_rules":    {"security_group_rules"},
+	"tags_all":                nil,
+	"tags_any":                nil,
+	"not_tags":                nil,
+	"not_tags_any":            nil,
+	"region":                  nil,
+}
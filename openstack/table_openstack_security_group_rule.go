@@ -3,9 +3,9 @@ package openstack
 import (
 	"context"
 
-	"github.com/dihedron/steampipe-plugin-utils/utils"
-	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/rules"
+	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
@@ -15,8 +15,9 @@ import (
 
 func tableOpenStackSecurityGroupRule(ctx context.Context) *plugin.Table {
 	return &plugin.Table{
-		Name:        "openstack_security_group_rule",
-		Description: "OpenStack Security Group Rule",
+		Name:              "openstack_security_group_rule",
+		Description:       "OpenStack Security Group Rule",
+		GetMatrixItemFunc: regionMatrix(NetworkV2),
 
 		Columns: []*plugin.Column{
 			{
@@ -38,14 +39,21 @@ func tableOpenStackSecurityGroupRule(ctx context.Context) *plugin.Table {
 				Transform:   transform.FromField("TenantID"),
 			},
 			{
-				Name:        "created_at",
+				Name:        "project_name",
 				Type:        proto.ColumnType_STRING,
+				Description: "The name of the project.",
+				Hydrate:     getOpenStackSecurityGroupRuleProjectName,
+				Transform:   transform.FromValue(),
+			},
+			{
+				Name:        "created_at",
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "Time at which the security group rule has been created (in UTC ISO8601 format).",
 				Transform:   transform.FromField("CreatedAt").Transform(ToTime),
 			},
 			{
 				Name:        "updated_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "Time at which the security group rule has been updated (in UTC ISO8601 format).",
 				Transform:   transform.FromField("UpdatedAt").Transform(ToTime),
 			},
@@ -55,6 +63,13 @@ func tableOpenStackSecurityGroupRule(ctx context.Context) *plugin.Table {
 				Description: "The remote group UUID to associate with this security group rule.",
 				Transform:   transform.FromField("RemoteGroupID"),
 			},
+			{
+				Name:        "remote_group_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the remote group associated with this security group rule.",
+				Hydrate:     getOpenStackSecurityGroupRuleRemoteGroupName,
+				Transform:   transform.FromValue(),
+			},
 			{
 				Name:        "direction",
 				Type:        proto.ColumnType_STRING,
@@ -89,7 +104,14 @@ func tableOpenStackSecurityGroupRule(ctx context.Context) *plugin.Table {
 				Name:        "security_group_id",
 				Type:        proto.ColumnType_STRING,
 				Description: "The security group ID to associate with this security group rule.",
-				Transform:   transform.FromField("SecurityGroupID"),
+				Transform:   transform.FromField("SecGroupID"),
+			},
+			{
+				Name:        "security_group_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the security group to associate with this security group rule.",
+				Hydrate:     getOpenStackSecurityGroupRuleSecurityGroupName,
+				Transform:   transform.FromValue(),
 			},
 			{
 				Name:        "remote_ip_prefix",
@@ -103,10 +125,12 @@ func tableOpenStackSecurityGroupRule(ctx context.Context) *plugin.Table {
 				Description: "The revision number of the resource.",
 				Transform:   transform.FromField("Revision"),
 			},
+			regionColumn(),
 		},
 		List: &plugin.ListConfig{
 			Hydrate: listOpenStackSecurityGroupRule,
 			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
 				&plugin.KeyColumn{
 					Name:    "id",
 					Require: plugin.Optional,
@@ -156,6 +180,9 @@ func tableOpenStackSecurityGroupRule(ctx context.Context) *plugin.Table {
 		Get: &plugin.GetConfig{
 			KeyColumns: plugin.SingleColumn("id"),
 			Hydrate:    getOpenStackSecurityGroupRule,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
 		},
 	}
 }
@@ -166,35 +193,55 @@ func listOpenStackSecurityGroupRule(ctx context.Context, d *plugin.QueryData, h
 
 	setLogLevel(ctx, d)
 
-	plugin.Logger(ctx).Debug("list security groups rules", "query data", utils.ToPrettyJSON(d), "hydrate data", utils.ToPrettyJSON(h))
+	logger(ctx).Debug("list security groups rules", "query data", toRedactedJSON(d), "hydrate data", toRedactedJSON(h))
 
 	client, err := getServiceClient(ctx, d, NetworkV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
 	opts := buildOpenStackSecurityGroupRuleFilter(ctx, d.EqualsQuals)
-
-	allPages, err := rules.List(client, opts).AllPages()
+	allowed, err := getAllowedProjects(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("error listing security group rules with options", "options", utils.ToPrettyJSON(opts), "error", err)
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
-	allRules, err := rules.ExtractRules(allPages)
-	if err != nil {
-		plugin.Logger(ctx).Error("error extracting rules", "error", err)
-		return nil, err
+	if !allowed.restrict(&opts.ProjectID) {
+		logger(ctx).Debug("project not allowed, exit")
+		return nil, nil
 	}
-	plugin.Logger(ctx).Debug("rules retrieved", "count", len(allRules))
 
-	for _, rule := range allRules {
-		if ctx.Err() != nil {
-			plugin.Logger(ctx).Debug("context done, exit")
-			break
+	opts.Limit = getPageSize(ctx, d)
+	fields := securityGroupRuleFields.selected(d, filterFields("project_id", nil, tagFilter{})...)
+	err = listSecurityGroupRules(client, opts, fields).EachPage(func(page pagination.Page) (bool, error) {
+		allRules, err := rules.ExtractRules(page)
+		if err != nil {
+			logger(ctx).Error("error extracting rules", "error", err)
+			return false, err
 		}
-		rule := rule
-		d.StreamListItem(ctx, &rule)
+		logger(ctx).Debug("rules retrieved", "count", len(allRules))
+
+		for _, rule := range allRules {
+			if ctx.Err() != nil {
+				logger(ctx).Debug("context done, exit")
+				return false, nil
+			}
+			rule := rule
+			if !allowed.contains(rule.ProjectID) {
+				continue
+			}
+			d.StreamListItem(ctx, &rule)
+			if d.RowsRemaining(ctx) == 0 {
+				logger(ctx).Debug("row limit reached, exit")
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err = ignoreForbidden(ctx, d, err); err != nil {
+		logger(ctx).Error("error listing security group rules with options", "options", toRedactedJSON(opts), "error", err)
+		return nil, err
 	}
 	return nil, nil
 }
@@ -206,23 +253,56 @@ func getOpenStackSecurityGroupRule(ctx context.Context, d *plugin.QueryData, h *
 	setLogLevel(ctx, d)
 
 	id := d.EqualsQuals["id"].GetStringValue()
-	plugin.Logger(ctx).Debug("retrieving openstack security group", "id", id)
+	logger(ctx).Debug("retrieving openstack security group rule", "id", id)
 
 	client, err := getServiceClient(ctx, d, NetworkV2)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	// rules.Get takes no query parameters, so the fields are added to the URL
+	result := rules.GetResult{}
+	_, result.Err = client.Get(withFields(client.ServiceURL("security-group-rules", id), securityGroupRuleFields.selected(d, "id", "project_id")), &result.Body, nil)
+	var rule *rules.SecGroupRule
+	rule, err = result.Extract()
+	if err != nil {
+		logger(ctx).Error("error retrieving security group rule", "error", err)
 		return nil, err
 	}
 
-	result := groups.Get(client, id)
-	var group *groups.SecGroup
-	group, err = result.Extract()
+	allowed, err := getAllowedProjects(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving security group", "error", err)
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
+	if !allowed.contains(rule.ProjectID) {
+		logger(ctx).Debug("project not allowed", "project", rule.ProjectID)
+		return nil, nil
+	}
+
+	return rule, nil
+}
 
-	return group, nil
+// getOpenStackSecurityGroupRuleProjectName resolves the name of the rule's project.
+func getOpenStackSecurityGroupRuleProjectName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	rule := h.Item.(*rules.SecGroupRule)
+	return lookupName(ctx, d, projectLookup, rule.TenantID)
+}
+
+// getOpenStackSecurityGroupRuleSecurityGroupName resolves the name of the rule's security group.
+func getOpenStackSecurityGroupRuleSecurityGroupName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	rule := h.Item.(*rules.SecGroupRule)
+	return lookupName(ctx, d, securityGroupLookup, rule.SecGroupID)
+}
+
+// getOpenStackSecurityGroupRuleRemoteGroupName resolves the name of the rule's remote group, if any.
+func getOpenStackSecurityGroupRuleRemoteGroupName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	rule := h.Item.(*rules.SecGroupRule)
+	return lookupName(ctx, d, securityGroupLookup, rule.RemoteGroupID)
 }
 
 func buildOpenStackSecurityGroupRuleFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap) rules.ListOpts {
@@ -287,10 +367,22 @@ func buildOpenStackSecurityGroupRuleFilter(ctx context.Context, quals plugin.Key
 		opts.RemoteIPPrefix = value.GetStringValue()
 	}
 
-	plugin.Logger(ctx).Debug("returning", "filter", utils.ToPrettyJSON(opts))
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
 	return opts
 }
 
+// listSecurityGroupRules is rules.List with the fields projection, which rules.ListOpts
+// does not support and, being passed by value, cannot be extended.
+func listSecurityGroupRules(client *gophercloud.ServiceClient, opts rules.ListOpts, fields []string) pagination.Pager {
+	query, err := gophercloud.BuildQueryString(&opts)
+	if err != nil {
+		return pagination.Pager{Err: err}
+	}
+	return pagination.NewPager(client, withFields(client.ServiceURL("security-group-rules")+query.String(), fields), func(r pagination.PageResult) pagination.Page {
+		return rules.SecGroupRulePage{LinkedPageBase: pagination.LinkedPageBase{PageResult: r}}
+	})
+}
+
 // func extractSecGroupRuleIDs(_ context.Context, d *transform.TransformData) (interface{}, error) {
 // 	var values []string
 // 	if d.Value != nil {
@@ -302,3 +394,25 @@ func buildOpenStackSecurityGroupRuleFilter(ctx context.Context, quals plugin.Key
 // 	}
 // 	return values, nil
 // }
+
+// securityGroupRuleFields maps the security group rule columns to the Neutron security group rule fields.
+var securityGroupRuleFields = apiFields{
+	"id":                  {"id"},
+	"description":         {"description"},
+	"project_id":          {"tenant_id"},
+	"project_name":        {"tenant_id"},
+	"created_at":          {"created_at"},
+	"updated_at":          {"updated_at"},
+	"remote_group_id":     {"remote_group_id"},
+	"remote_group_name":   {"remote_group_id"},
+	"direction":           {"direction"},
+	"protocol":            {"protocol"},
+	"ethertype":           {"ethertype"},
+	"port_range_min":      {"port_range_min"},
+	"port_range_max":      {"port_range_max"},
+	"security_group_id":   {"security_group_id"},
+	"security_group_name": {"security_group_id"},
+	"remote_ip_prefix":    {"remote_ip_prefix"},
+	"revision":            {"revision_number"},
+	"region":              nil,
+}
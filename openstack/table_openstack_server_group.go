@@ -0,0 +1,257 @@
+package openstack
+
+import (
+	"context"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/servergroups"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+//// TABLE DEFINITION
+
+func tableOpenStackServerGroup(_ context.Context) *plugin.Table {
+	return &plugin.Table{
+		Name:              "openstack_server_group",
+		Description:       "OpenStack Server Group",
+		GetMatrixItemFunc: regionMatrix(ComputeV2),
+		Columns: []*plugin.Column{
+			{
+				Name:        "id",
+				Type:        proto.ColumnType_STRING,
+				Description: "The unique id of the server group.",
+				Transform:   transform.FromField("ID"),
+			},
+			{
+				Name:        "name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the server group.",
+				Transform:   transform.FromField("Name"),
+			},
+			{
+				Name:        "policy",
+				Type:        proto.ColumnType_STRING,
+				Description: "The scheduling policy of the server group: affinity, anti-affinity, soft-affinity or soft-anti-affinity.",
+				Transform:   transform.From(serverGroupPolicy),
+			},
+			{
+				Name:        "rules",
+				Type:        proto.ColumnType_JSON,
+				Description: "The rules of the scheduling policy (microversion 2.64 and later).",
+				Transform:   transform.FromField("Rules"),
+			},
+			{
+				Name:        "max_server_per_host",
+				Type:        proto.ColumnType_INT,
+				Description: "The maximum number of members on the same host, for the anti-affinity policy (microversion 2.64 and later).",
+				Transform:   transform.FromField("Rules.max_server_per_host").Transform(transform.ToInt),
+			},
+			{
+				Name:        "members",
+				Type:        proto.ColumnType_JSON,
+				Description: "The ids of the instances in the server group.",
+				Transform:   transform.FromField("Members"),
+			},
+			{
+				Name:        "project_id",
+				Type:        proto.ColumnType_STRING,
+				Description: "The id of the project the server group belongs to.",
+				Transform:   transform.FromField("ProjectID"),
+			},
+			{
+				Name:        "project_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the project the server group belongs to.",
+				Hydrate:     getOpenStackServerGroupProjectName,
+				Transform:   transform.FromValue(),
+			},
+			{
+				Name:        "user_id",
+				Type:        proto.ColumnType_STRING,
+				Description: "The id of the user who created the server group.",
+				Transform:   transform.FromField("UserID"),
+			},
+			{
+				Name:        "user_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the user who created the server group.",
+				Hydrate:     getOpenStackServerGroupUserName,
+				Transform:   transform.FromValue(),
+			},
+			regionColumn(),
+		},
+		List: &plugin.ListConfig{
+			Hydrate: listOpenStackServerGroup,
+			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
+				&plugin.KeyColumn{
+					Name:    "project_id",
+					Require: plugin.Optional,
+				},
+			},
+		},
+		Get: &plugin.GetConfig{
+			KeyColumns: plugin.SingleColumn("id"),
+			Hydrate:    getOpenStackServerGroup,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
+		},
+	}
+}
+
+//// LIST FUNCTION
+
+func listOpenStackServerGroup(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	logger(ctx).Debug("retrieving openstack server groups list", "query data", toRedactedJSON(d))
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
+		return nil, err
+	}
+
+	// Nova has no project filter for server groups, so the qual is applied
+	// client-side
+	projectID := ""
+	if value, ok := d.EqualsQuals["project_id"]; ok {
+		projectID = value.GetStringValue()
+	}
+	if !allowed.restrict(&projectID) {
+		logger(ctx).Debug("project not allowed, exit")
+		return nil, nil
+	}
+
+	opts := servergroups.ListOpts{
+		Limit: getPageSize(ctx, d),
+	}
+	err = listWithPolicy(ctx, d, func(scoped bool) error {
+		opts.AllProjects = !scoped
+		// the server groups are paginated by offset, which servergroups.List
+		// does not follow: pages are requested until an empty one, since Nova
+		// caps them at its osapi_max_limit, which may be below the page size
+		for opts.Offset = 0; ; {
+			page, err := servergroups.List(client, opts).AllPages()
+			if err != nil {
+				return err
+			}
+			allGroups := []*apiServerGroup{}
+			if err := page.(servergroups.ServerGroupPage).ExtractIntoSlicePtr(&allGroups, "server_groups"); err != nil {
+				logger(ctx).Error("error extracting server groups", "error", err)
+				return err
+			}
+			logger(ctx).Debug("server groups retrieved", "count", len(allGroups))
+			if len(allGroups) == 0 {
+				return nil
+			}
+			opts.Offset += len(allGroups)
+
+			for _, group := range allGroups {
+				if ctx.Err() != nil {
+					logger(ctx).Debug("context done, exit")
+					return nil
+				}
+				if projectID != "" && group.ProjectID != projectID || !allowed.contains(group.ProjectID) {
+					continue
+				}
+				d.StreamListItem(ctx, group)
+				if d.RowsRemaining(ctx) == 0 {
+					logger(ctx).Debug("row limit reached, exit")
+					return nil
+				}
+			}
+		}
+	})
+	if err != nil {
+		logger(ctx).Error("error listing server groups with options", "options", toRedactedJSON(opts), "error", err)
+		return nil, err
+	}
+	return nil, nil
+}
+
+//// HYDRATE FUNCTIONS
+
+func getOpenStackServerGroup(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+
+	setLogLevel(ctx, d)
+
+	id := d.EqualsQuals["id"].GetStringValue()
+	logger(ctx).Debug("retrieving openstack server group", "id", id)
+
+	client, err := getServiceClient(ctx, d, ComputeV2)
+	if err != nil {
+		logger(ctx).Error("error retrieving client", "error", err)
+		return nil, err
+	}
+
+	group := &apiServerGroup{}
+	if err := servergroups.Get(client, id).ExtractInto(&struct {
+		ServerGroup *apiServerGroup `json:"server_group"`
+	}{group}); err != nil {
+		logger(ctx).Error("error retrieving server group", "error", err)
+		return nil, err
+	}
+
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
+		return nil, err
+	}
+	if !allowed.contains(group.ProjectID) {
+		logger(ctx).Debug("project not allowed", "project", group.ProjectID)
+		return nil, nil
+	}
+
+	logger(ctx).Debug("returning server group", "data", toRedactedJSON(group))
+	return group, nil
+}
+
+// getOpenStackServerGroupProjectName resolves the name of the server group's project.
+func getOpenStackServerGroupProjectName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	group := h.Item.(*apiServerGroup)
+	return lookupName(ctx, d, projectLookup, group.ProjectID)
+}
+
+// getOpenStackServerGroupUserName resolves the name of the server group's user.
+func getOpenStackServerGroupUserName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	group := h.Item.(*apiServerGroup)
+	return lookupName(ctx, d, userLookup, group.UserID)
+}
+
+// serverGroupPolicy returns the policy of the server group, which up to
+// microversion 2.63 is the only item in its list of policies.
+func serverGroupPolicy(_ context.Context, d *transform.TransformData) (interface{}, error) {
+	group := d.HydrateItem.(*apiServerGroup)
+	if group.Policy != "" {
+		return group.Policy, nil
+	}
+	if len(group.Policies) > 0 {
+		return group.Policies[0], nil
+	}
+	return nil, nil
+}
+
+// apiServerGroup replaces servergroups.ServerGroup to return the rules as
+// they are, rather than only those gophercloud knows about.
+type apiServerGroup struct {
+	ID        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Policy    string                 `json:"policy"`
+	Policies  []string               `json:"policies"`
+	Rules     map[string]interface{} `json:"rules"`
+	Members   []string               `json:"members"`
+	ProjectID string                 `json:"project_id"`
+	UserID    string                 `json:"user_id"`
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/dihedron/steampipe-plugin-utils/utils"
 	"github.com/gophercloud/gophercloud/openstack/identity/v3/users"
+	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
@@ -14,8 +15,9 @@ import (
 
 func tableOpenStackUser(_ context.Context) *plugin.Table {
 	return &plugin.Table{
-		Name:        "openstack_user",
-		Description: "OpenStack Users",
+		Name:              "openstack_user",
+		Description:       "OpenStack Users",
+		GetMatrixItemFunc: regionMatrix(IdentityV3),
 		Columns: []*plugin.Column{
 			{
 				Name:        "id",
@@ -41,6 +43,13 @@ func tableOpenStackUser(_ context.Context) *plugin.Table {
 				Description: "The ID of the default project of the user.",
 				Transform:   transform.FromField("DefaultProjectID"),
 			},
+			{
+				Name:        "default_project_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the default project of the user.",
+				Hydrate:     getOpenStackUserDefaultProjectName,
+				Transform:   transform.FromValue(),
+			},
 			{
 				Name:        "domain_id",
 				Type:        proto.ColumnType_STRING,
@@ -55,14 +64,16 @@ func tableOpenStackUser(_ context.Context) *plugin.Table {
 			},
 			{
 				Name:        "password_expires_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "The timestamp when the user's password expires.",
 				Transform:   transform.FromField("PasswordExpiresAt").Transform(ToTime),
 			},
+			regionColumn(),
 		},
 		List: &plugin.ListConfig{
 			Hydrate: listOpenStackUser,
 			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
 				&plugin.KeyColumn{
 					Name:    "id",
 					Require: plugin.Optional,
@@ -79,16 +90,15 @@ func tableOpenStackUser(_ context.Context) *plugin.Table {
 					Name:    "enabled",
 					Require: plugin.Optional,
 				},
-				&plugin.KeyColumn{
-					Name:    "password_expires_at",
-					Require: plugin.Optional,
-				},
-				// TODO: add tags support
+				timeKeyColumn("password_expires_at"),
 			},
 		},
 		Get: &plugin.GetConfig{
 			KeyColumns: plugin.SingleColumn("id"),
 			Hydrate:    getOpenStackUser,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
 		},
 	}
 }
@@ -99,36 +109,63 @@ func listOpenStackUser(ctx context.Context, d *plugin.QueryData, h *plugin.Hydra
 
 	setLogLevel(ctx, d)
 
-	plugin.Logger(ctx).Debug("retrieving openstack users list", "query data", utils.ToPrettyJSON(d))
+	logger(ctx).Debug("retrieving openstack users list", "query data", toRedactedJSON(d))
 
 	client, err := getServiceClient(ctx, d, IdentityV3)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
-	opts := buildOpenStackUserFilter(ctx, d.EqualsQuals)
-
-	allPages, err := users.List(client, opts).AllPages()
-	if err != nil {
-		plugin.Logger(ctx).Error("error listing users with options", "options", utils.ToPrettyJSON(opts), "error", err)
-		return nil, err
-	}
-	allUsers, err := users.ExtractUsers(allPages)
+	ranges := getTimeRanges(d.Quals, "password_expires_at")
+	opts := buildOpenStackUserFilter(ctx, d.EqualsQuals, ranges)
+
+	err = listWithPolicy(ctx, d, func(scoped bool) error {
+		if scoped {
+			// only the current user
+			_, userID, err := getTokenScope(ctx, d)
+			if err != nil {
+				return err
+			}
+			user, err := users.Get(client, userID).Extract()
+			if err != nil {
+				return err
+			}
+			if ranges.match("password_expires_at", user.PasswordExpiresAt) {
+				d.StreamListItem(ctx, user)
+			}
+			return nil
+		}
+		return users.List(client, opts).EachPage(func(page pagination.Page) (bool, error) {
+			allUsers, err := users.ExtractUsers(page)
+			if err != nil {
+				logger(ctx).Error("error extracting users", "error", err)
+				return false, err
+			}
+			logger(ctx).Debug("users retrieved", "count", len(allUsers))
+
+			for _, user := range allUsers {
+				if ctx.Err() != nil {
+					logger(ctx).Debug("context done, exit")
+					return false, nil
+				}
+				user := user
+				if !ranges.match("password_expires_at", user.PasswordExpiresAt) {
+					continue
+				}
+				d.StreamListItem(ctx, &user)
+				if d.RowsRemaining(ctx) == 0 {
+					logger(ctx).Debug("row limit reached, exit")
+					return false, nil
+				}
+			}
+			return true, nil
+		})
+	})
 	if err != nil {
-		plugin.Logger(ctx).Error("error extracting users", "error", err)
+		logger(ctx).Error("error listing users with options", "options", toRedactedJSON(opts), "error", err)
 		return nil, err
 	}
-	plugin.Logger(ctx).Debug("users retrieved", "count", len(allUsers))
-
-	for _, user := range allUsers {
-		if ctx.Err() != nil {
-			plugin.Logger(ctx).Debug("context done, exit")
-			break
-		}
-		user := user
-		d.StreamListItem(ctx, &user)
-	}
 	return nil, nil
 }
 
@@ -139,11 +176,11 @@ func getOpenStackUser(ctx context.Context, d *plugin.QueryData, h *plugin.Hydrat
 	setLogLevel(ctx, d)
 
 	id := d.EqualsQuals["id"].GetStringValue()
-	plugin.Logger(ctx).Debug("retrieving openstack user", "id", id)
+	logger(ctx).Debug("retrieving openstack user", "id", id)
 
 	client, err := getServiceClient(ctx, d, IdentityV3)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
@@ -151,14 +188,21 @@ func getOpenStackUser(ctx context.Context, d *plugin.QueryData, h *plugin.Hydrat
 	var user *users.User
 	user, err = result.Extract()
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving user", "error", err)
+		logger(ctx).Error("error retrieving user", "error", err)
 		return nil, err
 	}
 
 	return user, nil
 }
 
-func buildOpenStackUserFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap) users.ListOpts {
+// getOpenStackUserDefaultProjectName resolves the name of the user's default project.
+func getOpenStackUserDefaultProjectName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	user := h.Item.(*users.User)
+	return lookupName(ctx, d, projectLookup, user.DefaultProjectID)
+}
+
+func buildOpenStackUserFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap, ranges timeRanges) users.ListOpts {
 	opts := users.ListOpts{}
 	if value, ok := quals["id"]; ok {
 		opts.UniqueID = value.GetStringValue()
@@ -172,9 +216,9 @@ func buildOpenStackUserFilter(ctx context.Context, quals plugin.KeyColumnEqualsQ
 	if value, ok := quals["enabled"]; ok {
 		opts.Enabled = utils.PointerTo(value.GetBoolValue())
 	}
-	if value, ok := quals["password_expires_at"]; ok {
-		opts.PasswordExpiresAt = value.GetStringValue()
-	}
-	plugin.Logger(ctx).Debug("returning", "filter", utils.ToPrettyJSON(opts))
+	// Keystone takes a single "<operator>:<timestamp>" filter, the other
+	// bound of the range (if any) is applied client-side
+	opts.PasswordExpiresAt = ranges["password_expires_at"].filterString()
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
 	return opts
 }
@@ -2,11 +2,13 @@ package openstack
 
 import (
 	"context"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/dihedron/steampipe-plugin-utils/utils"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
@@ -16,8 +18,9 @@ import (
 
 func tableOpenStackVolume(_ context.Context) *plugin.Table {
 	return &plugin.Table{
-		Name:        "openstack_volume",
-		Description: "OpenStack Disk Volume",
+		Name:              "openstack_volume",
+		Description:       "OpenStack Disk Volume",
+		GetMatrixItemFunc: regionMatrix(BlockStorageV3),
 		Columns: []*plugin.Column{
 			{
 				Name:        "id",
@@ -43,12 +46,26 @@ func tableOpenStackVolume(_ context.Context) *plugin.Table {
 				Description: "The id of the project the volume belongs to.",
 				Transform:   transform.FromField("OsVolTenantAttrTenantID"),
 			},
+			{
+				Name:        "project_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the project the volume belongs to.",
+				Hydrate:     getOpenStackVolumeProjectName,
+				Transform:   transform.FromValue(),
+			},
 			{
 				Name:        "user_id",
 				Type:        proto.ColumnType_STRING,
 				Description: "The id of the user who created the volume.",
 				Transform:   transform.FromField("UserID"),
 			},
+			{
+				Name:        "user_name",
+				Type:        proto.ColumnType_STRING,
+				Description: "The name of the user who created the volume.",
+				Hydrate:     getOpenStackVolumeUserName,
+				Transform:   transform.FromValue(),
+			},
 			{
 				Name:        "status",
 				Type:        proto.ColumnType_STRING,
@@ -118,24 +135,24 @@ func tableOpenStackVolume(_ context.Context) *plugin.Table {
 			{
 				Name:        "backup_id",
 				Type:        proto.ColumnType_STRING,
-				Description: "The backup ID, from which the volume was restored; this value is available starting from microversion 3.47.",
+				Description: "The backup ID, from which the volume was restored; this value is available starting from microversion 3.47 and is NULL on clouds that do not support it.",
 				Transform:   transform.FromField("BackupID"),
 			},
 			{
 				Name:        "group_id",
 				Type:        proto.ColumnType_STRING,
-				Description: "The group ID of the volume; this value is available starting from microversion 3.47.",
+				Description: "The group ID of the volume; this value is available starting from microversion 3.47 and is NULL on clouds that do not support it.",
 				Transform:   transform.FromField("GroupID"),
 			},
 			{
 				Name:        "created_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "Timestamp when the volume was created.",
 				Transform:   transform.FromField("CreatedAt").Transform(ToTime),
 			},
 			{
 				Name:        "updated_at",
-				Type:        proto.ColumnType_STRING,
+				Type:        proto.ColumnType_TIMESTAMP,
 				Description: "The date when this volume was last updated.",
 				Transform:   transform.FromField("UpdatedAt").Transform(ToTime),
 			},
@@ -172,6 +189,9 @@ func tableOpenStackVolume(_ context.Context) *plugin.Table {
 				Transform: transform.FromField("VolumeImageMetadata").Transform(transform.NullIfZeroValue).Transform(func(ctx context.Context, d *transform.TransformData) (any, error) {
 					if d.Value != nil {
 						if value, ok := d.Value.(map[string]string); ok {
+							if value["size"] == "" {
+								return nil, nil
+							}
 							return value["size"], nil
 						}
 					}
@@ -339,10 +359,12 @@ func tableOpenStackVolume(_ context.Context) *plugin.Table {
 				Description: "The volume image metadata.",
 				Transform:   transform.FromField("VolumeImageMetadata"),
 			},
+			regionColumn(),
 		},
 		List: &plugin.ListConfig{
 			Hydrate: listOpenStackVolume,
 			KeyColumns: plugin.KeyColumnSlice{
+				regionKeyColumn(),
 				// &plugin.KeyColumn{
 				// 	Name:    "id",
 				// 	Require: plugin.Optional,
@@ -359,11 +381,16 @@ func tableOpenStackVolume(_ context.Context) *plugin.Table {
 					Name:    "project_id",
 					Require: plugin.Optional,
 				},
+				timeKeyColumn("created_at"),
+				timeKeyColumn("updated_at"),
 			},
 		},
 		Get: &plugin.GetConfig{
 			KeyColumns: plugin.SingleColumn("id"),
 			Hydrate:    getOpenStackVolume,
+			IgnoreConfig: &plugin.IgnoreConfig{
+				ShouldIgnoreErrorFunc: shouldIgnoreError,
+			},
 		},
 	}
 }
@@ -374,36 +401,61 @@ func listOpenStackVolume(ctx context.Context, d *plugin.QueryData, h *plugin.Hyd
 
 	setLogLevel(ctx, d)
 
-	plugin.Logger(ctx).Debug("retrieving openstack volumes list", "query data", utils.ToPrettyJSON(d))
+	logger(ctx).Debug("retrieving openstack volumes list", "query data", toRedactedJSON(d))
 
 	client, err := getServiceClient(ctx, d, BlockStorageV3)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
-	opts := buildOpenStackVolumeFilter(ctx, d.EqualsQuals)
-
-	allPages, err := volumes.List(client, opts).AllPages()
+	ranges := getTimeRanges(d.Quals, "created_at", "updated_at")
+	opts := buildOpenStackVolumeFilter(ctx, d.EqualsQuals, ranges, supportsMicroversion(client, "3.60"))
+	allowed, err := getAllowedProjects(ctx, d)
 	if err != nil {
-		plugin.Logger(ctx).Error("error listing volumes with options", "options", utils.ToPrettyJSON(opts), "error", err)
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
 		return nil, err
 	}
-	allVolumes := []*apiVolume{}
-	err = volumes.ExtractVolumesInto(allPages, &allVolumes)
-	if err != nil {
-		plugin.Logger(ctx).Error("error extracting volumes", "error", err)
-		return nil, err
+	if !allowed.restrict(&opts.TenantID) {
+		logger(ctx).Debug("project not allowed, exit")
+		return nil, nil
 	}
-	plugin.Logger(ctx).Debug("volumes retrieved", "count", len(allVolumes))
 
-	for _, volume := range allVolumes {
-		if ctx.Err() != nil {
-			plugin.Logger(ctx).Debug("context done, exit")
-			break
-		}
-		volume := volume
-		d.StreamListItem(ctx, volume)
+	opts.Limit = getPageSize(ctx, d)
+	err = listWithPolicy(ctx, d, func(scoped bool) error {
+		opts.AllTenants = !scoped
+		return volumes.List(client, opts).EachPage(func(page pagination.Page) (bool, error) {
+			allVolumes := []*apiVolume{}
+			err := volumes.ExtractVolumesInto(page, &allVolumes)
+			if err != nil {
+				logger(ctx).Error("error extracting volumes", "error", err)
+				return false, err
+			}
+			logger(ctx).Debug("volumes retrieved", "count", len(allVolumes))
+			for _, volume := range allVolumes {
+				if ctx.Err() != nil {
+					logger(ctx).Debug("context done, exit")
+					return false, nil
+				}
+				volume := volume
+				if !allowed.contains(volume.OsVolTenantAttrTenantID) {
+					continue
+				}
+				if !ranges.match("created_at", time.Time(volume.CreatedAt)) || !ranges.match("updated_at", time.Time(volume.UpdatedAt)) {
+					continue
+				}
+				d.StreamListItem(ctx, volume)
+				if d.RowsRemaining(ctx) == 0 {
+					logger(ctx).Debug("row limit reached, exit")
+					return false, nil
+				}
+			}
+			return true, nil
+		})
+	})
+	if err != nil {
+		logger(ctx).Error("error listing volumes with options", "options", toRedactedJSON(opts), "error", err)
+		return nil, err
 	}
 	return nil, nil
 }
@@ -415,29 +467,56 @@ func getOpenStackVolume(ctx context.Context, d *plugin.QueryData, h *plugin.Hydr
 	setLogLevel(ctx, d)
 
 	id := d.EqualsQuals["id"].GetStringValue()
-	plugin.Logger(ctx).Debug("retrieving openstack volume", "id", id)
+	logger(ctx).Debug("retrieving openstack volume", "id", id)
 
 	client, err := getServiceClient(ctx, d, BlockStorageV3)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving client", "error", err)
+		logger(ctx).Error("error retrieving client", "error", err)
 		return nil, err
 	}
 
 	result := volumes.Get(client, id)
-	//plugin.Logger(ctx).Debug("request run", "result", utils.ToPrettyJSON(result))
+	//logger(ctx).Debug("request run", "result", toRedactedJSON(result))
 
 	volume := &apiVolume{}
 	err = result.ExtractInto(volume)
 	if err != nil {
-		plugin.Logger(ctx).Error("error retrieving volume", "error", err)
+		logger(ctx).Error("error retrieving volume", "error", err)
 		return nil, err
 	}
 
+	allowed, err := getAllowedProjects(ctx, d)
+	if err != nil {
+		logger(ctx).Error("error retrieving allowed projects", "error", err)
+		return nil, err
+	}
+	if !allowed.contains(volume.OsVolTenantAttrTenantID) {
+		logger(ctx).Debug("project not allowed", "project", volume.OsVolTenantAttrTenantID)
+		return nil, nil
+	}
+
 	return volume, nil
 }
-func buildOpenStackVolumeFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap) volumes.ListOpts {
-	opts := volumes.ListOpts{
-		AllTenants: true,
+
+// getOpenStackVolumeProjectName resolves the name of the volume's project.
+func getOpenStackVolumeProjectName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	volume := h.Item.(*apiVolume)
+	return lookupName(ctx, d, projectLookup, volume.OsVolTenantAttrTenantID)
+}
+
+// getOpenStackVolumeUserName resolves the name of the volume's user.
+func getOpenStackVolumeUserName(ctx context.Context, d *plugin.QueryData, h *plugin.HydrateData) (interface{}, error) {
+	setLogLevel(ctx, d)
+	volume := h.Item.(*apiVolume)
+	return lookupName(ctx, d, userLookup, volume.UserID)
+}
+
+func buildOpenStackVolumeFilter(ctx context.Context, quals plugin.KeyColumnEqualsQualMap, ranges timeRanges, timeFilters bool) volumeListOpts {
+	opts := volumeListOpts{
+		ListOpts: volumes.ListOpts{
+			AllTenants: true,
+		},
 	}
 	if value, ok := quals["name"]; ok {
 		opts.Name = value.GetStringValue()
@@ -449,10 +528,36 @@ func buildOpenStackVolumeFilter(ctx context.Context, quals plugin.KeyColumnEqual
 		opts.TenantID = value.GetStringValue()
 	}
 	// TODO: add metadata
-	plugin.Logger(ctx).Debug("returning", "filter", utils.ToPrettyJSON(opts))
+	if timeFilters {
+		// Cinder takes a single filter per time column, the other bound of
+		// the range (if any) is applied client-side
+		opts.CreatedAt = ranges["created_at"].filterString()
+		opts.UpdatedAt = ranges["updated_at"].filterString()
+	}
+	logger(ctx).Debug("returning", "filter", toRedactedJSON(opts))
 	return opts
 }
 
+// volumeListOpts adds to volumes.ListOpts the filters on the creation and
+// last update times, which are available starting from microversion 3.60.
+type volumeListOpts struct {
+	volumes.ListOpts
+	CreatedAt string
+	UpdatedAt string
+}
+
+func (opts volumeListOpts) ToVolumeListQuery() (string, error) {
+	query, err := opts.ListOpts.ToVolumeListQuery()
+	params := url.Values{}
+	if opts.CreatedAt != "" {
+		params.Set("created_at", opts.CreatedAt)
+	}
+	if opts.UpdatedAt != "" {
+		params.Set("updated_at", opts.UpdatedAt)
+	}
+	return appendQuery(query, err, params)
+}
+
 type apiVolume struct {
 	// Unique identifier for the volume.
 	ID string `json:"id"`
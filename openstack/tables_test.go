@@ -0,0 +1,906 @@
+package openstack
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dihedron/steampipe-plugin-utils/utils"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+const (
+	webProjectID   = "1f3b1b6f0a7c4d6e9f2e5b8c7d6a5e4f"
+	batchProjectID = "b2c4e6f8a0b2c4d6e8f0a2b4c6d8e0f2"
+)
+
+// rowValues returns the values of the given column in the rows, sorted.
+func rowValues(rows []testRow, column string) []string {
+	values := []string{}
+	for _, row := range rows {
+		if value, ok := row[column].(string); ok {
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// sortRows sorts the rows by the values of the given column, as the SDK
+// streams them in no particular order.
+func sortRows(rows []testRow, column string) []testRow {
+	sort.Slice(rows, func(i, j int) bool { return fmt.Sprint(rows[i][column]) < fmt.Sprint(rows[j][column]) })
+	return rows
+}
+
+// only returns the given columns of the row.
+func (r testRow) only(columns []string) testRow {
+	row := testRow{}
+	for _, column := range columns {
+		row[column] = r[column]
+	}
+	return row
+}
+
+// requestParameters returns the query parameters of the requests received
+// by the fake cloud whose path and query start with the given prefix.
+func requestParameters(t *testing.T, cloud *fakeCloud, prefix string) []url.Values {
+	t.Helper()
+	parameters := []url.Values{}
+	for _, request := range cloud.requested(prefix) {
+		uri, err := url.ParseRequestURI(strings.TrimPrefix(request, "GET "))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parameters = append(parameters, uri.Query())
+	}
+	return parameters
+}
+
+func TestTablesAllColumns(t *testing.T) {
+	cloud := newFakeCloud(t)
+	for name, table := range Plugin(testContext()).TableMap {
+		name, table := name, table
+		t.Run(name, func(t *testing.T) {
+			rows := testQuery{table: table, config: testConfig(cloud)}.run(t)
+			if len(rows) == 0 {
+				t.Fatalf("no rows returned")
+			}
+			if table.Get == nil {
+				// e.g. the tables of the relations between resources
+				return
+			}
+			for _, row := range rows {
+				// each row must be found again by its key
+				quals := []testQual{}
+				columns := []string{}
+				for _, keyColumn := range table.Get.KeyColumns {
+					// the keys are mostly strings, but e.g. aggregates have numbers
+					value := row[keyColumn.Name]
+					ok := value != nil
+					if !ok && keyColumn.Require == plugin.Required {
+						t.Fatalf("row without %s: %v", keyColumn.Name, row)
+					}
+					if ok {
+						quals = append(quals, testQual{keyColumn.Name, "=", value})
+						columns = append(columns, keyColumn.Name)
+					}
+				}
+				got := testQuery{table: table, config: testConfig(cloud), quals: quals, columns: columns}.run(t)
+				if len(got) != 1 || !reflect.DeepEqual(got[0], row.only(columns)) {
+					t.Errorf("get %v returned %v", quals, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTablesGetMissing(t *testing.T) {
+	cloud := newFakeCloud(t)
+	for name, table := range Plugin(testContext()).TableMap {
+		name, table := name, table
+		t.Run(name, func(t *testing.T) {
+			if table.Get == nil {
+				t.Skip("no get call")
+			}
+			quals := []testQual{}
+			for _, keyColumn := range table.Get.KeyColumns {
+				if keyColumn.Require == plugin.Required {
+					quals = append(quals, testQual{keyColumn.Name, "=", "missing"})
+				}
+			}
+			rows := testQuery{table: table, config: testConfig(cloud), quals: quals}.run(t)
+			if len(rows) != 0 {
+				t.Errorf("expected no rows, got %v", rows)
+			}
+		})
+	}
+}
+
+func TestInstanceTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_instance"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "name", "project_name", "user_name", "flavor_name", "flavor_vcpus", "image_name", "status", "region"},
+		quals: []testQual{
+			{"project_id", "=", webProjectID},
+			{"status", "=", "ACTIVE"},
+		},
+	}.run(t)
+
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %v", rows)
+	}
+	expected := testRow{
+		"id":           "0c2b5f4e-1d3a-4b6c-8e9f-a1b2c3d4e5f6",
+		"name":         "web-1",
+		"project_name": "web",
+		"user_name":    "alice",
+		"flavor_name":  "m1.small",
+		"flavor_vcpus": int64(1),
+		"image_name":   "ubuntu-22.04",
+		"status":       "ACTIVE",
+		"region":       "RegionOne",
+	}
+	for column, value := range expected {
+		if rows[0][column] != value {
+			t.Errorf("%s: expected %v, got %v", column, value, rows[0][column])
+		}
+	}
+
+	// the quals are passed down to Nova
+	for _, parameters := range requestParameters(t, cloud, "GET /compute/v2.1/servers/detail?") {
+		if parameters.Get("tenant_id") != webProjectID || parameters.Get("status") != "ACTIVE" || parameters.Get("all_tenants") != "true" {
+			t.Errorf("unexpected servers request parameters %v", parameters)
+		}
+	}
+}
+
+func TestInstanceTableImageName(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_instance"),
+		config:  testConfig(cloud),
+		columns: []string{"name", "image_name"},
+		quals:   []testQual{{"name", "=", "web-2"}},
+	}.run(t)
+
+	// the image is a community one, which Glance does not list by default
+	if len(rows) != 1 || rows[0]["image_name"] != "debian-12-community" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+	requests := requestParameters(t, cloud, "GET /image/v2/images?")
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 image lists, got %v", requests)
+	}
+	for i, parameters := range requests {
+		if parameters.Get("visibility") != "all" || parameters.Has("os_hidden") != (i == 0) {
+			t.Errorf("unexpected images request parameters %v", parameters)
+		}
+	}
+}
+
+func TestInstanceTimeQuals(t *testing.T) {
+	cloud := newFakeCloud(t)
+	since := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	rows := testQuery{
+		table:   testTable("openstack_instance"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "name"},
+		quals:   []testQual{{"created_at", ">=", since}},
+	}.run(t)
+
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "web-2,worker-1" {
+		t.Errorf("unexpected instances %v", names)
+	}
+	for _, parameters := range requestParameters(t, cloud, "GET /compute/v2.1/servers/detail?") {
+		if parameters.Get("changes-since") != "2023-02-01T00:00:00Z" {
+			t.Errorf("unexpected changes-since in %v", parameters)
+		}
+	}
+}
+
+func TestPortTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	config := testConfig(cloud)
+	config.PageSize = utils.PointerTo(1)
+	rows := testQuery{
+		table:   testTable("openstack_port"),
+		config:  config,
+		columns: []string{"id", "name", "network_name", "security_group_ids"},
+		quals:   []testQual{{"network_id", "=", "4c1e7a2b-9d3f-4e5a-8b6c-0d1e2f3a4b5c"}},
+	}.run(t)
+
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "web-1-port,web-2-port" {
+		t.Errorf("unexpected ports %v", names)
+	}
+	for _, row := range rows {
+		if row["network_name"] != "private" {
+			t.Errorf("unexpected network name %v", row["network_name"])
+		}
+	}
+
+	// one page per port, each with only the fields backing the requested
+	// columns
+	requests := requestParameters(t, cloud, "GET /network/v2.0/ports?")
+	if len(requests) != 2 {
+		t.Errorf("expected 2 pages, got %d", len(requests))
+	}
+	for i, parameters := range requests {
+		if parameters.Get("limit") != "1" || parameters.Get("network_id") != "4c1e7a2b-9d3f-4e5a-8b6c-0d1e2f3a4b5c" {
+			t.Errorf("unexpected ports request parameters %v", parameters)
+		}
+		if fields := strings.Join(parameters["fields"], ","); fields != "id,name,network_id,project_id,security_groups" {
+			t.Errorf("unexpected fields %q", fields)
+		}
+		if (i == 0) != (parameters.Get("marker") == "") {
+			t.Errorf("unexpected marker in %v", parameters)
+		}
+	}
+}
+
+func TestSecurityGroupRuleTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_security_group_rule"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "security_group_name", "remote_group_name", "project_name"},
+		quals:   []testQual{{"remote_group_id", "=", "f1e2d3c4-b5a6-4978-8695-a4b3c2d1e0f9"}},
+	}.run(t)
+
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %v", rows)
+	}
+	for _, row := range rows {
+		if row["remote_group_name"] != "default" || row["security_group_name"] != "default" || row["project_name"] != "web" {
+			t.Errorf("unexpected row %v", row)
+		}
+	}
+}
+
+func TestVolumeTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_volume"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "name", "project_id", "project_name", "user_name", "size"},
+		quals:   []testQual{{"project_id", "=", batchProjectID}},
+	}.run(t)
+
+	if len(rows) != 1 || rows[0]["name"] != "worker-1-root" || rows[0]["project_name"] != "batch" || rows[0]["user_name"] != "admin" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+	for _, parameters := range requestParameters(t, cloud, "GET /volume/v3/"+fakeProjectID+"/volumes/detail?") {
+		if parameters.Get("project_id") != batchProjectID {
+			t.Errorf("unexpected volumes request parameters %v", parameters)
+		}
+	}
+}
+
+func TestAttachmentTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_attachment"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "project_id", "project_name", "volume_id"},
+	}.run(t)
+
+	// the attachments are listed one project at a time
+	if projects := rowValues(rows, "project_name"); strings.Join(projects, ",") != "batch,web" {
+		t.Errorf("unexpected projects %v", projects)
+	}
+	if requests := cloud.requested("GET /volume/v3/" + fakeProjectID + "/attachments/detail?"); len(requests) != 3 {
+		t.Errorf("expected one request per project, got %v", requests)
+	}
+	for _, parameters := range requestParameters(t, cloud, "GET /volume/v3/"+fakeProjectID+"/attachments/detail?") {
+		if parameters.Get("all_tenants") != "true" {
+			t.Errorf("unexpected attachments request parameters %v", parameters)
+		}
+	}
+}
+
+func TestAttachmentTableScoped(t *testing.T) {
+	cloud := newFakeCloud(t)
+	config := testConfig(cloud)
+	config.AllProjects = utils.PointerTo(false)
+	testQuery{
+		table:   testTable("openstack_attachment"),
+		config:  config,
+		columns: []string{"id"},
+	}.run(t)
+
+	// only the current project is listed, without all_tenants
+	requests := requestParameters(t, cloud, "GET /volume/v3/"+fakeProjectID+"/attachments/detail?")
+	if len(requests) != 1 || requests[0].Get("project_id") != fakeProjectID || requests[0].Has("all_tenants") {
+		t.Errorf("unexpected attachments requests %v", requests)
+	}
+}
+
+func TestImageTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	config := testConfig(cloud)
+	config.PageSize = utils.PointerTo(2)
+	rows := testQuery{
+		table:   testTable("openstack_image"),
+		config:  config,
+		columns: []string{"id", "name", "project_name", "tags"},
+	}.run(t)
+
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "batch-worker,ubuntu-22.04,web-golden" {
+		t.Errorf("unexpected images %v", names)
+	}
+	if requests := cloud.requested("GET /image/v2/images?"); len(requests) != 2 {
+		t.Errorf("expected 2 pages, got %v", requests)
+	}
+}
+
+func TestImageTableFilters(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_image"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "name"},
+		quals:   []testQual{{"project_id", "=", "1f3b1b6f0a7c4d6e9f2e5b8c7d6a5e4f"}, {"visibility", "=", "private"}, {"hidden", "=", false}},
+	}.run(t)
+
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "web-golden" {
+		t.Errorf("unexpected images %v", names)
+	}
+	for _, parameters := range requestParameters(t, cloud, "GET /image/v2/images?") {
+		if parameters.Get("owner") != "1f3b1b6f0a7c4d6e9f2e5b8c7d6a5e4f" || parameters.Get("visibility") != "private" || parameters.Has("os_hidden") {
+			t.Errorf("unexpected images request parameters %v", parameters)
+		}
+	}
+}
+
+func TestFlavorTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_flavor"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "name", "is_public", "cpu_policy", "numa_nodes", "mem_page_size", "quotas", "traits", "resources"},
+		quals:   []testQual{{"is_public", "=", false}, {"disk", ">", 40}},
+	}.run(t)
+
+	// the fake cloud ignores the filters, as non-admin users get the private
+	// flavors of their projects along with the public ones
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "c4.pinned,g1.gpu" {
+		t.Fatalf("unexpected flavors %v", names)
+	}
+	for _, parameters := range requestParameters(t, cloud, "GET /compute/v2.1/flavors/detail?") {
+		if parameters.Get("is_public") != "false" || parameters.Get("minDisk") != "41" {
+			t.Errorf("unexpected flavors request parameters %v", parameters)
+		}
+	}
+	for _, row := range rows {
+		switch row["name"] {
+		case "c4.pinned":
+			if row["cpu_policy"] != "dedicated" || row["numa_nodes"] != int64(2) || row["mem_page_size"] != "1GB" ||
+				!reflect.DeepEqual(row["traits"], map[string]interface{}{"CUSTOM_FAST_NIC": "required"}) ||
+				!reflect.DeepEqual(row["resources"], map[string]interface{}{"VGPU": "1"}) || row["quotas"] != nil {
+				t.Errorf("unexpected row %v", row)
+			}
+		case "g1.gpu":
+			if row["cpu_policy"] != nil || row["numa_nodes"] != nil || len(row["traits"].(map[string]interface{})) != 2 {
+				t.Errorf("unexpected row %v", row)
+			}
+		}
+	}
+
+	rows = testQuery{
+		table:   testTable("openstack_flavor"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "name", "disabled", "quotas"},
+		quals:   []testQual{{"id", "=", "4"}},
+	}.run(t)
+	if len(rows) != 1 || rows[0]["name"] != "m1.large" || rows[0]["disabled"] != false ||
+		!reflect.DeepEqual(rows[0]["quotas"], map[string]interface{}{"disk_read_iops_sec": "500", "disk_write_iops_sec": "250"}) {
+		t.Errorf("unexpected rows %v", rows)
+	}
+}
+
+func TestFlavorAccessTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_flavor_access"),
+		config:  testConfig(cloud),
+		columns: []string{"flavor_name", "project_name"},
+	}.run(t)
+
+	access := []string{}
+	for _, row := range rows {
+		access = append(access, fmt.Sprintf("%v:%v", row["flavor_name"], row["project_name"]))
+	}
+	sort.Strings(access)
+	if strings.Join(access, ",") != "c4.pinned:batch,c4.pinned:web,g1.gpu:batch" {
+		t.Errorf("unexpected flavor access %v", access)
+	}
+	// public flavors have no access list, so it is not retrieved
+	retrieved := 0
+	for _, request := range cloud.requested("GET /compute/v2.1/flavors/") {
+		if strings.HasSuffix(request, "/os-flavor-access") {
+			retrieved++
+		}
+	}
+	if retrieved != 2 {
+		t.Errorf("expected the access of the 2 private flavors retrieved, got %d", retrieved)
+	}
+
+	rows = testQuery{
+		table:   testTable("openstack_flavor_access"),
+		config:  testConfig(cloud),
+		columns: []string{"flavor_id", "project_id"},
+		quals:   []testQual{{"project_id", "=", webProjectID}},
+	}.run(t)
+	if len(rows) != 1 || rows[0]["flavor_id"] != "3e5f7a9b-1c2d-4e6f-8a0b-2c4d6e8f0a1b" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+}
+
+func TestHypervisorTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_hypervisor"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "hypervisor_hostname", "state", "vcpus", "vcpus_used", "running_vms", "service_host", "uptime"},
+	}.run(t)
+
+	if names := rowValues(rows, "hypervisor_hostname"); strings.Join(names, ",") != "compute-1.example.com,compute-2.example.com,compute-3.example.com" {
+		t.Fatalf("unexpected hypervisors %v", names)
+	}
+	for _, row := range rows {
+		switch row["hypervisor_hostname"] {
+		case "compute-2.example.com":
+			if row["vcpus"] != int64(32) || row["vcpus_used"] != int64(5) || row["running_vms"] != int64(2) || row["service_host"] != "compute-2" ||
+				row["uptime"] != "08:32:12 up 12 days,  2:01, 0 users, load average: 1.02, 0.98, 0.91" {
+				t.Errorf("unexpected row %v", row)
+			}
+		case "compute-3.example.com":
+			// the driver does not report the uptime
+			if row["state"] != "down" || row["running_vms"] != int64(0) || row["uptime"] != nil {
+				t.Errorf("unexpected row %v", row)
+			}
+		}
+	}
+
+	rows = testQuery{
+		table:   testTable("openstack_hypervisor"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "service_id"},
+		quals:   []testQual{{"hypervisor_hostname", "=", "compute-1.example.com"}},
+	}.run(t)
+	if len(rows) != 1 || rows[0]["service_id"] != "a1b2c3d4-1111-4aaa-8bbb-000000000001" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+	for _, parameters := range requestParameters(t, cloud, "GET /compute/v2.1/os-hypervisors/detail?hypervisor_hostname_pattern") {
+		if parameters.Get("hypervisor_hostname_pattern") != "compute-1.example.com" || parameters.Get("with_servers") != "" {
+			t.Errorf("unexpected hypervisors request parameters %v", parameters)
+		}
+	}
+}
+
+func TestHypervisorInstanceTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_hypervisor_instance"),
+		config:  testConfig(cloud),
+		columns: []string{"hypervisor_hostname", "instance_id", "instance_name"},
+	}.run(t)
+
+	// the rows join to the instances by hypervisor hostname
+	instances := testQuery{
+		table:   testTable("openstack_instance"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "hypervisor_hostname"},
+	}.run(t)
+	hostnames := map[interface{}]interface{}{}
+	for _, instance := range instances {
+		hostnames[instance["id"]] = instance["hypervisor_hostname"]
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %v", rows)
+	}
+	for _, row := range rows {
+		if hostnames[row["instance_id"]] != row["hypervisor_hostname"] {
+			t.Errorf("instance %v not on %v", row["instance_id"], row["hypervisor_hostname"])
+		}
+	}
+	for _, parameters := range requestParameters(t, cloud, "GET /compute/v2.1/os-hypervisors/detail?") {
+		if parameters.Get("with_servers") != "true" {
+			t.Errorf("unexpected hypervisors request parameters %v", parameters)
+		}
+	}
+}
+
+func TestServerGroupTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	config := testConfig(cloud)
+	config.PageSize = utils.PointerTo(2)
+	rows := testQuery{
+		table:   testTable("openstack_server_group"),
+		config:  config,
+		columns: []string{"id", "name", "policy", "max_server_per_host", "members", "project_name", "user_name"},
+	}.run(t)
+
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "batch-pack,legacy-spread,web-spread" {
+		t.Fatalf("unexpected server groups %v", names)
+	}
+	for _, row := range rows {
+		switch row["name"] {
+		case "web-spread":
+			if row["policy"] != "anti-affinity" || row["max_server_per_host"] != int64(1) || len(row["members"].([]interface{})) != 2 ||
+				row["project_name"] != "web" || row["user_name"] != "alice" {
+				t.Errorf("unexpected row %v", row)
+			}
+		case "batch-pack":
+			if row["policy"] != "soft-affinity" || row["max_server_per_host"] != nil {
+				t.Errorf("unexpected row %v", row)
+			}
+		case "legacy-spread":
+			// the policies of older microversions
+			if row["policy"] != "anti-affinity" {
+				t.Errorf("unexpected row %v", row)
+			}
+		}
+	}
+	// the pages are requested by offset, across all projects, until an
+	// empty one
+	requests := requestParameters(t, cloud, "GET /compute/v2.1/os-server-groups?")
+	if len(requests) != 3 || requests[1].Get("offset") != "2" || requests[2].Get("offset") != "3" {
+		t.Errorf("expected 3 pages, got %v", requests)
+	}
+	for _, parameters := range requests {
+		if parameters.Get("all_projects") != "true" || parameters.Get("limit") != "2" {
+			t.Errorf("unexpected server groups request parameters %v", parameters)
+		}
+	}
+
+	rows = testQuery{
+		table:   testTable("openstack_server_group"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "name"},
+		quals:   []testQual{{"project_id", "=", batchProjectID}},
+	}.run(t)
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "batch-pack" {
+		t.Errorf("unexpected server groups %v", names)
+	}
+
+	// the instances refer to their server groups
+	rows = testQuery{
+		table:   testTable("openstack_instance"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "server_groups"},
+		quals:   []testQual{{"id", "=", "0c2b5f4e-1d3a-4b6c-8e9f-a1b2c3d4e5f6"}},
+	}.run(t)
+	if len(rows) != 1 || !reflect.DeepEqual(rows[0]["server_groups"], []interface{}{"7c6b5a4f-3e2d-4c1b-0a9f-8e7d6c5b4a3f"}) {
+		t.Errorf("unexpected rows %v", rows)
+	}
+}
+
+func TestServerGroupTableMaxLimit(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cloud.maxLimit = 2
+	config := testConfig(cloud)
+	config.PageSize = utils.PointerTo(1000)
+	rows := testQuery{
+		table:   testTable("openstack_server_group"),
+		config:  config,
+		columns: []string{"id", "name"},
+	}.run(t)
+
+	// the first page is cut at the limit of the cloud, not the last one
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "batch-pack,legacy-spread,web-spread" {
+		t.Errorf("unexpected server groups %v", names)
+	}
+	requests := requestParameters(t, cloud, "GET /compute/v2.1/os-server-groups?")
+	if len(requests) != 3 || requests[1].Get("offset") != "2" || requests[2].Get("offset") != "3" {
+		t.Errorf("expected 3 pages, got %v", requests)
+	}
+}
+
+func TestKeyPairTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	config := testConfig(cloud)
+	config.PageSize = utils.PointerTo(1)
+	rows := testQuery{
+		table:   testTable("openstack_keypair"),
+		config:  config,
+		columns: []string{"name", "user_id", "user_name", "type", "created_at"},
+	}.run(t)
+
+	keys := []string{}
+	for _, row := range rows {
+		keys = append(keys, fmt.Sprintf("%v:%v:%v", row["user_name"], row["name"], row["type"]))
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "admin:admin-key:ssh,alice:alice-key:ssh,alice:deploy:x509" {
+		t.Fatalf("unexpected key pairs %v", keys)
+	}
+	for _, row := range rows {
+		if row["name"] == "alice-key" && row["created_at"] != time.Date(2023, 1, 5, 8, 15, 30, 0, time.UTC) {
+			t.Errorf("unexpected row %v", row)
+		}
+	}
+	// the key pairs are listed one user at a time, one page per key pair of
+	// the user
+	requests := requestParameters(t, cloud, "GET /compute/v2.1/os-keypairs?")
+	if len(requests) != 3 {
+		t.Errorf("expected one request per user and page, got %v", requests)
+	}
+	markers := []string{}
+	for _, parameters := range requests {
+		if parameters.Get("user_id") == "" || parameters.Get("limit") != "1" {
+			t.Errorf("unexpected key pairs request parameters %v", parameters)
+		}
+		if marker := parameters.Get("marker"); marker != "" {
+			markers = append(markers, marker)
+		}
+	}
+	if strings.Join(markers, ",") != "alice-key" {
+		t.Errorf("unexpected key pairs markers %v", markers)
+	}
+
+	// the instances refer to the key pairs of their users
+	instances := testQuery{
+		table:   testTable("openstack_instance"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "user_id", "key_name"},
+		quals:   []testQual{{"project_id", "=", webProjectID}},
+	}.run(t)
+	if len(instances) == 0 {
+		t.Fatalf("no instances")
+	}
+	for _, instance := range instances {
+		rows := testQuery{
+			table:   testTable("openstack_keypair"),
+			config:  testConfig(cloud),
+			columns: []string{"name", "fingerprint"},
+			quals:   []testQual{{"user_id", "=", instance["user_id"]}, {"name", "=", instance["key_name"]}},
+		}.run(t)
+		if len(rows) != 1 || rows[0]["fingerprint"] != "3f:8c:1a:2b:4d:5e:6f:70:81:92:a3:b4:c5:d6:e7:f8" {
+			t.Errorf("unexpected key pairs %v for instance %v", rows, instance)
+		}
+	}
+}
+
+func TestAggregateTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_aggregate"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "name", "availability_zone", "hosts", "metadata", "updated_at"},
+	}.run(t)
+
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "general,gpu" {
+		t.Fatalf("unexpected aggregates %v", names)
+	}
+	for _, row := range rows {
+		switch row["name"] {
+		case "general":
+			if row["id"] != int64(1) || row["availability_zone"] != "nova" || !reflect.DeepEqual(row["hosts"], []interface{}{"compute-1", "compute-2"}) ||
+				row["updated_at"] != nil {
+				t.Errorf("unexpected row %v", row)
+			}
+		case "gpu":
+			if row["availability_zone"] != "" || !reflect.DeepEqual(row["metadata"], map[string]interface{}{"trait:CUSTOM_GPU": "required"}) ||
+				row["updated_at"] != time.Date(2023, 2, 10, 14, 30, 0, 0, time.UTC) {
+				t.Errorf("unexpected row %v", row)
+			}
+		}
+	}
+
+	// the hypervisors are in the aggregates of their hosts
+	hosts := map[string]bool{}
+	for _, row := range rows {
+		for _, host := range row["hosts"].([]interface{}) {
+			hosts[host.(string)] = true
+		}
+	}
+	hypervisors := testQuery{
+		table:   testTable("openstack_hypervisor"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "service_host"},
+	}.run(t)
+	if len(hypervisors) == 0 {
+		t.Fatalf("no hypervisors")
+	}
+	for _, hypervisor := range hypervisors {
+		if !hosts[hypervisor["service_host"].(string)] {
+			t.Errorf("hypervisor %v not in any aggregate", hypervisor)
+		}
+	}
+
+	// the instances are in the availability zone of the aggregates of their
+	// hosts
+	zones := map[string]string{}
+	for _, row := range rows {
+		for _, host := range row["hosts"].([]interface{}) {
+			zones[host.(string)] = row["availability_zone"].(string)
+		}
+	}
+	instances := testQuery{
+		table:   testTable("openstack_instance"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "host_name", "availability_zone"},
+	}.run(t)
+	if len(instances) == 0 {
+		t.Fatalf("no instances")
+	}
+	for _, instance := range instances {
+		if zones[instance["host_name"].(string)] != instance["availability_zone"] {
+			t.Errorf("instance %v not in the availability zone of its aggregates %v", instance, zones)
+		}
+	}
+}
+
+func TestComputeAvailabilityZoneTable(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_compute_availability_zone"),
+		config:  testConfig(cloud),
+		columns: []string{"zone_name", "available", "hosts", "host_names"},
+	}.run(t)
+
+	if names := rowValues(rows, "zone_name"); strings.Join(names, ",") != "internal,nova" {
+		t.Fatalf("unexpected availability zones %v", names)
+	}
+	for _, row := range rows {
+		if row["zone_name"] != "nova" {
+			continue
+		}
+		if row["available"] != true || !reflect.DeepEqual(row["host_names"], []interface{}{"compute-1", "compute-2", "compute-3"}) {
+			t.Errorf("unexpected row %v", row)
+		}
+		state := func(host string) map[string]interface{} {
+			services, _ := row["hosts"].(map[string]interface{})[host].(map[string]interface{})
+			state, _ := services["nova-compute"].(map[string]interface{})
+			return state
+		}
+		if state := state("compute-3"); state["available"] != true || state["active"] != false || state["updated_at"] != nil {
+			t.Errorf("unexpected compute-3 state %v", state)
+		}
+		if state := state("compute-1"); state["updated_at"] != "2023-03-01T12:00:05Z" {
+			t.Errorf("unexpected compute-1 state %v", state)
+		}
+	}
+	if requests := cloud.requested("GET /compute/v2.1/os-availability-zone/detail"); len(requests) != 1 {
+		t.Errorf("expected the details to be listed once, got %v", requests)
+	}
+
+	rows = testQuery{
+		table:   testTable("openstack_compute_availability_zone"),
+		config:  testConfig(cloud),
+		columns: []string{"zone_name"},
+		quals:   []testQual{{"zone_name", "=", "internal"}},
+	}.run(t)
+	if names := rowValues(rows, "zone_name"); strings.Join(names, ",") != "internal" {
+		t.Errorf("unexpected availability zones %v", names)
+	}
+}
+
+func TestProjectTableTags(t *testing.T) {
+	cloud := newFakeCloud(t)
+	rows := testQuery{
+		table:   testTable("openstack_project"),
+		config:  testConfig(cloud),
+		columns: []string{"id", "name"},
+		quals:   []testQual{{"tags_any", "=", "staging,frontend"}},
+	}.run(t)
+
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "batch,web" {
+		t.Errorf("unexpected projects %v", names)
+	}
+}
+
+func TestProjectTableScoped(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cloud.forbid("/identity/v3/projects")
+	config := testConfig(cloud)
+	config.OnForbidden = utils.PointerTo(ForbiddenProject)
+	rows := testQuery{
+		table:   testTable("openstack_project"),
+		config:  config,
+		columns: []string{"id", "name"},
+		quals:   []testQual{{"enabled", "=", true}},
+	}.run(t)
+
+	// the projects of the user are filtered client-side
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "admin" {
+		t.Errorf("unexpected projects %v", names)
+	}
+	if requests := cloud.requested("GET /identity/v3/users/5e2ac7b7e4c04d2a9c1f0cfb5d0f6c3a/projects"); len(requests) != 1 {
+		t.Errorf("expected the projects of the user to be listed, got %v", requests)
+	}
+}
+
+func TestTableLimit(t *testing.T) {
+	cloud := newFakeCloud(t)
+	limit := int64(1)
+	rows := testQuery{
+		table:   testTable("openstack_network"),
+		config:  testConfig(cloud),
+		columns: []string{"id"},
+		limit:   &limit,
+	}.run(t)
+
+	if len(rows) != 1 {
+		t.Errorf("expected 1 row, got %v", rows)
+	}
+	for _, parameters := range requestParameters(t, cloud, "GET /network/v2.0/networks?") {
+		if parameters.Get("limit") != "1" {
+			t.Errorf("unexpected networks request parameters %v", parameters)
+		}
+	}
+}
+
+func TestTableIncludeProjects(t *testing.T) {
+	cloud := newFakeCloud(t)
+	config := testConfig(cloud)
+	config.IncludeProjects = &[]string{"batch"}
+	rows := testQuery{
+		table:   testTable("openstack_instance"),
+		config:  config,
+		columns: []string{"id", "name"},
+	}.run(t)
+
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "worker-1" {
+		t.Errorf("unexpected instances %v", names)
+	}
+}
+
+func TestHypervisorInstanceIncludeProjects(t *testing.T) {
+	cloud := newFakeCloud(t)
+	config := testConfig(cloud)
+	config.IncludeProjects = &[]string{"batch"}
+	rows := testQuery{
+		table:   testTable("openstack_hypervisor_instance"),
+		config:  config,
+		columns: []string{"instance_id", "instance_name"},
+	}.run(t)
+
+	// the hypervisors report the servers of all the projects, so only those
+	// listed in the allowed projects are returned
+	if len(rows) != 1 || rows[0]["instance_id"] != "2e4d7b6a-3f5c-4d8e-a01b-c3d4e5f6a7b8" {
+		t.Errorf("unexpected hypervisor instances %v", rows)
+	}
+}
+
+func TestTableIncludeDomainsForbidden(t *testing.T) {
+	cloud := newFakeCloud(t)
+	cloud.forbid("/identity/v3/domains")
+	config := testConfig(cloud)
+	config.IncludeDomains = &[]string{"Default"}
+	rows := testQuery{
+		table:   testTable("openstack_project"),
+		config:  config,
+		columns: []string{"id", "name"},
+	}.run(t)
+
+	// the names of the domains of the projects are retrieved one by one
+	if names := rowValues(rows, "name"); strings.Join(names, ",") != "admin,batch,web" {
+		t.Errorf("unexpected projects %v", names)
+	}
+	if requests := cloud.requested("GET /identity/v3/domains/default"); len(requests) != 1 {
+		t.Errorf("expected the domain to be retrieved once, got %v", requests)
+	}
+
+	// if that is forbidden too, domains can only be given by ID
+	cloud.forbid("/identity/v3/domains/default")
+	if _, err := (testQuery{table: testTable("openstack_project"), config: config, columns: []string{"id"}}).execute(t); err == nil || !strings.Contains(err.Error(), "must be given by ID") {
+		t.Errorf("expected an error for a domain name, got %v", err)
+	}
+	config.IncludeDomains = &[]string{"default"}
+	rows = testQuery{
+		table:   testTable("openstack_project"),
+		config:  config,
+		columns: []string{"id", "name"},
+	}.run(t)
+	if len(rows) != 3 {
+		t.Errorf("unexpected projects %v", rows)
+	}
+}
@@ -0,0 +1,106 @@
+package openstack
+
+import (
+	"strings"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
+)
+
+// the columns used to filter resources by tag, after the OpenStack tags,
+// tags-any, not-tags and not-tags-any filters
+var tagFilterDescriptions = map[string]string{
+	"tags_all":     "Comma-separated list of tags the resource must all have; used as a filter only.",
+	"tags_any":     "Comma-separated list of tags the resource must have at least one of; used as a filter only.",
+	"not_tags":     "Comma-separated list of tags the resource must not all have; used as a filter only.",
+	"not_tags_any": "Comma-separated list of tags the resource must have none of; used as a filter only.",
+}
+
+// tagFilterColumn returns one of the tag filter columns, which return the
+// value of the qual they were queried with.
+func tagFilterColumn(name string) *plugin.Column {
+	return &plugin.Column{
+		Name:        name,
+		Type:        proto.ColumnType_STRING,
+		Description: tagFilterDescriptions[name],
+		Transform:   transform.FromQual(name),
+	}
+}
+
+// tagKeyColumn returns the optional key column on a tag filter column.
+func tagKeyColumn(name string) *plugin.KeyColumn {
+	return &plugin.KeyColumn{
+		Name:    name,
+		Require: plugin.Optional,
+	}
+}
+
+// tagFilter holds the tag filters in the quals, as comma-separated lists of
+// tags, ready to be passed to the OpenStack APIs.
+type tagFilter struct {
+	Tags       string
+	TagsAny    string
+	NotTags    string
+	NotTagsAny string
+}
+
+// getTagFilter collects the tag filters from the quals.
+func getTagFilter(quals plugin.KeyColumnEqualsQualMap) tagFilter {
+	filter := tagFilter{}
+	for name, field := range map[string]*string{
+		"tags_all":     &filter.Tags,
+		"tags_any":     &filter.TagsAny,
+		"not_tags":     &filter.NotTags,
+		"not_tags_any": &filter.NotTagsAny,
+	} {
+		if value, ok := quals[name]; ok {
+			*field = strings.Join(splitTags(value.GetStringValue()), ",")
+		}
+	}
+	return filter
+}
+
+// match returns whether a resource with the given tags satisfies the
+// filters; it is used to filter items client-side when a service does not
+// support all the filters.
+func (f tagFilter) match(tags []string) bool {
+	present := map[string]bool{}
+	for _, tag := range tags {
+		present[tag] = true
+	}
+	count := func(filter string) (int, int) {
+		found, total := 0, 0
+		for _, tag := range splitTags(filter) {
+			total++
+			if present[tag] {
+				found++
+			}
+		}
+		return found, total
+	}
+	if found, total := count(f.Tags); found < total {
+		return false
+	}
+	if found, total := count(f.TagsAny); total > 0 && found == 0 {
+		return false
+	}
+	if found, total := count(f.NotTags); total > 0 && found == total {
+		return false
+	}
+	if found, _ := count(f.NotTagsAny); found > 0 {
+		return false
+	}
+	return true
+}
+
+// splitTags splits a comma-separated list of tags, dropping blanks.
+func splitTags(value string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
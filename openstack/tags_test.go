@@ -0,0 +1,38 @@
+package openstack
+
+import (
+	"testing"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+func TestTagFilter(t *testing.T) {
+	filter := getTagFilter(plugin.KeyColumnEqualsQualMap{
+		"tags_all": &proto.QualValue{Value: &proto.QualValue_StringValue{StringValue: "prod, web"}},
+	})
+	if filter.Tags != "prod,web" {
+		t.Errorf("unexpected tags filter %q", filter.Tags)
+	}
+
+	tests := []struct {
+		filter tagFilter
+		tags   []string
+		match  bool
+	}{
+		{tagFilter{}, nil, true},
+		{tagFilter{Tags: "prod,web"}, []string{"web", "prod", "eu"}, true},
+		{tagFilter{Tags: "prod,web"}, []string{"prod"}, false},
+		{tagFilter{TagsAny: "prod,test"}, []string{"test"}, true},
+		{tagFilter{TagsAny: "prod,test"}, []string{"dev"}, false},
+		{tagFilter{NotTags: "prod,web"}, []string{"prod"}, true},
+		{tagFilter{NotTags: "prod,web"}, []string{"prod", "web"}, false},
+		{tagFilter{NotTagsAny: "prod,web"}, []string{"dev"}, true},
+		{tagFilter{NotTagsAny: "prod,web"}, []string{"web"}, false},
+	}
+	for _, test := range tests {
+		if match := test.filter.match(test.tags); match != test.match {
+			t.Errorf("%+v on %v: expected %t, got %t", test.filter, test.tags, test.match, match)
+		}
+	}
+}
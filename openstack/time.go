@@ -12,9 +12,18 @@ import (
 
 type Time time.Time
 
+// layouts are the time formats emitted by the OpenStack services: Nova
+// and Neutron use RFC3339 with or without a zone and fractional seconds,
+// Cinder and the OS-SRV-USG extension use fractional seconds without a zone,
+// Keystone and Glance use RFC3339 with a "Z" or "+00:00" zone, and some
+// fields (e.g. expiry dates) are date-only; times without a zone are UTC.
 var layouts = []string{
-	"2006-01-02T15:04:05Z0700",
-	"2006-01-02T15:04:05.000000",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
 }
 
 func (t *Time) Format(format string) string {
@@ -24,9 +33,6 @@ func (t *Time) Format(format string) string {
 	return ""
 }
 
-//const layout2 = "2006-01-02T15:04:05Z"
-// CCYY-MM-DDThh:mm:ss±hh:mm
-
 // updated: 2022-10-07T18:56:03Z
 // create: 2022-10-07T18:55:42Z
 // launched at: 2022-10-07T18:56:02.000000
@@ -38,25 +44,33 @@ func (t *Time) UnmarshalJSON(b []byte) error {
 		*t = Time(time.Time{})
 		return nil
 	}
+	t0, err := parseTime(s)
+	if err != nil {
+		return err
+	}
+	*t = Time(t0)
+	return nil
+}
+
+// parseTime parses a time in any of the formats emitted by OpenStack.
+func parseTime(s string) (time.Time, error) {
 	var errors error
 	for _, layout := range layouts {
-		//var t0 time.Time
-		if t0, err := time.Parse(layout, s); err != nil {
+		t, err := time.Parse(layout, strings.TrimSpace(s))
+		if err != nil {
 			errors = multierror.Append(errors, err)
 			continue
-		} else {
-			*t = Time(t0)
-			return nil
 		}
+		return t, nil
 	}
-	return errors
+	return time.Time{}, errors
 }
 
 func (t *Time) MarshalJSON() ([]byte, error) {
 	if (time.Time(*t)).IsZero() {
 		return []byte("null"), nil
 	}
-	return []byte(fmt.Sprintf("\"%s\"", (time.Time(*t)).Format(layouts[0]))), nil
+	return []byte(fmt.Sprintf("\"%s\"", (time.Time(*t)).UTC().Format(time.RFC3339Nano))), nil
 }
 
 func (t *Time) String() string {
@@ -70,6 +84,8 @@ func (t *Time) IsZero() bool {
 	return time.Time(*t).IsZero()
 }
 
+// ToTime converts the time in the column value into a timestamp; zero times
+// are returned as NULL.
 func ToTime(ctx context.Context, d *transform.TransformData) (any, error) {
 	var err error
 	if d.Value == nil {
@@ -80,17 +96,22 @@ func ToTime(ctx context.Context, d *transform.TransformData) (any, error) {
 		if t == nil || t.IsZero() {
 			return nil, nil
 		}
-		return t.String(), nil
+		return time.Time(*t), nil
 	case Time:
 		if t.IsZero() {
 			return nil, nil
 		}
-		return t.String(), nil
+		return time.Time(t), nil
 	case time.Time:
 		if t.IsZero() {
 			return nil, nil
 		}
-		return t.String(), nil
+		return t, nil
+	case *time.Time:
+		if t == nil || t.IsZero() {
+			return nil, nil
+		}
+		return *t, nil
 	default:
 		err = fmt.Errorf("invalid type: %T", d.Value)
 	}
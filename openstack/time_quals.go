@@ -0,0 +1,185 @@
+package openstack
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+)
+
+// timeKeyColumn returns an optional key column on a time column, supporting
+// both equality and range operators.
+func timeKeyColumn(name string) *plugin.KeyColumn {
+	return &plugin.KeyColumn{
+		Name:      name,
+		Operators: []string{"=", ">", ">=", "<", "<="},
+		Require:   plugin.Optional,
+	}
+}
+
+// timeBound is one end of a time range.
+type timeBound struct {
+	Time      time.Time
+	Inclusive bool
+}
+
+// timeRange is the range of times selected by the quals on a time column;
+// a nil bound means that the range is open on that side.
+type timeRange struct {
+	Lower *timeBound
+	Upper *timeBound
+}
+
+// timeRanges holds the time ranges selected by the quals, by column.
+type timeRanges map[string]*timeRange
+
+// getTimeRanges collects the quals on the given time columns into ranges;
+// when there are several quals on the same side of a range, the most
+// restrictive one wins.
+func getTimeRanges(quals plugin.KeyColumnQualMap, columns ...string) timeRanges {
+	ranges := timeRanges{}
+	for _, column := range columns {
+		if quals[column] == nil {
+			continue
+		}
+		r := &timeRange{}
+		for _, qual := range quals[column].Quals {
+			t, ok := qualTime(qual.Value)
+			if !ok {
+				continue
+			}
+			switch qual.Operator {
+			case "=":
+				r.setLower(timeBound{t, true})
+				r.setUpper(timeBound{t, true})
+			case ">":
+				r.setLower(timeBound{t, false})
+			case ">=":
+				r.setLower(timeBound{t, true})
+			case "<":
+				r.setUpper(timeBound{t, false})
+			case "<=":
+				r.setUpper(timeBound{t, true})
+			}
+		}
+		if r.Lower != nil || r.Upper != nil {
+			ranges[column] = r
+		}
+	}
+	return ranges
+}
+
+func (r *timeRange) setLower(bound timeBound) {
+	if r.Lower == nil || bound.Time.After(r.Lower.Time) || (bound.Time.Equal(r.Lower.Time) && !bound.Inclusive) {
+		r.Lower = &bound
+	}
+}
+
+func (r *timeRange) setUpper(bound timeBound) {
+	if r.Upper == nil || bound.Time.Before(r.Upper.Time) || (bound.Time.Equal(r.Upper.Time) && !bound.Inclusive) {
+		r.Upper = &bound
+	}
+}
+
+// contains returns whether the given time is in the range; zero times are
+// never in a range.
+func (r *timeRange) contains(t time.Time) bool {
+	if r == nil {
+		return true
+	}
+	if t.IsZero() {
+		return false
+	}
+	if r.Lower != nil && (t.Before(r.Lower.Time) || (!r.Lower.Inclusive && t.Equal(r.Lower.Time))) {
+		return false
+	}
+	if r.Upper != nil && (t.After(r.Upper.Time) || (!r.Upper.Inclusive && t.Equal(r.Upper.Time))) {
+		return false
+	}
+	return true
+}
+
+// match returns whether the given time satisfies the quals on the column;
+// it is used to filter items client-side, since quals pushed down to the
+// API may select a superset of the matching items.
+func (r timeRanges) match(column string, t time.Time) bool {
+	return r[column].contains(t)
+}
+
+// since returns the lower bound of the range, truncated to the second, for
+// APIs that select the items changed since a given time (inclusive); the
+// result is empty if the range has no lower bound.
+func (r *timeRange) since() string {
+	if r == nil || r.Lower == nil {
+		return ""
+	}
+	return formatQualTime(r.Lower.Time.Truncate(time.Second))
+}
+
+// filter returns the range as an "<operator>:<timestamp>" filter, as used
+// by Keystone, Glance and Cinder; since these APIs accept a single filter
+// per column, the lower bound is preferred. The timestamp is rounded so that
+// the filter selects a superset of the range.
+func (r *timeRange) filter() (string, time.Time, bool) {
+	switch {
+	case r == nil:
+		return "", time.Time{}, false
+	case r.Lower != nil:
+		operator := "gt"
+		if r.Lower.Inclusive || r.Lower.Time.Truncate(time.Second) != r.Lower.Time {
+			operator = "gte"
+		}
+		return operator, r.Lower.Time.Truncate(time.Second), true
+	case r.Upper != nil:
+		operator := "lt"
+		upper := r.Upper.Time
+		if truncated := upper.Truncate(time.Second); truncated != upper {
+			upper = truncated.Add(time.Second)
+		} else if r.Upper.Inclusive {
+			operator = "lte"
+		}
+		return operator, upper, true
+	}
+	return "", time.Time{}, false
+}
+
+// filterString returns the range as an "<operator>:<timestamp>" string.
+func (r *timeRange) filterString() string {
+	if operator, t, ok := r.filter(); ok {
+		return fmt.Sprintf("%s:%s", operator, formatQualTime(t))
+	}
+	return ""
+}
+
+// qualTime extracts the time from a qual value, which is a timestamp for
+// timestamp columns or a string.
+func qualTime(value *proto.QualValue) (time.Time, bool) {
+	if value == nil {
+		return time.Time{}, false
+	}
+	if timestamp := value.GetTimestampValue(); timestamp != nil {
+		return timestamp.AsTime(), true
+	}
+	t, err := parseTime(value.GetStringValue())
+	return t, err == nil
+}
+
+// formatQualTime formats a time for use in an API filter.
+func formatQualTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// appendQuery appends extra parameters to a query string built by
+// gophercloud, for filters its ListOpts do not support.
+func appendQuery(query string, err error, params url.Values) (string, error) {
+	if err != nil || len(params) == 0 {
+		return query, err
+	}
+	if strings.Contains(query, "?") {
+		return query + "&" + params.Encode(), nil
+	}
+	return query + "?" + params.Encode(), nil
+}
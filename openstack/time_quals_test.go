@@ -0,0 +1,88 @@
+package openstack
+
+import (
+	"testing"
+	"time"
+
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/quals"
+)
+
+func testTimeQuals(column string, operatorValues ...string) plugin.KeyColumnQualMap {
+	qs := quals.QualSlice{}
+	for i := 0; i+1 < len(operatorValues); i += 2 {
+		qs = append(qs, &quals.Qual{
+			Column:   column,
+			Operator: operatorValues[i],
+			Value:    &proto.QualValue{Value: &proto.QualValue_StringValue{StringValue: operatorValues[i+1]}},
+		})
+	}
+	return plugin.KeyColumnQualMap{column: &plugin.KeyColumnQuals{Name: column, Quals: qs}}
+}
+
+func TestTimeRanges(t *testing.T) {
+	ranges := getTimeRanges(testTimeQuals("created_at",
+		">=", "2023-01-01T00:00:00Z",
+		">", "2023-02-01 10:00:00.5",
+		"<", "2023-03-01",
+	), "created_at", "updated_at")
+
+	if _, ok := ranges["updated_at"]; ok {
+		t.Errorf("unexpected range on column without quals")
+	}
+	if filter := ranges["created_at"].filterString(); filter != "gte:2023-02-01T10:00:00Z" {
+		t.Errorf("unexpected filter %q", filter)
+	}
+	if since := ranges["created_at"].since(); since != "2023-02-01T10:00:00Z" {
+		t.Errorf("unexpected since %q", since)
+	}
+
+	tests := []struct {
+		time  time.Time
+		match bool
+	}{
+		{time.Date(2023, 2, 1, 10, 0, 0, 0, time.UTC), false},
+		{time.Date(2023, 2, 1, 10, 0, 0, 500000000, time.UTC), false},
+		{time.Date(2023, 2, 1, 10, 0, 1, 0, time.UTC), true},
+		{time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), false},
+		{time.Time{}, false},
+	}
+	for _, test := range tests {
+		if match := ranges.match("created_at", test.time); match != test.match {
+			t.Errorf("%s: expected match %t, got %t", test.time, test.match, match)
+		}
+	}
+	if !ranges.match("updated_at", time.Time{}) {
+		t.Errorf("columns without quals must always match")
+	}
+}
+
+func TestTimeRangeUpperFilter(t *testing.T) {
+	tests := []struct {
+		operator string
+		value    string
+		want     string
+	}{
+		{"<", "2023-03-01T12:00:00Z", "lt:2023-03-01T12:00:00Z"},
+		{"<=", "2023-03-01T12:00:00Z", "lte:2023-03-01T12:00:00Z"},
+		{"<=", "2023-03-01T12:00:00.25Z", "lt:2023-03-01T12:00:01Z"},
+		{"=", "2023-03-01T14:00:00+02:00", "gte:2023-03-01T12:00:00Z"},
+	}
+	for _, test := range tests {
+		ranges := getTimeRanges(testTimeQuals("updated_at", test.operator, test.value), "updated_at")
+		if filter := ranges["updated_at"].filterString(); filter != test.want {
+			t.Errorf("%s %s: expected %q, got %q", test.operator, test.value, test.want, filter)
+		}
+	}
+}
+
+func TestAppendQuery(t *testing.T) {
+	params := map[string][]string{"changes-before": {"2023-03-01T12:00:00Z"}}
+	if query, _ := appendQuery("?limit=10", nil, params); query != "?limit=10&changes-before=2023-03-01T12%3A00%3A00Z" {
+		t.Errorf("unexpected query %q", query)
+	}
+	if query, _ := appendQuery("", nil, params); query != "?changes-before=2023-03-01T12%3A00%3A00Z" {
+		t.Errorf("unexpected query %q", query)
+	}
+}
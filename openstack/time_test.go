@@ -3,6 +3,7 @@ package openstack
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 func TestOpenStackTime(t *testing.T) {
@@ -11,17 +12,49 @@ func TestOpenStackTime(t *testing.T) {
 		Time Time
 	}
 
-	var tests = []string{
-		`{"Time": "2022-09-24T13:53:23Z"}`,
-		`{"Time": "2022-10-11T14:17:48.000000"}`,
+	var tests = []struct {
+		service string
+		json    string
+		want    time.Time
+	}{
+		{"nova", `{"Time": "2022-09-24T13:53:23Z"}`, time.Date(2022, 9, 24, 13, 53, 23, 0, time.UTC)},
+		{"nova (OS-SRV-USG)", `{"Time": "2022-10-11T14:17:48.000000"}`, time.Date(2022, 10, 11, 14, 17, 48, 0, time.UTC)},
+		{"nova (server groups)", `{"Time": "2022-10-11T14:17:48"}`, time.Date(2022, 10, 11, 14, 17, 48, 0, time.UTC)},
+		{"neutron", `{"Time": "2022-10-11T14:17:48Z"}`, time.Date(2022, 10, 11, 14, 17, 48, 0, time.UTC)},
+		{"cinder", `{"Time": "2022-10-11T14:17:48.123456"}`, time.Date(2022, 10, 11, 14, 17, 48, 123456000, time.UTC)},
+		{"cinder (attachments)", `{"Time": "2022-10-11T14:17:48.123456+00:00"}`, time.Date(2022, 10, 11, 14, 17, 48, 123456000, time.UTC)},
+		{"keystone", `{"Time": "2022-10-11T14:17:48.000000Z"}`, time.Date(2022, 10, 11, 14, 17, 48, 0, time.UTC)},
+		{"glance", `{"Time": "2022-10-11T16:17:48+02:00"}`, time.Date(2022, 10, 11, 14, 17, 48, 0, time.UTC)},
+		{"compact zone", `{"Time": "2022-10-11T16:17:48+0200"}`, time.Date(2022, 10, 11, 14, 17, 48, 0, time.UTC)},
+		{"space separated", `{"Time": "2022-10-11 14:17:48"}`, time.Date(2022, 10, 11, 14, 17, 48, 0, time.UTC)},
+		{"date only", `{"Time": "2022-10-11"}`, time.Date(2022, 10, 11, 0, 0, 0, 0, time.UTC)},
+		{"null", `{"Time": null}`, time.Time{}},
 	}
 
 	for _, test := range tests {
 		a := Test{}
-		err := json.Unmarshal([]byte(test), &a)
+		err := json.Unmarshal([]byte(test.json), &a)
 		if err != nil {
-			t.Fatal(err)
+			t.Fatalf("%s: %v", test.service, err)
 		}
 		t.Logf("after unmarshalling: %q", a.Time.String())
+		if got := time.Time(a.Time); !got.Equal(test.want) {
+			t.Errorf("%s: expected %s, got %s", test.service, test.want, got)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"Time": "yesterday"}`), &Test{}); err == nil {
+		t.Errorf("expected error parsing an invalid time")
+	}
+}
+
+func TestOpenStackTimeMarshal(t *testing.T) {
+	value := Time(time.Date(2022, 10, 11, 16, 17, 48, 500000000, time.FixedZone("CEST", 7200)))
+	data, err := json.Marshal(&value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"2022-10-11T14:17:48.5Z"` {
+		t.Errorf("unexpected JSON %s", data)
 	}
 }
@@ -3,19 +3,116 @@ package openstack
 import (
 	"context"
 	"errors"
+	"sync"
 
 	"github.com/hashicorp/go-hclog"
+	"github.com/turbot/steampipe-plugin-sdk/v5/grpc/proto"
 	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin/transform"
 )
 
 var ErrNotImplemented = errors.New("not implemented")
 
+// DefaultPageSize is the default number of items requested per page.
+const DefaultPageSize = 1000
+
+// getPageSize returns the number of items to request per page in List
+// calls, which is the page_size option (or its default), lowered to the
+// query LIMIT if smaller so that no more items than needed are fetched.
+func getPageSize(ctx context.Context, d *plugin.QueryData) int {
+	size := DefaultPageSize
+	if config := GetConfig(d.Connection); config.PageSize != nil && *config.PageSize > 0 {
+		size = *config.PageSize
+	}
+	if limit := d.QueryContext.Limit; limit != nil && *limit > 0 && *limit < int64(size) {
+		size = int(*limit)
+	}
+	logger(ctx).Debug("returning", "page size", size)
+	return size
+}
+
+// DefaultProjectConcurrency is the default number of projects (or users)
+// queried in parallel by the tables that list resources one project (or
+// user) at a time.
+const DefaultProjectConcurrency = 10
+
+// getProjectConcurrency returns the number of projects queried in parallel,
+// as per the project_concurrency option (or its default).
+func getProjectConcurrency(ctx context.Context, d *plugin.QueryData) int {
+	concurrency := DefaultProjectConcurrency
+	if config := GetConfig(d.Connection); config.ProjectConcurrency != nil && *config.ProjectConcurrency > 0 {
+		concurrency = *config.ProjectConcurrency
+	}
+	logger(ctx).Debug("returning", "project concurrency", concurrency)
+	return concurrency
+}
+
+// listInParallel calls list for each of the given projects (or users), up to
+// project_concurrency of them at a time, and returns the first error; no
+// more calls are started after an error, once the context is done or when
+// the row limit is reached.
+func listInParallel(ctx context.Context, d *plugin.QueryData, ids []string, list func(id string) error) error {
+	concurrency := getProjectConcurrency(ctx, d)
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		listErr   error
+		semaphore = make(chan struct{}, concurrency)
+	)
+	for _, id := range ids {
+		semaphore <- struct{}{}
+		mutex.Lock()
+		failed := listErr != nil
+		mutex.Unlock()
+		if failed || ctx.Err() != nil || d.RowsRemaining(ctx) == 0 {
+			<-semaphore
+			break
+		}
+		wg.Add(1)
+		go func(id string) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			if err := list(id); err != nil {
+				mutex.Lock()
+				if listErr == nil {
+					listErr = err
+				}
+				mutex.Unlock()
+			}
+		}(id)
+	}
+	wg.Wait()
+	return listErr
+}
+
 // setLogLevel changes the current HCLog level; this seems necessary as the
 // STEAMPIPE_LOG_LEVEL variable does not seem to be properly read by the plugins.
 func setLogLevel(ctx context.Context, d *plugin.QueryData) {
 	openstackConfig := GetConfig(d.Connection)
 	if openstackConfig.TraceLevel != nil {
 		level := *openstackConfig.TraceLevel
-		plugin.Logger(ctx).SetLevel(hclog.LevelFromString(level))
+		logger(ctx).SetLevel(hclog.LevelFromString(level))
+	}
+}
+
+// regionColumn returns the column that reports the region of each resource,
+// which is common to all tables.
+func regionColumn() *plugin.Column {
+	return &plugin.Column{
+		Name:        "region",
+		Type:        proto.ColumnType_STRING,
+		Description: "The region the resource was retrieved from.",
+		Transform:   transform.FromMatrixItem("region").NullIfZero(),
+	}
+}
+
+// regionKeyColumn returns the optional key column on region, which limits
+// the query to the given region.
+func regionKeyColumn() *plugin.KeyColumn {
+	return &plugin.KeyColumn{
+		Name:    "region",
+		Require: plugin.Optional,
 	}
 }